@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"net"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Helpers for the formatters, appending to a caller's buffer where the fmt
+// and encoding/json packages would allocate.
+
+// appendPaddedUint appends the decimal form of v, padded with leading zeros
+// to at least width digits.
+func appendPaddedUint(b []byte, v uint64, width int) []byte {
+	var digits [20]byte
+	d := strconv.AppendUint(digits[:0], v, 10)
+	for i := len(d); i < width; i++ {
+		b = append(b, '0')
+	}
+	return append(b, d...)
+}
+
+// appendIP appends the text form of ip, as returned by net.IP.String.
+func appendIP(b []byte, ip net.IP) []byte {
+	if ip4 := ip.To4(); len(ip4) == net.IPv4len {
+		for i, octet := range ip4 {
+			if i > 0 {
+				b = append(b, '.')
+			}
+			b = strconv.AppendUint(b, uint64(octet), 10)
+		}
+		return b
+	}
+	return append(b, ip.String()...)
+}
+
+// The enum name functions return the names of optional enum fields as
+// formatted by fmt.Sprint, which formats an unset field as "<nil>".
+
+func dnstapTypeName(t *Dnstap_Type) string {
+	if t == nil {
+		return "<nil>"
+	}
+	return t.String()
+}
+
+func messageTypeName(t *Message_Type) string {
+	if t == nil {
+		return "<nil>"
+	}
+	return t.String()
+}
+
+func socketFamilyName(f *SocketFamily) string {
+	if f == nil {
+		return "<nil>"
+	}
+	return f.String()
+}
+
+func socketProtocolName(p *SocketProtocol) string {
+	if p == nil {
+		return "<nil>"
+	}
+	return p.String()
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends s as a quoted JSON string, escaped as by
+// encoding/json.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '\\', '"':
+				b = append(b, '\\', c)
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
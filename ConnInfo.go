@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// A ConnInfo describes a connection accepted by a FrameStreamSockInput,
+// identifying the source of the frames read from it even when the sender
+// sets no Identity.
+type ConnInfo struct {
+	// ID numbers the connections accepted by a FrameStreamSockInput,
+	// starting from 1.
+	ID                    uint64
+	LocalAddr, RemoteAddr net.Addr
+	Accepted              time.Time
+	// TLSPeer is the subject common name, or failing that the first DNS
+	// name, of the certificate presented by the client of a TLS
+	// connection. It is empty if no certificate was presented.
+	TLSPeer string
+	// Cred holds the credentials of the process which connected to a
+	// unix domain socket. It is nil for other connections and on
+	// platforms which do not provide peer credentials.
+	Cred *PeerCred
+}
+
+// PeerCred holds the credentials of the peer process of a unix domain
+// socket connection, as of the time it connected.
+type PeerCred struct {
+	PID, UID, GID int
+}
+
+// newConnInfo returns the ConnInfo for the connection conn. The TLSPeer
+// of a TLS connection is set by the caller once the handshake is complete.
+func newConnInfo(id uint64, conn net.Conn, accepted time.Time) *ConnInfo {
+	c := &ConnInfo{
+		ID:         id,
+		LocalAddr:  conn.LocalAddr(),
+		RemoteAddr: conn.RemoteAddr(),
+		Accepted:   accepted,
+	}
+	if uc, ok := conn.(*net.UnixConn); ok {
+		c.Cred = peerCred(uc)
+	}
+	return c
+}
+
+// tlsPeer returns the name of the certificate presented by the client of
+// conn if it is a TLS connection whose handshake is complete, or the empty
+// string.
+func tlsPeer(conn net.Conn) string {
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return ""
+	}
+	certs := tc.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return ""
+	}
+	if name := certs[0].Subject.CommonName; name != "" {
+		return name
+	}
+	if len(certs[0].DNSNames) > 0 {
+		return certs[0].DNSNames[0]
+	}
+	return ""
+}
+
+// source identifies the sender of the connection for per-source limits:
+// its IP address for TCP/IP connections, or its user ID for unix domain
+// socket connections with peer credentials. It returns the empty string
+// for other connections.
+func (c *ConnInfo) source() string {
+	if addr, ok := c.RemoteAddr.(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	if c.Cred != nil {
+		return fmt.Sprintf("uid %d", c.Cred.UID)
+	}
+	return ""
+}
+
+// String returns a summary of the ConnInfo as space-separated key=value
+// pairs, such as "conn=3 remote=192.0.2.1:41952", or for a unix domain
+// socket connection, "conn=4 pid=1234 uid=53 gid=53".
+func (c *ConnInfo) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "conn=%d", c.ID)
+	if c.RemoteAddr != nil && c.RemoteAddr.String() != "" && c.RemoteAddr.String() != "@" {
+		fmt.Fprintf(&b, " remote=%s", c.RemoteAddr)
+	}
+	if c.TLSPeer != "" {
+		fmt.Fprintf(&b, " tls=%s", c.TLSPeer)
+	}
+	if c.Cred != nil {
+		fmt.Fprintf(&b, " pid=%d uid=%d gid=%d", c.Cred.PID, c.Cred.UID, c.Cred.GID)
+	}
+	return b.String()
+}
+
+// A SourcedFrame is a frame read by a FrameStreamSockInput, with the
+// connection it was read from.
+type SourcedFrame struct {
+	Frame []byte
+	Conn  *ConnInfo
+}
+
+// A StampFunc records information about the connection conn in a frame
+// read from it, returning the modified frame. The frame is modified in
+// place if its capacity allows.
+type StampFunc func(frame []byte, conn *ConnInfo) []byte
+
+// StampIdentity is a StampFunc setting the Identity of frames which have
+// none to the string form of the connection's ConnInfo. Frames which
+// cannot be parsed are left unchanged.
+func StampIdentity(frame []byte, conn *ConnInfo) []byte {
+	hasIdentity := false
+	err := walkFields(frame, func(num protowire.Number, typ protowire.Type, val uint64, b []byte) error {
+		if num == dnstapIdentityField && len(b) > 0 {
+			hasIdentity = true
+		}
+		return nil
+	})
+	if err != nil || hasIdentity {
+		return frame
+	}
+	return appendBytesField(frame, dnstapIdentityField, conn.String())
+}
+
+// StampExtra is a StampFunc setting the Extra field of frames to the
+// string form of the connection's ConnInfo, replacing any Extra data set
+// by the sender.
+func StampExtra(frame []byte, conn *ConnInfo) []byte {
+	return appendBytesField(frame, dnstapExtraField, conn.String())
+}
+
+// appendBytesField appends a bytes field to the encoded message b. When
+// the message is decoded, the appended field replaces any earlier
+// occurrence of the field.
+func appendBytesField(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
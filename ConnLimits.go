@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"net"
+	"time"
+)
+
+// An idleConn is a net.Conn whose reads time out if no data is received
+// for its timeout, once setTimeout has been called.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) setTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	if c.timeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+	return c.Conn.Read(b)
+}
+
+// A rateLimiter paces events to a maximum rate, allowing bursts of up to
+// one second's events. A nil *rateLimiter does not limit the rate.
+type rateLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+// newRateLimiter returns a rateLimiter pacing events to rate per second,
+// or nil if rate is not positive.
+func newRateLimiter(rate float64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait waits until the next event is allowed.
+func (rl *rateLimiter) wait() {
+	if rl == nil {
+		return
+	}
+	now := time.Now()
+	if earliest := now.Add(-time.Second); rl.next.Before(earliest) {
+		rl.next = earliest
+	}
+	rl.next = rl.next.Add(rl.interval)
+	if d := rl.next.Sub(now); d > 0 {
+		time.Sleep(d)
+	}
+}
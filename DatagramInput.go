@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"errors"
+	"net"
+)
+
+// A DatagramInput reads dnstap data sent in datagrams, such as UDP
+// packets, each holding a single dnstap protobuf message without Frame
+// Streams framing, as sent by some embedded senders.
+type DatagramInput struct {
+	conn net.PacketConn
+	log  Logger
+	pool *FramePool
+	wait chan bool
+}
+
+// NewDatagramInput creates a DatagramInput reading the datagrams received
+// on conn.
+func NewDatagramInput(conn net.PacketConn) *DatagramInput {
+	return &DatagramInput{
+		conn: conn,
+		log:  nullLogger{},
+		wait: make(chan bool),
+	}
+}
+
+// SetLogger configures a logger for the DatagramInput.
+func (input *DatagramInput) SetLogger(logger Logger) {
+	input.log = logger
+}
+
+// SetFramePool configures the DatagramInput to take the buffers for the
+// frames it reads from pool.
+func (input *DatagramInput) SetFramePool(pool *FramePool) {
+	input.pool = pool
+}
+
+// ReadInto sends the payload of each datagram received to the output
+// channel, until the DatagramInput's connection is closed. Empty
+// datagrams are ignored.
+//
+// ReadInto satisfies the dnstap Input interface.
+func (input *DatagramInput) ReadInto(output chan []byte) {
+	defer close(input.wait)
+	// A datagram larger than the buffer would be truncated, so the
+	// buffer allows for the largest UDP datagram as well as the largest
+	// payload.
+	size := int(MaxPayloadSize)
+	if size < 65536 {
+		size = 65536
+	}
+	buf := make([]byte, size)
+	for {
+		n, addr, err := input.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			input.log.Printf("%s: read failed: %v", input.conn.LocalAddr(), err)
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		if n > int(MaxPayloadSize) {
+			input.log.Printf("%s: discarding %d byte datagram from %s: larger than %d bytes",
+				input.conn.LocalAddr(), n, addr, MaxPayloadSize)
+			continue
+		}
+		output <- input.pool.Copy(buf[:n])
+	}
+}
+
+// Wait returns when ReadInto has finished.
+//
+// Wait satisfies the dnstap Input interface.
+func (input *DatagramInput) Wait() {
+	<-input.wait
+}
@@ -41,7 +41,7 @@ func NewDecoder(r Reader, maxSize int) *Decoder {
 // maxSize.
 func (d *Decoder) Decode(m *Dnstap) error {
 	for {
-		n, err := d.r.ReadFrame(d.buf)
+		frame, err := d.readFrame()
 
 		switch err {
 		case framestream.ErrDataFrameTooLarge:
@@ -52,6 +52,17 @@ func (d *Decoder) Decode(m *Dnstap) error {
 			return err
 		}
 
-		return proto.Unmarshal(d.buf[:n], m)
+		return proto.Unmarshal(frame, m)
 	}
 }
+
+// readFrame reads the next data frame from the Decoder's Reader into the
+// Decoder's buffer, returning the frame or the Reader's error. The frame
+// is valid until the next call to readFrame or Decode.
+func (d *Decoder) readFrame() ([]byte, error) {
+	n, err := d.r.ReadFrame(d.buf)
+	if err != nil {
+		return nil, err
+	}
+	return d.buf[:n], nil
+}
@@ -0,0 +1,372 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	framestream "github.com/farsightsec/golang-framestream"
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// DiffOptions specifies how Diff pairs and compares responses.
+type DiffOptions struct {
+	// If MatchClient is true, responses are paired only if their
+	// query addresses are equal.
+	MatchClient bool
+	// MatchWindow, if non-zero, pairs responses only if their
+	// response times are within MatchWindow of each other.
+	MatchWindow time.Duration
+	// If CompareTTL is true, responses with identical answers are
+	// reported as differing if their smallest or largest answer TTLs
+	// differ by more than TTLTolerance seconds.
+	CompareTTL   bool
+	TTLTolerance uint32
+	// MaxExamples limits the number of examples kept for each kind
+	// of discrepancy. The default is 5.
+	MaxExamples int
+}
+
+// Kinds of discrepancy reported by Diff.
+const (
+	DiffRcode  = "rcode"
+	DiffFlags  = "flags"
+	DiffAnswer = "answer"
+	DiffTTL    = "ttl"
+)
+
+// A DiffExample describes one pair of responses exhibiting a discrepancy.
+type DiffExample struct {
+	Question string
+	A, B     string
+}
+
+// A DiffCount counts the response pairs exhibiting one kind of
+// discrepancy, with examples.
+type DiffCount struct {
+	Count    uint64
+	Examples []DiffExample
+}
+
+// A DiffReport summarizes the comparison of two streams of responses.
+type DiffReport struct {
+	// Pairs is the number of response pairs compared, and Identical
+	// the number of those with no discrepancy.
+	Pairs, Identical uint64
+	// OnlyA and OnlyB count the responses of each stream which were
+	// not paired with a response from the other stream.
+	OnlyA, OnlyB uint64
+	// SkippedA and SkippedB count the frames of each stream which
+	// could not be decoded, and were skipped.
+	SkippedA, SkippedB uint64
+	// Discrepancies maps each kind of discrepancy (DiffRcode,
+	// DiffFlags, DiffAnswer, DiffTTL) found to its count.
+	Discrepancies map[string]*DiffCount
+}
+
+// diffResponse is the summary of a response message retained for
+// comparison.
+type diffResponse struct {
+	t        time.Time
+	question string
+	rcode    int
+	flags    string
+	answer   []string
+	minTTL   uint32
+	maxTTL   uint32
+	paired   bool
+}
+
+// A diffQueue holds the responses to one question from the first stream,
+// in order of time. The responses before head have all been paired.
+type diffQueue struct {
+	rs   []*diffResponse
+	head int
+}
+
+func newDiffResponse(dt *Dnstap, msg *dns.Msg) *diffResponse {
+	r := &diffResponse{
+		question: diffQuestion(msg),
+		rcode:    msg.Rcode,
+		flags:    diffFlags(msg),
+	}
+	r.t, _ = messageTime(dt)
+	for i, rr := range msg.Answer {
+		h := *rr.Header()
+		if i == 0 || h.Ttl < r.minTTL {
+			r.minTTL = h.Ttl
+		}
+		if h.Ttl > r.maxTTL {
+			r.maxTTL = h.Ttl
+		}
+		rr = dns.Copy(rr)
+		rr.Header().Ttl = 0
+		rr.Header().Name = strings.ToLower(h.Name)
+		r.answer = append(r.answer, strings.Join(strings.Fields(rr.String()), " "))
+	}
+	sort.Strings(r.answer)
+	return r
+}
+
+func diffQuestion(msg *dns.Msg) string {
+	if len(msg.Question) == 0 {
+		return "(no question)"
+	}
+	q := msg.Question[0]
+	return fmt.Sprintf("%s %s %s", strings.ToLower(q.Name),
+		dns.Class(q.Qclass), dns.Type(q.Qtype))
+}
+
+func diffFlags(msg *dns.Msg) string {
+	var flags []string
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{msg.Authoritative, "aa"},
+		{msg.Truncated, "tc"},
+		{msg.RecursionAvailable, "ra"},
+		{msg.AuthenticatedData, "ad"},
+		{msg.CheckingDisabled, "cd"},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	return strings.Join(flags, " ")
+}
+
+// diffKey returns the key by which a response is paired, or false if dt
+// is not a decodable response message.
+func diffKey(dt *Dnstap, opt *DiffOptions) (string, *dns.Msg, bool) {
+	m := dt.GetMessage()
+	if dt.GetType() != Dnstap_MESSAGE || m == nil || m.Type == nil ||
+		isQueryType(*m.Type) || m.ResponseMessage == nil {
+		return "", nil, false
+	}
+	msg := new(dns.Msg)
+	if err := msg.Unpack(m.ResponseMessage); err != nil {
+		return "", nil, false
+	}
+	key := diffQuestion(msg)
+	if opt.MatchClient {
+		key += " " + net.IP(m.QueryAddress).String()
+	}
+	return key, msg, true
+}
+
+// Diff reads the response messages decoded by a and b, pairs responses to
+// the same question, and reports the discrepancies between each pair. All
+// responses from a are held in memory while b is read. Frames which cannot
+// be decoded are counted and skipped.
+func Diff(a, b *Decoder, opt *DiffOptions) (*DiffReport, error) {
+	if opt == nil {
+		opt = &DiffOptions{}
+	}
+	if opt.MaxExamples == 0 {
+		opt.MaxExamples = 5
+	}
+
+	report := &DiffReport{Discrepancies: make(map[string]*DiffCount)}
+	responses := make(map[string]*diffQueue)
+	err := readDiffResponses(a, opt, &report.SkippedA, func(key string, r *diffResponse) {
+		q := responses[key]
+		if q == nil {
+			q = &diffQueue{}
+			responses[key] = q
+		}
+		q.rs = append(q.rs, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range responses {
+		sort.SliceStable(q.rs, func(i, j int) bool { return q.rs[i].t.Before(q.rs[j].t) })
+	}
+
+	err = readDiffResponses(b, opt, &report.SkippedB, func(key string, rb *diffResponse) {
+		var ra *diffResponse
+		if q := responses[key]; q != nil {
+			ra = q.pair(rb, opt)
+		}
+		if ra == nil {
+			report.OnlyB++
+			return
+		}
+		report.compare(ra, rb, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, q := range responses {
+		for _, r := range q.rs[q.head:] {
+			if !r.paired {
+				report.OnlyA++
+			}
+		}
+	}
+	return report, nil
+}
+
+// readDiffResponses calls f with the key and summary of each response
+// message read from d, counting in skipped the frames which cannot be
+// decoded.
+func readDiffResponses(d *Decoder, opt *DiffOptions, skipped *uint64, f func(string, *diffResponse)) error {
+	for {
+		frame, err := d.readFrame()
+		switch err {
+		case nil:
+		case io.EOF:
+			return nil
+		case framestream.ErrDataFrameTooLarge:
+			*skipped++
+			continue
+		default:
+			return err
+		}
+		dt := &Dnstap{}
+		if err := proto.Unmarshal(frame, dt); err != nil {
+			*skipped++
+			continue
+		}
+		if key, msg, ok := diffKey(dt, opt); ok {
+			f(key, newDiffResponse(dt, msg))
+		}
+	}
+}
+
+// pair marks as paired and returns the first unpaired response in q
+// within the match window of r, or returns nil if there is none.
+func (q *diffQueue) pair(r *diffResponse, opt *DiffOptions) *diffResponse {
+	var found *diffResponse
+	if opt.MatchWindow == 0 {
+		if q.head < len(q.rs) {
+			found = q.rs[q.head]
+		}
+	} else {
+		for _, c := range q.rs[q.head:] {
+			if c.t.Sub(r.t) > opt.MatchWindow {
+				break
+			}
+			if !c.paired && r.t.Sub(c.t) <= opt.MatchWindow {
+				found = c
+				break
+			}
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	found.paired = true
+	for q.head < len(q.rs) && q.rs[q.head].paired {
+		q.rs[q.head] = nil
+		q.head++
+	}
+	return found
+}
+
+func (report *DiffReport) compare(a, b *diffResponse, opt *DiffOptions) {
+	report.Pairs++
+	identical := true
+	add := func(kind, va, vb string) {
+		identical = false
+		dc, ok := report.Discrepancies[kind]
+		if !ok {
+			dc = &DiffCount{}
+			report.Discrepancies[kind] = dc
+		}
+		dc.Count++
+		if len(dc.Examples) < opt.MaxExamples {
+			dc.Examples = append(dc.Examples, DiffExample{Question: a.question, A: va, B: vb})
+		}
+	}
+
+	if a.rcode != b.rcode {
+		add(DiffRcode, dns.RcodeToString[a.rcode], dns.RcodeToString[b.rcode])
+	}
+	if a.flags != b.flags {
+		add(DiffFlags, a.flags, b.flags)
+	}
+	sameAnswer := len(a.answer) == len(b.answer)
+	for i := 0; sameAnswer && i < len(a.answer); i++ {
+		sameAnswer = a.answer[i] == b.answer[i]
+	}
+	if !sameAnswer {
+		add(DiffAnswer, diffAnswerString(a.answer), diffAnswerString(b.answer))
+	} else if opt.CompareTTL && len(a.answer) > 0 &&
+		(ttlDiffers(a.minTTL, b.minTTL, opt) || ttlDiffers(a.maxTTL, b.maxTTL, opt)) {
+		add(DiffTTL, fmt.Sprintf("TTL %d-%d", a.minTTL, a.maxTTL),
+			fmt.Sprintf("TTL %d-%d", b.minTTL, b.maxTTL))
+	}
+	if identical {
+		report.Identical++
+	}
+}
+
+// ttlDiffers reports whether the TTLs a and b differ by more than the
+// TTLTolerance option.
+func ttlDiffers(a, b uint32, opt *DiffOptions) bool {
+	d := int64(a) - int64(b)
+	if d < 0 {
+		d = -d
+	}
+	return d > int64(opt.TTLTolerance)
+}
+
+func diffAnswerString(answer []string) string {
+	if len(answer) == 0 {
+		return "(empty)"
+	}
+	return strings.Join(answer, "; ")
+}
+
+// Format writes a human-readable summary of the report to w, naming the
+// compared streams nameA and nameB.
+func (report *DiffReport) Format(w io.Writer, nameA, nameB string) error {
+	_, err := fmt.Fprintf(w, "%d response pairs compared: %d identical, %d differing\n",
+		report.Pairs, report.Identical, report.Pairs-report.Identical)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d responses only in %s, %d only in %s\n",
+		report.OnlyA, nameA, report.OnlyB, nameB)
+	if report.SkippedA > 0 || report.SkippedB > 0 {
+		fmt.Fprintf(w, "%d undecodable frames skipped in %s, %d in %s\n",
+			report.SkippedA, nameA, report.SkippedB, nameB)
+	}
+
+	for _, kind := range []string{DiffRcode, DiffFlags, DiffAnswer, DiffTTL} {
+		dc, ok := report.Discrepancies[kind]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s differs in %d pairs\n", kind, dc.Count)
+		for _, ex := range dc.Examples {
+			fmt.Fprintf(w, "    %s\n        %s: %s\n        %s: %s\n",
+				ex.Question, nameA, ex.A, nameB, ex.B)
+		}
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
@@ -0,0 +1,477 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	framestream "github.com/farsightsec/golang-framestream"
+)
+
+const (
+	// DefaultDirectoryInterval is the default interval at which a
+	// DirectoryInput looks for new files.
+	DefaultDirectoryInterval = 5 * time.Second
+	// DefaultDirectoryMinAge is the default time for which a file must
+	// be unmodified before a DirectoryInput considers it complete.
+	DefaultDirectoryMinAge = 10 * time.Second
+)
+
+// A DirectoryOrder is the order in which a DirectoryInput reads the files
+// found in a scan.
+type DirectoryOrder int
+
+const (
+	// OrderByName reads files in lexical order of their names, suiting
+	// files named with timestamps or sequence numbers.
+	OrderByName DirectoryOrder = iota
+	// OrderByModTime reads files in order of their modification times,
+	// and files with equal times in order of their names.
+	OrderByModTime
+)
+
+// DirectoryOptions configures a DirectoryInput.
+type DirectoryOptions struct {
+	// Pattern selects the files to read, using the syntax of
+	// filepath.Match, as in "/var/spool/dnstap/*.fstrm".
+	Pattern string
+	// Order is the order in which the complete files found in a scan
+	// are read.
+	Order DirectoryOrder
+	// Interval is the interval between scans for new files. The default
+	// is DefaultDirectoryInterval.
+	Interval time.Duration
+	// MinAge is the time for which a file must be unmodified before it
+	// is considered complete and read. The default is
+	// DefaultDirectoryMinAge.
+	MinAge time.Duration
+	// Delete removes each file after it has been read, that is, once
+	// its frames have been sent to the output channel, unless
+	// ManualCommit is set. MoveTo, if non-empty, instead moves each
+	// file into the directory MoveTo, which must be on the same file
+	// system. Files which cannot be decoded are neither removed nor
+	// moved.
+	Delete bool
+	MoveTo string
+	// Checkpoint, if non-empty, names a file recording the files which
+	// have been read, so that they are not read again when the
+	// DirectoryInput is restarted. Without a checkpoint, files which are
+	// neither deleted nor moved are read again on restart.
+	Checkpoint string
+	// Once causes ReadInto to return after reading the complete files
+	// found in the first scan, rather than waiting for more files.
+	Once bool
+	// If ManualCommit is true, the files read are recorded in the
+	// checkpoint, and deleted or moved, only when Commit is called,
+	// rather than as soon as their frames have been sent to the output
+	// channel.
+	ManualCommit bool
+	// Logger receives reports of the files read and of errors.
+	Logger Logger
+}
+
+// A DirectoryInput is a dnstap Input reading the Frame Streams files
+// matching a pattern, such as the rotated capture files written to a
+// spool directory. It scans for files periodically, reads each complete
+// file once, and optionally deletes or moves the files it has read.
+//
+// A file is recorded as read, in the checkpoint if one is configured,
+// once all of its frames have been sent to the output channel, and before
+// it is deleted or moved. A file whose reading is interrupted by a crash
+// is read again from its start on restart, so its frames may be delivered
+// twice. Frames sent to the output channel may not yet have been written
+// by the outputs, so if the program crashes, the last frames of the files
+// most recently deleted or moved can be lost. With the ManualCommit
+// option, files are instead recorded and disposed of by Commit, which the
+// program calls once the outputs have written the frames sent to them, as
+// after closing the outputs.
+//
+// Files are identified by their names, sizes, and modification times, so
+// a file written again under the name of a file already read is read
+// again. Files which are renamed after being read, as by rotation schemes
+// which number files by age, are also read again, so the pattern should
+// match only files with their final names.
+type DirectoryInput struct {
+	opt      DirectoryOptions
+	log      Logger
+	pool     *FramePool
+	mu       sync.Mutex // protects done and pending
+	done     map[string]dirEntry
+	pending  map[string]dirEntry // files read but not yet committed
+	stop     chan struct{}
+	stopOnce sync.Once
+	wait     chan bool
+}
+
+// A dirEntry records a file read by a DirectoryInput.
+type dirEntry struct {
+	size  int64
+	mtime int64 // in nanoseconds since the Unix epoch
+	ok    bool  // false if the file could not be decoded
+}
+
+func (e dirEntry) matches(fi os.FileInfo) bool {
+	return e.size == fi.Size() && e.mtime == fi.ModTime().UnixNano()
+}
+
+// NewDirectoryInput creates a DirectoryInput with the given options,
+// loading its checkpoint file if it exists.
+func NewDirectoryInput(opt *DirectoryOptions) (*DirectoryInput, error) {
+	input := &DirectoryInput{
+		opt:     *opt,
+		log:     opt.Logger,
+		done:    make(map[string]dirEntry),
+		pending: make(map[string]dirEntry),
+		stop:    make(chan struct{}),
+		wait:    make(chan bool),
+	}
+	if input.log == nil {
+		input.log = nullLogger{}
+	}
+	if input.opt.Interval <= 0 {
+		input.opt.Interval = DefaultDirectoryInterval
+	}
+	if input.opt.MinAge <= 0 {
+		input.opt.MinAge = DefaultDirectoryMinAge
+	}
+	if _, err := filepath.Match(opt.Pattern, ""); err != nil || opt.Pattern == "" {
+		return nil, fmt.Errorf("invalid pattern %q", opt.Pattern)
+	}
+	if opt.Delete && opt.MoveTo != "" {
+		return nil, errors.New("files cannot be both deleted and moved")
+	}
+	if opt.MoveTo != "" {
+		fi, err := os.Stat(opt.MoveTo)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", opt.MoveTo)
+		}
+	}
+	if opt.Checkpoint != "" {
+		if err := input.loadCheckpoint(); err != nil {
+			return nil, err
+		}
+	}
+	return input, nil
+}
+
+// SetFramePool configures the DirectoryInput to take the buffers for the
+// frames it reads from pool.
+func (input *DirectoryInput) SetFramePool(pool *FramePool) {
+	input.pool = pool
+}
+
+// Stop causes ReadInto to return after finishing the file being read.
+func (input *DirectoryInput) Stop() {
+	input.stopOnce.Do(func() { close(input.stop) })
+}
+
+func (input *DirectoryInput) stopped() bool {
+	select {
+	case <-input.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadInto reads the complete files matching the DirectoryInput's pattern
+// into the output channel, until the DirectoryInput is stopped or, with
+// the Once option, the files found in the first scan have been read.
+//
+// ReadInto satisfies the dnstap Input interface.
+func (input *DirectoryInput) ReadInto(output chan []byte) {
+	defer close(input.wait)
+	buf := make([]byte, MaxPayloadSize)
+	for {
+		for _, name := range input.scan() {
+			if input.stopped() {
+				return
+			}
+			err := input.readFile(name, buf, output)
+			if err != nil {
+				input.log.Printf("DirectoryInput: %s: %v, skipping", name, err)
+			}
+			input.finish(name, err == nil)
+		}
+		if input.opt.Once {
+			return
+		}
+		t := time.NewTimer(input.opt.Interval)
+		select {
+		case <-input.stop:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Wait returns when ReadInto has finished.
+//
+// Wait satisfies the dnstap Input interface.
+func (input *DirectoryInput) Wait() {
+	<-input.wait
+}
+
+// scan returns the names of the complete files matching the pattern which
+// have not been read, in the order they are to be read. Files which were
+// read but not deleted or moved before a restart are deleted or moved, and
+// files which no longer match the pattern are forgotten.
+func (input *DirectoryInput) scan() []string {
+	names, err := filepath.Glob(input.opt.Pattern)
+	if err != nil {
+		input.log.Printf("DirectoryInput: %v", err)
+		return nil
+	}
+	type file struct {
+		name  string
+		mtime time.Time
+	}
+	var files []file
+	seen := make(map[string]bool)
+	now := time.Now()
+	input.mu.Lock()
+	defer input.mu.Unlock()
+	for _, name := range names {
+		if input.opt.Checkpoint != "" &&
+			(name == input.opt.Checkpoint || name == input.opt.Checkpoint+".tmp") {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		seen[name] = true
+		if e, ok := input.pending[name]; ok && e.matches(fi) {
+			continue
+		}
+		if e, ok := input.done[name]; ok && e.matches(fi) {
+			if e.ok {
+				input.dispose(name)
+			}
+			continue
+		}
+		if now.Sub(fi.ModTime()) < input.opt.MinAge {
+			continue
+		}
+		files = append(files, file{name, fi.ModTime()})
+	}
+
+	forgotten := false
+	for name := range input.done {
+		if !seen[name] {
+			delete(input.done, name)
+			forgotten = true
+		}
+	}
+	if forgotten {
+		input.saveCheckpoint()
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if input.opt.Order == OrderByModTime && !files[i].mtime.Equal(files[j].mtime) {
+			return files[i].mtime.Before(files[j].mtime)
+		}
+		return files[i].name < files[j].name
+	})
+	result := make([]string, len(files))
+	for i, f := range files {
+		result[i] = f.name
+	}
+	return result
+}
+
+// readFile reads the frames of the named file into the output channel.
+func (input *DirectoryInput) readFile(name string, buf []byte, output chan []byte) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := NewReader(f, nil)
+	if err != nil {
+		return err
+	}
+	frames := 0
+	for {
+		n, err := r.ReadFrame(buf)
+		switch err {
+		case nil:
+			output <- input.pool.Copy(buf[:n])
+			frames++
+		case framestream.ErrDataFrameTooLarge:
+			input.log.Printf("DirectoryInput: %s: %v", name, err)
+		case io.EOF:
+			input.log.Printf("DirectoryInput: read %d frames from %s", frames, name)
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// finish records the named file as read, successfully if ok is true, and
+// deletes or moves it if it was read successfully. With the ManualCommit
+// option, this is left to Commit.
+func (input *DirectoryInput) finish(name string, ok bool) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		input.log.Printf("DirectoryInput: %v", err)
+		return
+	}
+	e := dirEntry{size: fi.Size(), mtime: fi.ModTime().UnixNano(), ok: ok}
+	input.mu.Lock()
+	defer input.mu.Unlock()
+	if input.opt.ManualCommit {
+		input.pending[name] = e
+		return
+	}
+	input.done[name] = e
+	input.saveCheckpoint()
+	if ok {
+		input.dispose(name)
+	}
+}
+
+// Commit records the files read since the last call to Commit, in the
+// checkpoint if one is configured, and deletes or moves those read
+// successfully, if so configured. It is needed only with the ManualCommit
+// option, and should be called once the frames sent to the output channel
+// have been written.
+func (input *DirectoryInput) Commit() {
+	input.mu.Lock()
+	defer input.mu.Unlock()
+	if len(input.pending) == 0 {
+		return
+	}
+	for name, e := range input.pending {
+		input.done[name] = e
+	}
+	input.saveCheckpoint()
+	for name, e := range input.pending {
+		if e.ok {
+			input.dispose(name)
+		}
+		delete(input.pending, name)
+	}
+}
+
+// dispose deletes or moves the named file, if so configured. The file's
+// checkpoint entry is forgotten in the next scan.
+func (input *DirectoryInput) dispose(name string) {
+	var err error
+	switch {
+	case input.opt.Delete:
+		err = os.Remove(name)
+	case input.opt.MoveTo != "":
+		err = os.Rename(name, filepath.Join(input.opt.MoveTo, filepath.Base(name)))
+	}
+	if err != nil {
+		input.log.Printf("DirectoryInput: %v", err)
+	}
+}
+
+// The checkpoint file holds a line for each file read, giving whether it
+// was read successfully ("ok" or "failed"), its size and modification
+// time, and its name, which may contain spaces.
+
+func (input *DirectoryInput) loadCheckpoint() error {
+	f, err := os.Open(input.opt.Checkpoint)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		fields := strings.SplitN(s.Text(), " ", 4)
+		if len(fields) != 4 || fields[0] != "ok" && fields[0] != "failed" {
+			return fmt.Errorf("%s:%d: invalid checkpoint entry", input.opt.Checkpoint, line)
+		}
+		size, err1 := strconv.ParseInt(fields[1], 10, 64)
+		mtime, err2 := strconv.ParseInt(fields[2], 10, 64)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("%s:%d: invalid checkpoint entry", input.opt.Checkpoint, line)
+		}
+		input.done[fields[3]] = dirEntry{size: size, mtime: mtime, ok: fields[0] == "ok"}
+	}
+	return s.Err()
+}
+
+// saveCheckpoint writes the checkpoint file, replacing it atomically so
+// that a crash leaves either the previous or the new checkpoint.
+func (input *DirectoryInput) saveCheckpoint() {
+	if input.opt.Checkpoint == "" {
+		return
+	}
+	names := make([]string, 0, len(input.done))
+	for name := range input.done {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		e := input.done[name]
+		status := "ok"
+		if !e.ok {
+			status = "failed"
+		}
+		fmt.Fprintf(&b, "%s %d %d %s\n", status, e.size, e.mtime, name)
+	}
+
+	tmp := input.opt.Checkpoint + ".tmp"
+	err := writeFileSync(tmp, []byte(b.String()))
+	if err == nil {
+		err = os.Rename(tmp, input.opt.Checkpoint)
+	}
+	if err != nil {
+		input.log.Printf("DirectoryInput: failed to save checkpoint: %v", err)
+	}
+}
+
+// writeFileSync writes data to the named file and syncs it to stable
+// storage.
+func writeFileSync(name string, data []byte) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
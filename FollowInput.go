@@ -0,0 +1,257 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	framestream "github.com/farsightsec/golang-framestream"
+)
+
+// DefaultFollowInterval is the default interval at which a FollowInput
+// checks its file for new data.
+const DefaultFollowInterval = 250 * time.Millisecond
+
+// followHeadSize is the number of bytes at the start of a followed file
+// which are compared to detect the file being rewritten.
+const followHeadSize = 512
+
+// Reasons for a followFile to stop reading its file.
+var (
+	errFollowRotated   = errors.New("file renamed or removed")
+	errFollowTruncated = errors.New("file truncated")
+	errFollowStopped   = errors.New("stopped")
+)
+
+// A FollowInput reads dnstap data from a Frame Streams file as it is
+// written, in the manner of "tail -F". At the end of the file's data, the
+// FollowInput waits for more data to be written rather than finishing.
+//
+// If the file is renamed or removed, as for rotation, the FollowInput
+// finishes reading the file's data and then reads the file created in its
+// place. If the file is truncated, or its first bytes change as when it is
+// truncated and rewritten between checks, it is read again from the start. A new
+// Frame Streams stream started after the stop frame of a previous one, as
+// when a writer reopens the file for appending, is read as well.
+type FollowInput struct {
+	filename string
+	interval time.Duration
+	log      Logger
+	pool     *FramePool
+	stop     chan struct{}
+	stopOnce sync.Once
+	wait     chan bool
+}
+
+// NewFollowInput creates a FollowInput following the named file. The file
+// need not exist yet.
+func NewFollowInput(filename string) *FollowInput {
+	return &FollowInput{
+		filename: filename,
+		interval: DefaultFollowInterval,
+		log:      nullLogger{},
+		stop:     make(chan struct{}),
+		wait:     make(chan bool),
+	}
+}
+
+// SetInterval sets the interval at which the FollowInput checks for new
+// data and for the file being rotated or truncated. The default interval
+// is DefaultFollowInterval.
+func (input *FollowInput) SetInterval(interval time.Duration) {
+	input.interval = interval
+}
+
+// SetLogger configures a logger for the FollowInput.
+func (input *FollowInput) SetLogger(logger Logger) {
+	input.log = logger
+}
+
+// SetFramePool configures the FollowInput to take the buffers for the
+// frames it reads from pool.
+func (input *FollowInput) SetFramePool(pool *FramePool) {
+	input.pool = pool
+}
+
+// Stop causes ReadInto to return without waiting for more data.
+func (input *FollowInput) Stop() {
+	input.stopOnce.Do(func() { close(input.stop) })
+}
+
+// sleep waits for the FollowInput's interval, returning false if the
+// FollowInput is stopped.
+func (input *FollowInput) sleep() bool {
+	t := time.NewTimer(input.interval)
+	defer t.Stop()
+	select {
+	case <-input.stop:
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// ReadInto reads data from the followed file into the output channel
+// until the FollowInput is stopped.
+//
+// ReadInto satisfies the dnstap Input interface.
+func (input *FollowInput) ReadInto(output chan []byte) {
+	defer close(input.wait)
+	buf := make([]byte, MaxPayloadSize)
+	missing := false
+	for {
+		f, err := os.Open(input.filename)
+		if err != nil {
+			if !missing {
+				input.log.Printf("FollowInput: %v, waiting", err)
+				missing = true
+			}
+			if !input.sleep() {
+				return
+			}
+			continue
+		}
+		missing = false
+
+		ff := &followFile{input: input, f: f}
+		if ff.fi, err = f.Stat(); err != nil {
+			ff.err = err
+		} else {
+			input.readFile(ff, buf, output)
+		}
+		f.Close()
+		if ff.err == errFollowStopped {
+			return
+		}
+		input.log.Printf("FollowInput: %s: %v, reopening", input.filename, ff.err)
+		if ff.err != errFollowRotated && ff.err != errFollowTruncated && !input.sleep() {
+			return
+		}
+	}
+}
+
+// readFile reads the Frame Streams data of the followed file into the
+// output channel until the followFile returns an error.
+func (input *FollowInput) readFile(ff *followFile, buf []byte, output chan []byte) {
+	// The framestream.Reader uses br as its buffer, so data following
+	// the stop frame of one stream is not lost when reading the next.
+	br := bufio.NewReader(ff)
+	for ff.err == nil {
+		r, err := NewReader(br, nil)
+		for err == nil {
+			var n int
+			n, err = r.ReadFrame(buf)
+			switch err {
+			case nil:
+				output <- input.pool.Copy(buf[:n])
+			case framestream.ErrDataFrameTooLarge:
+				input.log.Printf("FollowInput: %s: %v", input.filename, err)
+				err = nil
+			}
+		}
+		if err == io.EOF || ff.err != nil {
+			// A stop frame, after which another stream may be
+			// written, or the end of the file.
+			continue
+		}
+		// Data which cannot be decoded is skipped until the file is
+		// rotated or truncated.
+		input.log.Printf("FollowInput: %s: %v, skipping to end of file", input.filename, err)
+		io.Copy(ioutil.Discard, br)
+	}
+}
+
+// Wait returns when ReadInto has finished.
+//
+// Wait satisfies the dnstap Input interface.
+func (input *FollowInput) Wait() {
+	<-input.wait
+}
+
+// A followFile is an io.Reader returning the data of a followed file,
+// waiting for more data at the end of the file. It returns an error, also
+// recorded in err, when the file is rotated or truncated, the FollowInput
+// is stopped, or the file cannot be read.
+type followFile struct {
+	input *FollowInput
+	f     *os.File
+	fi    os.FileInfo
+	off   int64
+	head  []byte
+	err   error
+}
+
+// consume records the data read from the file in p.
+func (ff *followFile) consume(p []byte) {
+	if k := followHeadSize - len(ff.head); k > 0 {
+		if k > len(p) {
+			k = len(p)
+		}
+		ff.head = append(ff.head, p[:k]...)
+	}
+	ff.off += int64(len(p))
+}
+
+// truncated reports whether the file is shorter than the data read from
+// it, or its first bytes differ from those read.
+func (ff *followFile) truncated() bool {
+	if fi, err := ff.f.Stat(); err == nil && fi.Size() < ff.off {
+		return true
+	}
+	b := make([]byte, len(ff.head))
+	n, _ := ff.f.ReadAt(b, 0)
+	return !bytes.Equal(b[:n], ff.head)
+}
+
+func (ff *followFile) Read(p []byte) (int, error) {
+	for ff.err == nil {
+		n, err := ff.f.Read(p)
+		if n > 0 {
+			ff.consume(p[:n])
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			ff.err = err
+			break
+		}
+
+		if fi, err := os.Stat(ff.input.filename); err != nil || !os.SameFile(fi, ff.fi) {
+			// Read any data written before the file was replaced.
+			if n, _ := ff.f.Read(p); n > 0 {
+				ff.consume(p[:n])
+				return n, nil
+			}
+			ff.err = errFollowRotated
+			break
+		}
+		// The file is checked before reading on, as data written
+		// after a truncation may extend past the offset read.
+		if !ff.input.sleep() {
+			ff.err = errFollowStopped
+		} else if ff.truncated() {
+			ff.err = errFollowTruncated
+		}
+	}
+	return 0, ff.err
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+// DefaultFramePoolSize is the number of unused buffers retained by a
+// FramePool created with a size of zero.
+const DefaultFramePoolSize = 1024
+
+// frameBufferUnit is the granularity of pooled buffer capacities, allowing
+// a buffer to be reused for frames of somewhat different sizes.
+const frameBufferUnit = 1024
+
+// A FramePool recycles the buffers holding dnstap frames passed from an
+// Input to an Output, avoiding an allocation per frame.
+//
+// An Input configured with a FramePool takes the buffer for each frame it
+// sends from the pool. Ownership of the buffer passes with the frame, and
+// an Output configured with the same FramePool returns the buffer to the
+// pool with Put when it has finished with the frame. A frame sent to more
+// than one Output must be copied for all but one of them, as an Output may
+// release a frame while another is still reading it.
+//
+// A nil *FramePool is valid, and allocates a new buffer for every frame.
+type FramePool struct {
+	free chan []byte
+}
+
+// NewFramePool creates a FramePool retaining up to size unused buffers. If
+// size is zero, DefaultFramePoolSize is used.
+func NewFramePool(size int) *FramePool {
+	if size <= 0 {
+		size = DefaultFramePoolSize
+	}
+	return &FramePool{free: make(chan []byte, size)}
+}
+
+// Get returns a buffer of length n, taken from the pool if one of
+// sufficient capacity is available.
+func (p *FramePool) Get(n int) []byte {
+	if p != nil {
+		select {
+		case b := <-p.free:
+			if cap(b) >= n {
+				return b[:n]
+			}
+		default:
+		}
+	}
+	return make([]byte, n, (n+frameBufferUnit-1)/frameBufferUnit*frameBufferUnit)
+}
+
+// Put returns the buffer b to the pool. The caller must not use b after
+// calling Put.
+func (p *FramePool) Put(b []byte) {
+	if p == nil || cap(b) == 0 {
+		return
+	}
+	select {
+	case p.free <- b:
+	default:
+	}
+}
+
+// Copy returns a copy of the frame b in a buffer from the pool.
+func (p *FramePool) Copy(b []byte) []byte {
+	c := p.Get(len(b))
+	copy(c, b)
+	return c
+}
@@ -40,6 +40,7 @@ type FrameStreamInput struct {
 	wait   chan bool
 	reader Reader
 	log    Logger
+	pool   *FramePool
 }
 
 // NewFrameStreamInput creates a FrameStreamInput reading data from the given
@@ -62,11 +63,17 @@ func NewFrameStreamInputTimeout(r io.ReadWriter, bi bool, timeout time.Duration)
 		return nil, err
 	}
 
+	return NewFrameStreamInputFromReader(reader), nil
+}
+
+// NewFrameStreamInputFromReader creates a FrameStreamInput reading data
+// from the given dnstap Reader.
+func NewFrameStreamInputFromReader(r Reader) *FrameStreamInput {
 	return &FrameStreamInput{
 		wait:   make(chan bool),
-		reader: reader,
+		reader: r,
 		log:    nullLogger{},
-	}, nil
+	}
 }
 
 // NewFrameStreamInputFromFilename creates a FrameStreamInput reading from
@@ -84,6 +91,12 @@ func (input *FrameStreamInput) SetLogger(logger Logger) {
 	input.log = logger
 }
 
+// SetFramePool configures the FrameStreamInput to take the buffers for the
+// frames it reads from pool.
+func (input *FrameStreamInput) SetFramePool(pool *FramePool) {
+	input.pool = pool
+}
+
 // ReadInto reads data from the FrameStreamInput into the output channel.
 //
 // ReadInto satisfies the dnstap Input interface.
@@ -92,9 +105,7 @@ func (input *FrameStreamInput) ReadInto(output chan []byte) {
 	for {
 		n, err := input.reader.ReadFrame(buf)
 		if err == nil {
-			newbuf := make([]byte, n)
-			copy(newbuf, buf)
-			output <- newbuf
+			output <- input.pool.Copy(buf[:n])
 			continue
 		}
 
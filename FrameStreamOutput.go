@@ -27,6 +27,9 @@ type FrameStreamOutput struct {
 	wait          chan bool
 	w             Writer
 	log           Logger
+	index         *indexBuilder
+	indexWriter   io.Writer
+	pool          *FramePool
 }
 
 // NewFrameStreamOutput creates a FrameStreamOutput writing dnstap data to
@@ -64,6 +67,24 @@ func (o *FrameStreamOutput) SetLogger(logger Logger) {
 	o.log = logger
 }
 
+// SetFramePool configures the FrameStreamOutput to return the buffers of
+// the frames it has written to pool.
+func (o *FrameStreamOutput) SetFramePool(pool *FramePool) {
+	o.pool = pool
+}
+
+// SetIndex configures the FrameStreamOutput to build an Index with an
+// entry for every interval-th data frame written, and to write it to iw
+// when the FrameStreamOutput is closed. If iw is also an io.Closer, it is
+// closed after the index is written. The index offsets assume that the
+// FrameStreamOutput's io.Writer is at the start of a file.
+//
+// SetIndex must be called before RunOutputLoop.
+func (o *FrameStreamOutput) SetIndex(iw io.Writer, interval uint64) {
+	o.index = newIndexBuilder(interval, int64(len(frameStreamHeader())))
+	o.indexWriter = iw
+}
+
 // GetOutputChannel returns the channel on which the FrameStreamOutput accepts
 // data.
 //
@@ -85,6 +106,10 @@ func (o *FrameStreamOutput) RunOutputLoop() {
 			close(o.wait)
 			return
 		}
+		if o.index != nil {
+			o.index.add(frame)
+		}
+		o.pool.Put(frame)
 	}
 	close(o.wait)
 }
@@ -97,4 +122,12 @@ func (o *FrameStreamOutput) Close() {
 	close(o.outputChannel)
 	<-o.wait
 	o.w.Close()
+	if o.index != nil {
+		if _, err := o.index.finish().WriteTo(o.indexWriter); err != nil {
+			o.log.Printf("FrameStreamOutput: Index write error: %v", err)
+		}
+		if c, ok := o.indexWriter.(io.Closer); ok {
+			c.Close()
+		}
+	}
 }
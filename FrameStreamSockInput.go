@@ -19,7 +19,7 @@ package dnstap
 import (
 	"fmt"
 	"net"
-	"os"
+	"sync"
 	"time"
 )
 
@@ -30,6 +30,18 @@ type FrameStreamSockInput struct {
 	listener net.Listener
 	timeout  time.Duration
 	log      Logger
+	pool     *FramePool
+	stamp    StampFunc
+	uni      bool
+
+	maxConns     int
+	maxPerSource int
+	idleTimeout  time.Duration
+	maxRate      float64
+
+	mu      sync.Mutex
+	active  int
+	sources map[string]int
 }
 
 // NewFrameStreamSockInput creates a FrameStreamSockInput collecting dnstap
@@ -55,15 +67,75 @@ func (input *FrameStreamSockInput) SetLogger(logger Logger) {
 	input.log = logger
 }
 
+// SetFramePool configures the FrameStreamSockInput to take the buffers for
+// the frames it reads from pool.
+func (input *FrameStreamSockInput) SetFramePool(pool *FramePool) {
+	input.pool = pool
+}
+
+// SetStamp configures the FrameStreamSockInput to apply stamp to each
+// frame it reads, recording the connection the frame was read from in the
+// frame, as with StampIdentity or StampExtra.
+func (input *FrameStreamSockInput) SetStamp(stamp StampFunc) {
+	input.stamp = stamp
+}
+
+// SetBidirectional configures whether the FrameStreamSockInput uses the
+// bidirectional Frame Streams protocol, with a handshake and control
+// responses, as do most senders. If bidirectional is false, clients send
+// data without expecting responses, as some embedded senders do. The
+// default is bidirectional.
+func (input *FrameStreamSockInput) SetBidirectional(bidirectional bool) {
+	input.uni = !bidirectional
+}
+
+// SetMaxConnections limits the number of connections the
+// FrameStreamSockInput serves at once. Connections accepted beyond the
+// limit are closed immediately. A limit of zero, the default, allows any
+// number of connections.
+func (input *FrameStreamSockInput) SetMaxConnections(n int) {
+	input.maxConns = n
+}
+
+// SetMaxConnectionsPerSource limits the number of connections the
+// FrameStreamSockInput serves at once from each source: each remote IP
+// address for TCP/IP connections, and each user ID for unix domain socket
+// connections on Linux. Connections accepted beyond the limit are closed
+// immediately. A limit of zero, the default, allows any number of
+// connections.
+func (input *FrameStreamSockInput) SetMaxConnectionsPerSource(n int) {
+	input.maxPerSource = n
+}
+
+// SetIdleTimeout configures the FrameStreamSockInput to close connections
+// on which no data is received for the given duration after the initial
+// handshake. A timeout of zero, the default, leaves idle connections open.
+//
+// The timeout is effective only for connections accepted after the call to
+// SetIdleTimeout.
+func (input *FrameStreamSockInput) SetIdleTimeout(timeout time.Duration) {
+	input.idleTimeout = timeout
+}
+
+// SetMaxFrameRate limits the rate at which frames are read from each
+// connection to rate frames per second, with bursts of up to one second's
+// frames. Reading from a connection exceeding the rate is delayed, leaving
+// the sender to buffer or discard its data. A rate of zero, the default,
+// reads frames as fast as they are received.
+func (input *FrameStreamSockInput) SetMaxFrameRate(rate float64) {
+	input.maxRate = rate
+}
+
 // NewFrameStreamSockInputFromPath creates a unix domain socket at the
 // given socketPath and returns a FrameStreamSockInput collecting dnstap
 // data from clients connecting to this socket.
 //
 // If a socket or other file already exists at socketPath,
 // NewFrameStreamSockInputFromPath removes it before creating the socket.
+// ListenUnixSocket creates sockets with more control over the existing
+// file and the new socket's permissions.
 func NewFrameStreamSockInputFromPath(socketPath string) (input *FrameStreamSockInput, err error) {
-	os.Remove(socketPath)
-	listener, err := net.Listen("unix", socketPath)
+	listener, err := ListenUnixSocket(socketPath, &UnixSocketOptions{Force: true})
 	if err != nil {
 		return
 	}
@@ -76,6 +148,56 @@ func NewFrameStreamSockInputFromPath(socketPath string) (input *FrameStreamSockI
 //
 // ReadInto satisfies the dnstap Input interface.
 func (input *FrameStreamSockInput) ReadInto(output chan []byte) {
+	input.serve(func(i *FrameStreamInput, c *ConnInfo) {
+		if input.stamp == nil && input.maxRate <= 0 {
+			i.ReadInto(output)
+			return
+		}
+		rl := newRateLimiter(input.maxRate)
+		for b := range connFrames(i) {
+			rl.wait()
+			if input.stamp != nil {
+				b = input.stamp(b, c)
+			}
+			output <- b
+		}
+	})
+}
+
+// ReadSourcedInto accepts connections to the FrameStreamSockInput's
+// listening socket and sends all dnstap data read from these connections
+// to the output channel, with the ConnInfo of the connection each frame
+// was read from. ReadSourcedInto is an alternative to ReadInto for
+// collectors attributing data to its senders.
+func (input *FrameStreamSockInput) ReadSourcedInto(output chan SourcedFrame) {
+	input.serve(func(i *FrameStreamInput, c *ConnInfo) {
+		rl := newRateLimiter(input.maxRate)
+		for b := range connFrames(i) {
+			rl.wait()
+			if input.stamp != nil {
+				b = input.stamp(b, c)
+			}
+			output <- SourcedFrame{Frame: b, Conn: c}
+		}
+	})
+}
+
+// connFrames returns a channel carrying the frames read by i, which is
+// closed when i finishes.
+func connFrames(i *FrameStreamInput) chan []byte {
+	ch := make(chan []byte, outputChannelSize)
+	go func() {
+		i.ReadInto(ch)
+		close(ch)
+	}()
+	return ch
+}
+
+// serve accepts connections to the FrameStreamSockInput's listening
+// socket, calling read in a new goroutine for each with an input reading
+// the connection's data and the connection's ConnInfo. Connections
+// exceeding the connection limits are closed.
+func (input *FrameStreamSockInput) serve(read func(*FrameStreamInput, *ConnInfo)) {
 	var n uint64
 	for {
 		conn, err := input.listener.Accept()
@@ -86,25 +208,83 @@ func (input *FrameStreamSockInput) ReadInto(output chan []byte) {
 			continue
 		}
 		n++
+		c := newConnInfo(n, conn, time.Now())
 		origin := ""
 		switch conn.RemoteAddr().Network() {
 		case "tcp", "tcp4", "tcp6":
 			origin = fmt.Sprintf(" from %s", conn.RemoteAddr())
 		}
-		i, err := NewFrameStreamInputTimeout(conn, true, input.timeout)
-		if err != nil {
-			input.log.Printf("%s: connection %d: open input%s failed: %v",
-				conn.LocalAddr(), n, origin, err)
+		source := c.source()
+		if reason := input.admit(source); reason != "" {
+			input.log.Printf("%s: connection %d%s refused: %s",
+				conn.LocalAddr(), n, origin, reason)
+			conn.Close()
 			continue
 		}
-		input.log.Printf("%s: accepted connection %d%s",
-			conn.LocalAddr(), n, origin)
-		i.SetLogger(input.log)
-		go func(cn uint64) {
-			i.ReadInto(output)
+		// The handshake is read in the connection's goroutine, so
+		// that a slow client does not delay accepting others.
+		go func() {
+			defer input.release(source)
+			var rw net.Conn = conn
+			var ic *idleConn
+			if input.idleTimeout > 0 {
+				ic = &idleConn{Conn: conn}
+				rw = ic
+			}
+			i, err := NewFrameStreamInputTimeout(rw, !input.uni, input.timeout)
+			if err != nil {
+				input.log.Printf("%s: connection %d: open input%s failed: %v",
+					conn.LocalAddr(), c.ID, origin, err)
+				conn.Close()
+				return
+			}
+			if ic != nil {
+				ic.setTimeout(input.idleTimeout)
+			}
+			c.TLSPeer = tlsPeer(conn)
+			input.log.Printf("%s: accepted connection %d%s",
+				conn.LocalAddr(), c.ID, origin)
+			i.SetLogger(input.log)
+			i.SetFramePool(input.pool)
+			read(i, c)
+			conn.Close()
 			input.log.Printf("%s: closed connection %d%s",
-				conn.LocalAddr(), cn, origin)
-		}(n)
+				conn.LocalAddr(), c.ID, origin)
+		}()
+	}
+}
+
+// admit counts a new connection from source, returning the reason for
+// refusing it if it exceeds the connection limits.
+func (input *FrameStreamSockInput) admit(source string) string {
+	input.mu.Lock()
+	defer input.mu.Unlock()
+	if input.maxConns > 0 && input.active >= input.maxConns {
+		return fmt.Sprintf("limit of %d connections reached", input.maxConns)
+	}
+	if input.maxPerSource > 0 && source != "" {
+		if input.sources[source] >= input.maxPerSource {
+			return fmt.Sprintf("limit of %d connections from %s reached",
+				input.maxPerSource, source)
+		}
+		if input.sources == nil {
+			input.sources = make(map[string]int)
+		}
+		input.sources[source]++
+	}
+	input.active++
+	return ""
+}
+
+// release uncounts a connection from source admitted by admit.
+func (input *FrameStreamSockInput) release(source string) {
+	input.mu.Lock()
+	defer input.mu.Unlock()
+	input.active--
+	if input.maxPerSource > 0 && source != "" {
+		if input.sources[source]--; input.sources[source] == 0 {
+			delete(input.sources, source)
+		}
 	}
 }
 
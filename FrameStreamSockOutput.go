@@ -28,6 +28,7 @@ type FrameStreamSockOutput struct {
 	outputChannel chan []byte
 	wait          chan bool
 	wopt          SocketWriterOptions
+	pool          *FramePool
 }
 
 // NewFrameStreamSockOutput creates a FrameStreamSockOutput manaaging a
@@ -87,6 +88,12 @@ func (o *FrameStreamSockOutput) SetLogger(logger Logger) {
 	o.wopt.Logger = logger
 }
 
+// SetFramePool configures the FrameStreamSockOutput to return the buffers
+// of the frames it has sent to pool.
+func (o *FrameStreamSockOutput) SetFramePool(pool *FramePool) {
+	o.pool = pool
+}
+
 // GetOutputChannel returns the channel on which the
 // FrameStreamSockOutput accepts data.
 //
@@ -107,6 +114,7 @@ func (o *FrameStreamSockOutput) RunOutputLoop() {
 		// w is of type *SocketWriter, whose Write implementation
 		// handles all errors by retrying the connection.
 		w.WriteFrame(b)
+		o.pool.Put(b)
 	}
 
 	w.Close()
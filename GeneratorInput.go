@@ -0,0 +1,382 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// GeneratorOptions specifies the traffic produced by a GeneratorInput.
+type GeneratorOptions struct {
+	// Rate is the number of messages generated per second. If Rate is
+	// zero, messages are generated as fast as they are consumed.
+	Rate float64
+	// Count and Duration, if non-zero, limit the number of messages
+	// generated and the time spent generating them.
+	Count    uint64
+	Duration time.Duration
+	// Mix gives the relative frequency of each message type generated.
+	// The default is equal numbers of CLIENT_QUERY and CLIENT_RESPONSE
+	// messages.
+	Mix map[Message_Type]float64
+	// Names is the number of distinct query names, which are chosen
+	// with a Zipf distribution with exponent ZipfS (greater than 1).
+	// The defaults are 10000 names and an exponent of 1.1.
+	Names int
+	ZipfS float64
+	// Zone is the domain under which query names are generated. The
+	// default is "example.com.".
+	Zone string
+	// Clients are the networks from which query addresses are chosen
+	// at random. The default is 192.0.2.0/24 and 2001:db8::/64.
+	Clients []*net.IPNet
+	// MinResponseSize and MaxResponseSize give the range of sizes of
+	// generated response messages, which are padded with answer records
+	// to at least a size chosen uniformly from the range. If both are
+	// zero, responses carry a single answer record.
+	MinResponseSize, MaxResponseSize int
+	// Identity and Version are set in each generated message.
+	Identity, Version []byte
+	// Seed seeds the random choices of the generator. If Seed is zero,
+	// a seed is chosen from the current time.
+	Seed int64
+	// ReportInterval, if non-zero, is the interval at which the achieved
+	// throughput is logged. The totals are always logged on completion.
+	ReportInterval time.Duration
+	// Logger receives throughput reports.
+	Logger Logger
+}
+
+// GeneratorStats reports the traffic produced by a GeneratorInput.
+type GeneratorStats struct {
+	Messages, Bytes uint64
+	Elapsed         time.Duration
+}
+
+// Rate returns the achieved number of messages per second.
+func (s GeneratorStats) Rate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Messages) / s.Elapsed.Seconds()
+}
+
+func (s GeneratorStats) String() string {
+	return fmt.Sprintf("%d messages (%d bytes) in %v: %.0f messages/s",
+		s.Messages, s.Bytes, s.Elapsed.Round(time.Millisecond), s.Rate())
+}
+
+// A GeneratorInput is a dnstap Input producing synthetic Dnstap messages,
+// for load testing collectors and outputs without a DNS server.
+type GeneratorInput struct {
+	opt   GeneratorOptions
+	rng   *rand.Rand
+	zipf  *rand.Zipf
+	names []string
+	types []Message_Type
+	cum   []float64
+
+	start          int64 // time.UnixNano, accessed atomically
+	messages, size uint64
+	stop, wait     chan struct{}
+	stopOnce       sync.Once
+
+	// With a Rate, message n is due n/Rate seconds after the start
+	// time given by now, and newTimer waits for it.
+	now      func() time.Time
+	newTimer func(time.Duration) *time.Timer
+}
+
+var generatorServers = map[SocketFamily]net.IP{
+	SocketFamily_INET:  net.ParseIP("198.51.100.53").To4(),
+	SocketFamily_INET6: net.ParseIP("2001:db8:53::53"),
+}
+
+// NewGeneratorInput creates a GeneratorInput producing messages as
+// specified by opt.
+func NewGeneratorInput(opt *GeneratorOptions) (*GeneratorInput, error) {
+	g := &GeneratorInput{
+		stop:     make(chan struct{}),
+		wait:     make(chan struct{}),
+		now:      time.Now,
+		newTimer: time.NewTimer,
+	}
+	if opt != nil {
+		g.opt = *opt
+	}
+	if g.opt.Names == 0 {
+		g.opt.Names = 10000
+	}
+	if g.opt.Names < 1 {
+		return nil, fmt.Errorf("invalid number of names %d", g.opt.Names)
+	}
+	if g.opt.ZipfS == 0 {
+		g.opt.ZipfS = 1.1
+	}
+	if g.opt.ZipfS <= 1 {
+		return nil, fmt.Errorf("Zipf exponent %v is not greater than 1", g.opt.ZipfS)
+	}
+	if g.opt.Zone == "" {
+		g.opt.Zone = "example.com."
+	}
+	g.opt.Zone = dns.Fqdn(g.opt.Zone)
+	if len(g.opt.Clients) == 0 {
+		for _, s := range []string{"192.0.2.0/24", "2001:db8::/64"} {
+			_, n, _ := net.ParseCIDR(s)
+			g.opt.Clients = append(g.opt.Clients, n)
+		}
+	}
+	if g.opt.MaxResponseSize < g.opt.MinResponseSize {
+		g.opt.MaxResponseSize = g.opt.MinResponseSize
+	}
+	if g.opt.MaxResponseSize > dns.MaxMsgSize {
+		return nil, fmt.Errorf("response size %d exceeds maximum DNS message size", g.opt.MaxResponseSize)
+	}
+	if g.opt.Seed == 0 {
+		g.opt.Seed = time.Now().UnixNano()
+	}
+	if g.opt.Logger == nil {
+		g.opt.Logger = nullLogger{}
+	}
+
+	mix := g.opt.Mix
+	if len(mix) == 0 {
+		mix = map[Message_Type]float64{
+			Message_CLIENT_QUERY:    1,
+			Message_CLIENT_RESPONSE: 1,
+		}
+	}
+	for t := range mix {
+		g.types = append(g.types, t)
+	}
+	sort.Slice(g.types, func(i, j int) bool { return g.types[i] < g.types[j] })
+	var total float64
+	for _, t := range g.types {
+		if _, ok := Message_Type_name[int32(t)]; !ok || mix[t] < 0 {
+			return nil, fmt.Errorf("invalid message type mix entry %v=%v", t, mix[t])
+		}
+		total += mix[t]
+		g.cum = append(g.cum, total)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("message type mix has no positive weights")
+	}
+
+	g.rng = rand.New(rand.NewSource(g.opt.Seed))
+	g.zipf = rand.NewZipf(g.rng, g.opt.ZipfS, 1, uint64(g.opt.Names-1))
+	g.names = make([]string, g.opt.Names)
+	for i := range g.names {
+		g.names[i] = fmt.Sprintf("host%d.%s", i, g.opt.Zone)
+	}
+	return g, nil
+}
+
+// Stop ends message generation, causing ReadInto to return.
+func (g *GeneratorInput) Stop() {
+	g.stopOnce.Do(func() { close(g.stop) })
+}
+
+// Stats returns the traffic generated so far.
+func (g *GeneratorInput) Stats() GeneratorStats {
+	s := GeneratorStats{
+		Messages: atomic.LoadUint64(&g.messages),
+		Bytes:    atomic.LoadUint64(&g.size),
+	}
+	if start := atomic.LoadInt64(&g.start); start != 0 {
+		s.Elapsed = time.Since(time.Unix(0, start))
+	}
+	return s
+}
+
+// ReadInto sends generated messages on the output channel until Stop is
+// called or the configured Count or Duration is reached.
+//
+// ReadInto satisfies the dnstap Input interface.
+func (g *GeneratorInput) ReadInto(output chan []byte) {
+	defer close(g.wait)
+
+	start := g.now()
+	atomic.StoreInt64(&g.start, start.UnixNano())
+	var end <-chan time.Time
+	if g.opt.Duration > 0 {
+		t := time.NewTimer(g.opt.Duration)
+		defer t.Stop()
+		end = t.C
+	}
+	var report <-chan time.Time
+	if g.opt.ReportInterval > 0 {
+		t := time.NewTicker(g.opt.ReportInterval)
+		defer t.Stop()
+		report = t.C
+	}
+
+	var last GeneratorStats
+loop:
+	for n := uint64(0); g.opt.Count == 0 || n < g.opt.Count; n++ {
+		if g.opt.Rate > 0 {
+			due := start.Add(time.Duration(float64(n) / g.opt.Rate * float64(time.Second)))
+			if d := due.Sub(g.now()); d > 0 {
+				t := g.newTimer(d)
+				select {
+				case <-t.C:
+				case <-g.stop:
+					t.Stop()
+					break loop
+				case <-end:
+					t.Stop()
+					break loop
+				}
+			}
+		}
+
+		b, err := proto.Marshal(g.next())
+		if err != nil {
+			g.opt.Logger.Printf("GeneratorInput: proto.Marshal() failed: %s", err)
+			break
+		}
+		select {
+		case output <- b:
+		case <-g.stop:
+			break loop
+		case <-end:
+			break loop
+		}
+		atomic.AddUint64(&g.messages, 1)
+		atomic.AddUint64(&g.size, uint64(len(b)))
+
+		select {
+		case <-report:
+			s := g.Stats()
+			interval := GeneratorStats{
+				Messages: s.Messages - last.Messages,
+				Bytes:    s.Bytes - last.Bytes,
+				Elapsed:  s.Elapsed - last.Elapsed,
+			}
+			g.opt.Logger.Printf("GeneratorInput: %s", interval)
+			last = s
+		default:
+		}
+	}
+	g.opt.Logger.Printf("GeneratorInput: generated %s", g.Stats())
+}
+
+// Wait returns when ReadInto has finished.
+//
+// Wait satisfies the dnstap Input interface.
+func (g *GeneratorInput) Wait() {
+	<-g.wait
+}
+
+// next returns a new message of a type chosen from the configured mix.
+func (g *GeneratorInput) next() *Dnstap {
+	mt := g.types[sort.SearchFloat64s(g.cum, g.rng.Float64()*g.cum[len(g.cum)-1])]
+
+	client := g.opt.Clients[g.rng.Intn(len(g.opt.Clients))]
+	qaddr := make(net.IP, len(client.IP))
+	for i := range qaddr {
+		qaddr[i] = client.IP[i] | byte(g.rng.Intn(256))&^client.Mask[i]
+	}
+	family := SocketFamily_INET6
+	if len(qaddr) == net.IPv4len {
+		family = SocketFamily_INET
+	}
+	protocol := SocketProtocol_UDP
+	if g.rng.Intn(10) == 0 {
+		protocol = SocketProtocol_TCP
+	}
+
+	qtype := dns.TypeA
+	if g.rng.Intn(3) == 0 {
+		qtype = dns.TypeAAAA
+	}
+	query := new(dns.Msg)
+	query.SetQuestion(g.names[g.zipf.Uint64()], qtype)
+	query.Id = uint16(g.rng.Intn(1 << 16))
+	query.RecursionDesired = true
+
+	now := time.Now()
+	m := &Message{
+		Type:            mt.Enum(),
+		SocketFamily:    family.Enum(),
+		SocketProtocol:  protocol.Enum(),
+		QueryAddress:    qaddr,
+		QueryPort:       proto.Uint32(uint32(1024 + g.rng.Intn(65536-1024))),
+		ResponseAddress: generatorServers[family],
+		ResponsePort:    proto.Uint32(53),
+	}
+	wire, _ := query.Pack()
+	if isQueryType(mt) {
+		m.QueryTimeSec = proto.Uint64(uint64(now.Unix()))
+		m.QueryTimeNsec = proto.Uint32(uint32(now.Nanosecond()))
+		m.QueryMessage = wire
+	} else {
+		qt := now.Add(-time.Duration(g.rng.Intn(50000)) * time.Microsecond)
+		m.QueryTimeSec = proto.Uint64(uint64(qt.Unix()))
+		m.QueryTimeNsec = proto.Uint32(uint32(qt.Nanosecond()))
+		m.ResponseTimeSec = proto.Uint64(uint64(now.Unix()))
+		m.ResponseTimeNsec = proto.Uint32(uint32(now.Nanosecond()))
+		m.QueryMessage = wire
+		m.ResponseMessage = g.response(query)
+	}
+
+	return &Dnstap{
+		Type:     Dnstap_MESSAGE.Enum(),
+		Identity: g.opt.Identity,
+		Version:  g.opt.Version,
+		Message:  m,
+	}
+}
+
+// response returns a packed response to query, padded with answer
+// records to at least a size within the configured range.
+func (g *GeneratorInput) response(query *dns.Msg) []byte {
+	size := g.opt.MinResponseSize
+	if n := g.opt.MaxResponseSize - g.opt.MinResponseSize; n > 0 {
+		size += g.rng.Intn(n + 1)
+	}
+
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.RecursionAvailable = true
+	q := query.Question[0]
+	for len(resp.Answer) == 0 || resp.Len() < size {
+		hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 300}
+		var rr dns.RR
+		if q.Qtype == dns.TypeAAAA {
+			ip := make(net.IP, net.IPv6len)
+			copy(ip, net.ParseIP("2001:db8::"))
+			g.rng.Read(ip[8:])
+			rr = &dns.AAAA{Hdr: hdr, AAAA: ip}
+		} else {
+			ip := net.IP{203, 0, 113, 0}
+			ip[3] = byte(g.rng.Intn(256))
+			rr = &dns.A{Hdr: hdr, A: ip}
+		}
+		resp.Answer = append(resp.Answer, rr)
+	}
+	wire, _ := resp.Pack()
+	return wire
+}
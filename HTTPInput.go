@@ -0,0 +1,330 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	framestream "github.com/farsightsec/golang-framestream"
+	"google.golang.org/protobuf/proto"
+)
+
+// The content types of the request bodies accepted by an HTTPInput.
+const (
+	// HTTPContentTypeFrameStream is a unidirectional Frame Streams
+	// stream, as written to a file.
+	HTTPContentTypeFrameStream = "application/vnd.dnstap.fstrm"
+	// HTTPContentTypeBatch is a sequence of dnstap protobuf messages,
+	// each preceded by its length as a 32-bit big-endian integer.
+	HTTPContentTypeBatch = "application/vnd.dnstap.batch"
+	// HTTPContentTypeJSON is a sequence of dnstap messages in the JSON
+	// form rendered by JSONFormat, one per line. The content types
+	// "application/jsonl" and "application/json" are also accepted.
+	HTTPContentTypeJSON = "application/x-ndjson"
+)
+
+// maxJSONLine limits the length of the lines of JSON request bodies. The
+// text form of a DNS message is several times the size of its wire form.
+const maxJSONLine = 1 << 20
+
+// An HTTPInput collects dnstap data POSTed to an HTTP server, for senders
+// which can make only outbound HTTP requests. The data is read from the
+// request body in the format given by its Content-Type, one of
+// HTTPContentTypeFrameStream, HTTPContentTypeBatch, or
+// HTTPContentTypeJSON, and may be compressed with gzip, as given by its
+// Content-Encoding.
+//
+// The server responds with status 204 (No Content) when the request body
+// has been read in full. Data read before an error in the body is not
+// discarded.
+type HTTPInput struct {
+	listener net.Listener
+	server   *http.Server
+	token    string
+	log      Logger
+	pool     *FramePool
+
+	output   chan []byte
+	ready    chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	wait     chan bool
+}
+
+// NewHTTPInput creates an HTTPInput serving HTTP requests on the given
+// listener. For HTTPS, the listener is created with tls.Listen or
+// tls.NewListener.
+//
+// If listener is nil, the HTTPInput serves no requests itself, but is used
+// as the http.Handler of another server, such as one also serving other
+// handlers, or an httptest.Server.
+func NewHTTPInput(listener net.Listener) *HTTPInput {
+	input := &HTTPInput{
+		listener: listener,
+		log:      nullLogger{},
+		ready:    make(chan struct{}),
+		stop:     make(chan struct{}),
+		wait:     make(chan bool),
+	}
+	input.server = &http.Server{Handler: input}
+	return input
+}
+
+// SetLogger configures a logger for the HTTPInput.
+func (input *HTTPInput) SetLogger(logger Logger) {
+	input.log = logger
+}
+
+// SetFramePool configures the HTTPInput to take the buffers for the
+// frames it reads from pool.
+func (input *HTTPInput) SetFramePool(pool *FramePool) {
+	input.pool = pool
+}
+
+// SetBearerToken configures the HTTPInput to accept only requests
+// authorized with the given bearer token, in an "Authorization: Bearer"
+// header. Other requests are refused with status 401 (Unauthorized). An
+// empty token, the default, accepts all requests.
+func (input *HTTPInput) SetBearerToken(token string) {
+	input.token = token
+}
+
+// SetTimeout sets the time allowed to read the headers of each request,
+// and to wait for the next request on an idle connection. The request
+// bodies, which may be streamed, are read without a timeout. A timeout of
+// zero, the default, allows any time.
+func (input *HTTPInput) SetTimeout(timeout time.Duration) {
+	input.server.ReadHeaderTimeout = timeout
+	input.server.IdleTimeout = timeout
+}
+
+// ReadInto serves HTTP requests on the HTTPInput's listener, sending the
+// dnstap data they carry to the output channel, until the listener is
+// closed or Stop is called.
+//
+// ReadInto satisfies the dnstap Input interface.
+func (input *HTTPInput) ReadInto(output chan []byte) {
+	defer close(input.wait)
+	input.output = output
+	close(input.ready)
+	if input.listener == nil {
+		<-input.stop
+		return
+	}
+	err := input.server.Serve(input.listener)
+	if err != http.ErrServerClosed && !errors.Is(err, net.ErrClosed) {
+		input.log.Printf("%s: HTTP server failed: %v", input.name(), err)
+	}
+}
+
+// Stop stops the HTTPInput accepting requests, and causes ReadInto to
+// return once the requests in progress have been read.
+func (input *HTTPInput) Stop() {
+	input.stopOnce.Do(func() { close(input.stop) })
+	input.server.Shutdown(context.Background())
+}
+
+// name identifies the HTTPInput in log messages.
+func (input *HTTPInput) name() string {
+	if input.listener == nil {
+		return "HTTPInput"
+	}
+	return input.listener.Addr().String()
+}
+
+// Wait returns when ReadInto has finished.
+//
+// Wait satisfies the dnstap Input interface.
+func (input *HTTPInput) Wait() {
+	<-input.wait
+}
+
+// ServeHTTP reads the dnstap data in a request, as served by ReadInto.
+// Requests wait until ReadInto is called.
+func (input *HTTPInput) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if !input.authorized(r) {
+		input.log.Printf("%s: refused unauthorized request from %s",
+			input.name(), r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="dnstap"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var read func(io.Reader, func([]byte)) error
+	switch {
+	case err != nil:
+	case mediaType == HTTPContentTypeFrameStream:
+		read = readFrameStreamBody
+	case mediaType == HTTPContentTypeBatch:
+		read = readBatchBody
+	case mediaType == HTTPContentTypeJSON, mediaType == "application/jsonl",
+		mediaType == "application/json":
+		read = readJSONBody
+	}
+	if read == nil {
+		http.Error(w, fmt.Sprintf("unsupported content type %q", r.Header.Get("Content-Type")),
+			http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var body io.Reader = r.Body
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("gzip: %v", err), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	default:
+		http.Error(w, fmt.Sprintf("unsupported content encoding %q", r.Header.Get("Content-Encoding")),
+			http.StatusUnsupportedMediaType)
+		return
+	}
+
+	select {
+	case <-input.ready:
+	case <-r.Context().Done():
+		return
+	}
+	n := 0
+	err = read(body, func(frame []byte) {
+		input.output <- input.pool.Copy(frame)
+		n++
+	})
+	if err != nil {
+		input.log.Printf("%s: request from %s: %d frames read before error: %v",
+			input.name(), r.RemoteAddr, n, err)
+		status := http.StatusBadRequest
+		if err == errFrameTooLarge {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, fmt.Sprintf("%d frames read before error: %v", n, err), status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorized reports whether the request r carries the HTTPInput's bearer
+// token, if it has one.
+func (input *HTTPInput) authorized(r *http.Request) bool {
+	if input.token == "" {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(input.token)) == 1
+}
+
+var errFrameTooLarge = fmt.Errorf("frame larger than %d bytes", MaxPayloadSize)
+
+// The read functions read the frames of a request body in each format,
+// calling send with each frame. The frame is valid only until send
+// returns.
+
+func readFrameStreamBody(body io.Reader, send func([]byte)) error {
+	r, err := NewReader(body, nil)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, MaxPayloadSize)
+	for {
+		n, err := r.ReadFrame(buf)
+		switch err {
+		case nil:
+			send(buf[:n])
+		case io.EOF:
+			return nil
+		case framestream.ErrDataFrameTooLarge:
+			return errFrameTooLarge
+		default:
+			return err
+		}
+	}
+}
+
+func readBatchBody(body io.Reader, send func([]byte)) error {
+	br := bufio.NewReader(body)
+	buf := make([]byte, MaxPayloadSize)
+	var hdr [4]byte
+	for {
+		if _, err := io.ReadFull(br, hdr[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		n := binary.BigEndian.Uint32(hdr[:])
+		if n > MaxPayloadSize {
+			return errFrameTooLarge
+		}
+		frame := buf[:n]
+		if _, err := io.ReadFull(br, frame); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		send(frame)
+	}
+}
+
+func readJSONBody(body io.Reader, send func([]byte)) error {
+	s := bufio.NewScanner(body)
+	s.Buffer(nil, maxJSONLine)
+	var frame []byte
+	line := 0
+	for s.Scan() {
+		line++
+		if len(strings.TrimSpace(s.Text())) == 0 {
+			continue
+		}
+		dt, err := ParseJSONFormat(s.Bytes())
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		frame, err = proto.MarshalOptions{}.MarshalAppend(frame[:0], dt)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		send(frame)
+	}
+	return s.Err()
+}
@@ -0,0 +1,357 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// An HTTPOutputFormat is the format of the batches of messages POSTed by
+// an HTTPOutput.
+type HTTPOutputFormat int
+
+const (
+	// HTTPOutputJSON posts the messages in the JSON form rendered by
+	// JSONFormat, one per line, with content type HTTPContentTypeJSON.
+	HTTPOutputJSON HTTPOutputFormat = iota
+	// HTTPOutputBulk posts the messages in JSON form as index actions
+	// for the Elasticsearch bulk API, with content type
+	// HTTPContentTypeJSON.
+	HTTPOutputBulk
+	// HTTPOutputBatch posts the dnstap protobuf messages, each preceded
+	// by its length, with content type HTTPContentTypeBatch, as accepted
+	// by HTTPInput.
+	HTTPOutputBatch
+)
+
+// HTTPOutputOptions specifies configuration for an HTTPOutput.
+type HTTPOutputOptions struct {
+	// Format is the format of the batches posted.
+	Format HTTPOutputFormat
+	// Index, if set, is the Elasticsearch index named in the actions of
+	// the HTTPOutputBulk format. Otherwise, the index is given by the
+	// URL, as in "http://localhost:9200/dnstap/_bulk".
+	Index string
+	// BatchSize is the largest number of messages posted in a request.
+	// The default is 1000.
+	BatchSize int
+	// BatchBytes is the size in bytes, before compression, at which a
+	// batch is posted without waiting for more messages. The default is
+	// 5 MiB.
+	BatchBytes int
+	// FlushInterval is the interval at which a partial batch is posted.
+	// The default is five seconds.
+	FlushInterval time.Duration
+	// Gzip compresses the requests with gzip.
+	Gzip bool
+	// Header holds additional headers sent with each request, such as
+	// Authorization. Basic authentication credentials may also be given
+	// in the URL.
+	Header http.Header
+	// BearerToken, if set, is sent in an "Authorization: Bearer" header.
+	BearerToken string
+	// Timeout is the time allowed for each request. The default is 30
+	// seconds.
+	Timeout time.Duration
+	// MaxRetries is the number of times a request failing with a
+	// network error, status 429 (Too Many Requests), or a 5xx status is
+	// retried before the batch is discarded. Requests failing with
+	// other statuses are not retried.
+	MaxRetries int
+	// RetryInterval is the delay before the first retry of a request,
+	// doubled for each further retry up to MaxRetryInterval. The
+	// defaults are one second and one minute.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	// Client, if set, is used to send the requests, for example with
+	// a custom TLS configuration. Its Timeout overrides the Timeout
+	// option.
+	Client *http.Client
+	// Logger receives request failures.
+	Logger Logger
+}
+
+// An HTTPOutput is a dnstap Output posting batches of the messages it
+// receives to an HTTP endpoint, such as a webhook or the bulk API of a log
+// platform. Batches are posted when full, and at the flush interval.
+//
+// A batch is posted only once the previous batch has been posted or
+// discarded, so an endpoint which is slow or failing holds up the messages
+// sent to the HTTPOutput.
+type HTTPOutput struct {
+	url           string
+	opt           HTTPOutputOptions
+	client        *http.Client
+	outputChannel chan []byte
+	wait          chan bool
+	pool          *FramePool
+
+	buf   []byte // a message being formatted
+	body  bytes.Buffer
+	count int
+	zbody bytes.Buffer
+	zw    *gzip.Writer
+}
+
+// NewHTTPOutput creates an HTTPOutput posting batches of messages to the
+// HTTP or HTTPS URL rawurl, with the given options.
+func NewHTTPOutput(rawurl string, opt *HTTPOutputOptions) (*HTTPOutput, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%s: not an http or https URL", rawurl)
+	}
+	o := &HTTPOutput{
+		url:           rawurl,
+		outputChannel: make(chan []byte, outputChannelSize),
+		wait:          make(chan bool),
+	}
+	if opt != nil {
+		o.opt = *opt
+	}
+	if o.opt.BatchSize <= 0 {
+		o.opt.BatchSize = 1000
+	}
+	if o.opt.BatchBytes <= 0 {
+		o.opt.BatchBytes = 5 << 20
+	}
+	if o.opt.FlushInterval <= 0 {
+		o.opt.FlushInterval = 5 * time.Second
+	}
+	if o.opt.Timeout <= 0 {
+		o.opt.Timeout = 30 * time.Second
+	}
+	if o.opt.RetryInterval <= 0 {
+		o.opt.RetryInterval = time.Second
+	}
+	if o.opt.MaxRetryInterval <= 0 {
+		o.opt.MaxRetryInterval = time.Minute
+	}
+	if o.opt.Logger == nil {
+		o.opt.Logger = nullLogger{}
+	}
+	o.client = o.opt.Client
+	if o.client == nil {
+		o.client = &http.Client{Timeout: o.opt.Timeout}
+	}
+	if o.opt.Gzip {
+		o.zw = gzip.NewWriter(&o.zbody)
+	}
+	return o, nil
+}
+
+// SetFramePool configures the HTTPOutput to return the buffers of the
+// frames it has batched to pool.
+func (o *HTTPOutput) SetFramePool(pool *FramePool) {
+	o.pool = pool
+}
+
+// GetOutputChannel returns the channel on which the HTTPOutput accepts
+// dnstap data.
+//
+// GetOutputChannel satisfies the dnstap Output interface.
+func (o *HTTPOutput) GetOutputChannel() chan []byte {
+	return o.outputChannel
+}
+
+// RunOutputLoop batches the data received on the output channel and posts
+// the batches, returning after Close is called and the last batch has
+// been posted.
+//
+// RunOutputLoop satisfies the dnstap Output interface.
+func (o *HTTPOutput) RunOutputLoop() {
+	t := time.NewTicker(o.opt.FlushInterval)
+	defer t.Stop()
+	dt := &Dnstap{}
+	for {
+		select {
+		case frame, ok := <-o.outputChannel:
+			if !ok {
+				o.post()
+				close(o.wait)
+				return
+			}
+			o.add(frame, dt)
+			o.pool.Put(frame)
+			if o.count >= o.opt.BatchSize || o.body.Len() >= o.opt.BatchBytes {
+				o.post()
+			}
+		case <-t.C:
+			o.post()
+		}
+	}
+}
+
+// Close closes the HTTPOutput's output channel and returns after all
+// pending data has been posted or discarded.
+//
+// Close satisfies the dnstap Output interface.
+func (o *HTTPOutput) Close() {
+	close(o.outputChannel)
+	<-o.wait
+}
+
+// add appends frame to the batch in the HTTPOutput's format.
+func (o *HTTPOutput) add(frame []byte, dt *Dnstap) {
+	if o.opt.Format == HTTPOutputBatch {
+		var hdr [4]byte
+		binary.BigEndian.PutUint32(hdr[:], uint32(len(frame)))
+		o.body.Write(hdr[:])
+		o.body.Write(frame)
+		o.count++
+		return
+	}
+	if err := proto.Unmarshal(frame, dt); err != nil {
+		o.opt.Logger.Printf("HTTPOutput: proto.Unmarshal() failed: %s", err)
+		return
+	}
+	b := o.buf[:0]
+	if o.opt.Format == HTTPOutputBulk {
+		b = append(b, `{"index":{`...)
+		if o.opt.Index != "" {
+			b = append(b, `"_index":`...)
+			b = appendJSONString(b, o.opt.Index)
+		}
+		b = append(b, "}}\n"...)
+	}
+	b, ok := AppendJSONFormat(b, dt)
+	if !ok {
+		o.opt.Logger.Printf("HTTPOutput: JSON format failed")
+		return
+	}
+	o.buf = b
+	o.body.Write(b)
+	o.count++
+}
+
+// post posts the batch, retrying failed requests, and starts a new batch.
+func (o *HTTPOutput) post() {
+	if o.count == 0 {
+		return
+	}
+	body := o.body.Bytes()
+	if o.zw != nil {
+		o.zbody.Reset()
+		o.zw.Reset(&o.zbody)
+		o.zw.Write(body)
+		o.zw.Close()
+		body = o.zbody.Bytes()
+	}
+
+	delay := o.opt.RetryInterval
+	for attempt := 0; ; attempt++ {
+		retry, err := o.send(body)
+		if err == nil {
+			break
+		}
+		if !retry || attempt >= o.opt.MaxRetries {
+			o.opt.Logger.Printf("HTTPOutput: %s: discarding %d messages: %v", o.url, o.count, err)
+			break
+		}
+		o.opt.Logger.Printf("HTTPOutput: %s: %v; retrying in %v", o.url, err, delay)
+		time.Sleep(delay)
+		if delay *= 2; delay > o.opt.MaxRetryInterval {
+			delay = o.opt.MaxRetryInterval
+		}
+	}
+	o.body.Reset()
+	o.count = 0
+}
+
+// send posts body, returning an error if the request fails, and whether
+// it should be retried.
+func (o *HTTPOutput) send(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range o.opt.Header {
+		req.Header[k] = v
+	}
+	switch o.opt.Format {
+	case HTTPOutputBatch:
+		req.Header.Set("Content-Type", HTTPContentTypeBatch)
+	default:
+		req.Header.Set("Content-Type", HTTPContentTypeJSON)
+	}
+	if o.zw != nil {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if o.opt.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+o.opt.BearerToken)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+		return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+	}
+	if o.opt.Format == HTTPOutputBulk {
+		o.checkBulkResponse(resp.Body)
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return false, nil
+}
+
+// checkBulkResponse logs the failed items of an Elasticsearch bulk API
+// response, which has a successful status even if some items failed.
+// Failed items are not retried, as most failures, such as mapping
+// errors, would recur.
+func (o *HTTPOutput) checkBulkResponse(r io.Reader) {
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(r).Decode(&resp); err != nil || !resp.Errors {
+		return
+	}
+	failed := 0
+	var first json.RawMessage
+	for _, item := range resp.Items {
+		for _, result := range item {
+			if result.Status > 299 {
+				if failed == 0 {
+					first = result.Error
+				}
+				failed++
+			}
+		}
+	}
+	o.opt.Logger.Printf("HTTPOutput: %s: %d of %d messages failed, first error: %s",
+		o.url, failed, len(resp.Items), first)
+}
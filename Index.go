@@ -0,0 +1,448 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	framestream "github.com/farsightsec/golang-framestream"
+)
+
+// DefaultIndexInterval is the number of data frames between index entries
+// used when no interval is specified.
+const DefaultIndexInterval = 1000
+
+const indexMagic = "dnstap-index"
+
+// ErrBadIndex is returned when reading a malformed index, or one whose
+// recorded file size does not match its Frame Streams file, as when the
+// file has been rewritten since the index was built.
+var ErrBadIndex = errors.New("malformed or stale dnstap index")
+
+// An IndexEntry records the position of a data frame within a Frame
+// Streams file.
+type IndexEntry struct {
+	// Frame is the number of the data frame, counting from zero.
+	Frame uint64
+	// Offset is the byte offset of the frame within the file.
+	Offset int64
+	// Time is the first message time found in the frame or the frames
+	// following it up to the next entry, or the zero time if none had
+	// a time.
+	Time time.Time
+}
+
+// An Index records the position of every Interval-th data frame of a
+// Frame Streams file, allowing an IndexedReader to seek within the file
+// without reading it from the start.
+type Index struct {
+	Interval uint64
+	// Size is the length of the Frame Streams file the index describes,
+	// or zero if unknown, as for indexes written by earlier versions.
+	Size    int64
+	Entries []IndexEntry
+}
+
+// IndexFilename returns the name of the sidecar index file for the Frame
+// Streams file fname.
+func IndexFilename(fname string) string {
+	return fname + ".idx"
+}
+
+// WriteTo writes the index in text form to w.
+func (ix *Index) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var n int64
+	c, err := fmt.Fprintf(bw, "%s 2 %d %d\n", indexMagic, ix.Interval, ix.Size)
+	n += int64(c)
+	for _, e := range ix.Entries {
+		if err != nil {
+			return n, err
+		}
+		var t int64
+		if !e.Time.IsZero() {
+			t = e.Time.UnixNano()
+		}
+		c, err = fmt.Fprintf(bw, "%d %d %d\n", e.Frame, e.Offset, t)
+		n += int64(c)
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// WriteFile writes the index to the named file.
+func (ix *Index) WriteFile(fname string) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	if _, err = ix.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadIndex reads an index written by Index.WriteTo from r.
+func ReadIndex(r io.Reader) (*Index, error) {
+	s := bufio.NewScanner(r)
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrBadIndex
+	}
+
+	// The header is the magic string, the version, the interval, and
+	// from version 2, the file size.
+	ix := &Index{}
+	hdr := strings.Fields(s.Text())
+	if len(hdr) < 3 || hdr[0] != indexMagic ||
+		!(hdr[1] == "1" && len(hdr) == 3 || hdr[1] == "2" && len(hdr) == 4) {
+		return nil, ErrBadIndex
+	}
+	var err error
+	if ix.Interval, err = strconv.ParseUint(hdr[2], 10, 64); err != nil {
+		return nil, ErrBadIndex
+	}
+	if len(hdr) == 4 {
+		if ix.Size, err = strconv.ParseInt(hdr[3], 10, 64); err != nil {
+			return nil, ErrBadIndex
+		}
+	}
+
+	for s.Scan() {
+		var e IndexEntry
+		var t int64
+		if _, err := fmt.Sscanf(s.Text(), "%d %d %d", &e.Frame, &e.Offset, &t); err != nil {
+			return nil, ErrBadIndex
+		}
+		if t != 0 {
+			e.Time = time.Unix(0, t)
+		}
+		ix.Entries = append(ix.Entries, e)
+	}
+	return ix, s.Err()
+}
+
+// ReadIndexFile reads the index from the named file.
+func ReadIndexFile(fname string) (*Index, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadIndex(f)
+}
+
+// frameStreamHeader returns the start control frame beginning every
+// unidirectional dnstap Frame Streams file.
+func frameStreamHeader() []byte {
+	var buf bytes.Buffer
+	start := framestream.ControlStart
+	start.SetContentType(FSContentType)
+	start.Encode(&buf)
+	return buf.Bytes()
+}
+
+// controlFrameLen returns the encoded length of the control frame cf,
+// including its escape sequence.
+func controlFrameLen(cf *framestream.ControlFrame) int64 {
+	n := int64(12)
+	for _, ct := range cf.ContentTypes {
+		n += 8 + int64(len(ct))
+	}
+	return n
+}
+
+// An indexBuilder accumulates an Index from the sequence of data frames
+// written to or read from a Frame Streams file.
+type indexBuilder struct {
+	ix       Index
+	frame    uint64
+	offset   int64
+	needTime bool
+}
+
+func newIndexBuilder(interval uint64, offset int64) *indexBuilder {
+	if interval == 0 {
+		interval = DefaultIndexInterval
+	}
+	return &indexBuilder{
+		ix:     Index{Interval: interval},
+		offset: offset,
+	}
+}
+
+// add records a data frame, which begins at the builder's current offset.
+func (b *indexBuilder) add(frame []byte) {
+	if b.frame%b.ix.Interval == 0 {
+		b.ix.Entries = append(b.ix.Entries, IndexEntry{
+			Frame:  b.frame,
+			Offset: b.offset,
+		})
+		b.needTime = true
+	}
+	if b.needTime {
+		if t, ok := frameTime(frame); ok {
+			b.ix.Entries[len(b.ix.Entries)-1].Time = t
+			b.needTime = false
+		}
+	}
+	b.frame++
+	b.offset += 4 + int64(len(frame))
+}
+
+// finish returns the index of a file ending with a stop control frame
+// after the last data frame added.
+func (b *indexBuilder) finish() *Index {
+	b.ix.Size = b.offset + controlFrameLen(&framestream.ControlStop)
+	return &b.ix
+}
+
+// BuildIndex reads the unidirectional Frame Streams data from r and
+// returns an index with an entry for every interval-th data frame. If
+// interval is zero, DefaultIndexInterval is used.
+func BuildIndex(r io.Reader, interval uint64) (*Index, error) {
+	br := bufio.NewReader(r)
+	var cf framestream.ControlFrame
+	if err := cf.DecodeTypeEscape(br, framestream.CONTROL_START); err != nil {
+		return nil, err
+	}
+	if !cf.MatchContentType(FSContentType) {
+		return nil, framestream.ErrContentTypeMismatch
+	}
+
+	b := newIndexBuilder(interval, controlFrameLen(&cf))
+	buf := make([]byte, MaxPayloadSize)
+	for {
+		var n uint32
+		if err := binary.Read(br, binary.BigEndian, &n); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if n == 0 {
+			cf = framestream.ControlFrame{}
+			if err := cf.Decode(br); err != nil {
+				return nil, err
+			}
+			b.offset += controlFrameLen(&cf)
+			if cf.ControlType == framestream.CONTROL_STOP {
+				break
+			}
+			continue
+		}
+		frame := buf
+		if n > uint32(len(buf)) {
+			frame = make([]byte, n)
+		}
+		if _, err := io.ReadFull(br, frame[:n]); err != nil {
+			return nil, err
+		}
+		b.add(frame[:n])
+	}
+	b.ix.Size = b.offset
+	return &b.ix, nil
+}
+
+// An IndexedReader is a Reader over a unidirectional Frame Streams file
+// which can seek to a given data frame or message time, using an Index
+// to avoid reading the file from the start.
+type IndexedReader struct {
+	rs        io.ReadSeeker
+	ix        *Index
+	dataStart int64
+	r         Reader
+	pending   []byte
+}
+
+// NewIndexedReader creates an IndexedReader reading from rs and seeking
+// with the help of the index ix. If ix is nil, seeks read rs from the
+// start of its data. If the size of rs does not match the Size of ix,
+// NewIndexedReader returns ErrBadIndex.
+func NewIndexedReader(rs io.ReadSeeker, ix *Index) (*IndexedReader, error) {
+	if ix != nil && ix.Size > 0 {
+		size, err := rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		if size != ix.Size {
+			return nil, ErrBadIndex
+		}
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	var cf framestream.ControlFrame
+	if err := cf.DecodeTypeEscape(rs, framestream.CONTROL_START); err != nil {
+		return nil, err
+	}
+	if !cf.MatchContentType(FSContentType) {
+		return nil, framestream.ErrContentTypeMismatch
+	}
+	if ix == nil {
+		ix = &Index{Interval: DefaultIndexInterval}
+	}
+	r := &IndexedReader{rs: rs, ix: ix, dataStart: controlFrameLen(&cf)}
+	if err := r.seek(r.start()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// OpenIndexedFile opens the named Frame Streams file for reading with an
+// IndexedReader, using the sidecar index file named by IndexFilename if
+// present.
+func OpenIndexedFile(fname string) (*IndexedReader, error) {
+	ix, err := ReadIndexFile(IndexFilename(fname))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewIndexedReader(f, ix)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// ReadFrame reads the next data frame into b, returning its length.
+//
+// ReadFrame satisfies the dnstap Reader interface.
+func (r *IndexedReader) ReadFrame(b []byte) (int, error) {
+	if r.pending != nil {
+		if len(r.pending) > len(b) {
+			r.pending = nil
+			return 0, framestream.ErrDataFrameTooLarge
+		}
+		n := copy(b, r.pending)
+		r.pending = nil
+		return n, nil
+	}
+	return r.r.ReadFrame(b)
+}
+
+// Close closes the underlying file if it is an io.Closer.
+func (r *IndexedReader) Close() error {
+	if c, ok := r.rs.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// seek restarts reading at the data frame described by e.
+func (r *IndexedReader) seek(e IndexEntry) error {
+	if e.Offset < r.dataStart {
+		return ErrBadIndex
+	}
+	if _, err := r.rs.Seek(e.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	// Present the data following the offset to a new Reader as a
+	// complete Frame Streams file.
+	rdr, err := NewReader(io.MultiReader(bytes.NewReader(frameStreamHeader()), r.rs), nil)
+	if err != nil {
+		return err
+	}
+	r.r = rdr
+	r.pending = nil
+	return nil
+}
+
+func (r *IndexedReader) start() IndexEntry {
+	return IndexEntry{Offset: r.dataStart}
+}
+
+// SeekFrame positions the IndexedReader so that the next call to
+// ReadFrame returns data frame n, counting from zero.
+func (r *IndexedReader) SeekFrame(n uint64) error {
+	e := r.start()
+	i := sort.Search(len(r.ix.Entries), func(i int) bool {
+		return r.ix.Entries[i].Frame > n
+	})
+	if i > 0 {
+		e = r.ix.Entries[i-1]
+	}
+	if err := r.seek(e); err != nil {
+		return err
+	}
+
+	buf := make([]byte, MaxPayloadSize)
+	for f := e.Frame; f < n; f++ {
+		if _, err := r.r.ReadFrame(buf); err != nil && err != framestream.ErrDataFrameTooLarge {
+			return err
+		}
+	}
+	return nil
+}
+
+// SeekTime positions the IndexedReader so that the next call to ReadFrame
+// returns the first data frame with a message time at or after t. Frames
+// are assumed to be in approximate time order, as written by a single DNS
+// server. If there is no such frame, SeekTime returns io.EOF.
+func (r *IndexedReader) SeekTime(t time.Time) error {
+	// The last entry before t may still precede frames at or after t,
+	// so start there. Entries for frames without a time are skipped,
+	// which leaves the times out of order for a binary search.
+	e := r.start()
+	for _, ie := range r.ix.Entries {
+		if ie.Time.IsZero() {
+			continue
+		}
+		if !ie.Time.Before(t) {
+			break
+		}
+		e = ie
+	}
+	if err := r.seek(e); err != nil {
+		return err
+	}
+
+	buf := make([]byte, MaxPayloadSize)
+	for {
+		n, err := r.r.ReadFrame(buf)
+		if err == framestream.ErrDataFrameTooLarge {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if mt, ok := frameTime(buf[:n]); ok && !mt.Before(t) {
+			r.pending = make([]byte, n)
+			copy(r.pending, buf)
+			return nil
+		}
+	}
+}
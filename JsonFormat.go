@@ -15,126 +15,150 @@
 package dnstap
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
 	"net"
+	"strconv"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
-type jsonTime time.Time
-
-func (jt *jsonTime) MarshalJSON() ([]byte, error) {
-	stamp := time.Time(*jt).Format(time.RFC3339Nano)
-	return []byte(fmt.Sprintf("\"%s\"", stamp)), nil
-}
-
-type jsonDnstap struct {
-	Type     string      `json:"type"`
-	Identity string      `json:"identity,omitempty"`
-	Version  string      `json:"version,omitempty"`
-	Message  jsonMessage `json:"message"`
-}
-
-type jsonMessage struct {
-	Type            string    `json:"type"`
-	QueryTime       *jsonTime `json:"query_time,omitempty"`
-	ResponseTime    *jsonTime `json:"response_time,omitempty"`
-	SocketFamily    string    `json:"socket_family,omitempty"`
-	SocketProtocol  string    `json:"socket_protocol,omitempty"`
-	QueryAddress    *net.IP   `json:"query_address,omitempty"`
-	ResponseAddress *net.IP   `json:"response_address,omitempty"`
-	QueryPort       uint32    `json:"query_port,omitempty"`
-	ResponsePort    uint32    `json:"response_port,omitempty"`
-	QueryZone       string    `json:"query_zone,omitempty"`
-	QueryMessage    string    `json:"query_message,omitempty"`
-	ResponseMessage string    `json:"response_message,omitempty"`
+// The JSON form of a dnstap message is written directly rather than with
+// encoding/json, to avoid its allocations. Its fields, their order, and
+// their encoding are those encoding/json would produce for:
+//
+//	type jsonDnstap struct {
+//		Type     string      `json:"type"`
+//		Identity string      `json:"identity,omitempty"`
+//		Version  string      `json:"version,omitempty"`
+//		Message  jsonMessage `json:"message"`
+//	}
+//
+//	type jsonMessage struct {
+//		Type            string     `json:"type"`
+//		QueryTime       *time.Time `json:"query_time,omitempty"`
+//		ResponseTime    *time.Time `json:"response_time,omitempty"`
+//		SocketFamily    string     `json:"socket_family,omitempty"`
+//		SocketProtocol  string     `json:"socket_protocol,omitempty"`
+//		QueryAddress    *net.IP    `json:"query_address,omitempty"`
+//		ResponseAddress *net.IP    `json:"response_address,omitempty"`
+//		QueryPort       uint32     `json:"query_port,omitempty"`
+//		ResponsePort    uint32     `json:"response_port,omitempty"`
+//		QueryZone       string     `json:"query_zone,omitempty"`
+//		QueryMessage    string     `json:"query_message,omitempty"`
+//		ResponseMessage string     `json:"response_message,omitempty"`
+//	}
+
+func jsonConvertTime(b []byte, key string, secs *uint64, nsecs *uint32) []byte {
+	if secs == nil || nsecs == nil {
+		return b
+	}
+	b = append(b, `,"`...)
+	b = append(b, key...)
+	b = append(b, `":"`...)
+	b = time.Unix(int64(*secs), int64(*nsecs)).UTC().AppendFormat(b, time.RFC3339Nano)
+	return append(b, '"')
 }
 
-func convertJSONMessage(m *Message) jsonMessage {
-	jMsg := jsonMessage{
-		Type:           fmt.Sprint(m.Type),
-		SocketFamily:   fmt.Sprint(m.SocketFamily),
-		SocketProtocol: fmt.Sprint(m.SocketProtocol),
+func jsonConvertIP(b []byte, key string, ip []byte) ([]byte, bool) {
+	if ip == nil {
+		return b, true
 	}
-
-	if m.QueryTimeSec != nil && m.QueryTimeNsec != nil {
-		qt := jsonTime(time.Unix(int64(*m.QueryTimeSec), int64(*m.QueryTimeNsec)).UTC())
-		jMsg.QueryTime = &qt
+	b = append(b, `,"`...)
+	b = append(b, key...)
+	b = append(b, `":"`...)
+	switch len(ip) {
+	case 0:
+	case net.IPv4len, net.IPv6len:
+		b = appendIP(b, ip)
+	default:
+		// net.IP.MarshalText fails on addresses of invalid length.
+		return b, false
 	}
+	return append(b, '"'), true
+}
 
-	if m.ResponseTimeSec != nil && m.ResponseTimeNsec != nil {
-		rt := jsonTime(time.Unix(int64(*m.ResponseTimeSec), int64(*m.ResponseTimeNsec)).UTC())
-		jMsg.ResponseTime = &rt
+func jsonConvertString(b []byte, key, value string) []byte {
+	if value == "" {
+		return b
 	}
+	b = append(b, `,"`...)
+	b = append(b, key...)
+	b = append(b, `":`...)
+	return appendJSONString(b, value)
+}
 
-	if m.QueryAddress != nil {
-		qa := net.IP(m.QueryAddress)
-		jMsg.QueryAddress = &qa
+func jsonConvertPort(b []byte, key string, port *uint32) []byte {
+	if port == nil || *port == 0 {
+		return b
 	}
+	b = append(b, `,"`...)
+	b = append(b, key...)
+	b = append(b, `":`...)
+	return strconv.AppendUint(b, uint64(*port), 10)
+}
 
-	if m.ResponseAddress != nil {
-		ra := net.IP(m.ResponseAddress)
-		jMsg.ResponseAddress = &ra
+func jsonConvertDNS(b []byte, key string, wire []byte) []byte {
+	if wire == nil {
+		return b
 	}
-
-	if m.QueryPort != nil {
-		jMsg.QueryPort = *m.QueryPort
+	msg := new(dns.Msg)
+	if err := msg.Unpack(wire); err != nil {
+		return jsonConvertString(b, key, "parse failed: "+err.Error())
 	}
+	return jsonConvertString(b, key, msg.String())
+}
 
-	if m.ResponsePort != nil {
-		jMsg.ResponsePort = *m.ResponsePort
+func jsonConvertMessage(b []byte, m *Message) ([]byte, bool) {
+	ok := true
+	b = append(b, `{"type":`...)
+	b = appendJSONString(b, messageTypeName(m.Type))
+	b = jsonConvertTime(b, "query_time", m.QueryTimeSec, m.QueryTimeNsec)
+	b = jsonConvertTime(b, "response_time", m.ResponseTimeSec, m.ResponseTimeNsec)
+	b = jsonConvertString(b, "socket_family", socketFamilyName(m.SocketFamily))
+	b = jsonConvertString(b, "socket_protocol", socketProtocolName(m.SocketProtocol))
+	if b, ok = jsonConvertIP(b, "query_address", m.QueryAddress); !ok {
+		return b, false
+	}
+	if b, ok = jsonConvertIP(b, "response_address", m.ResponseAddress); !ok {
+		return b, false
 	}
+	b = jsonConvertPort(b, "query_port", m.QueryPort)
+	b = jsonConvertPort(b, "response_port", m.ResponsePort)
 
 	if m.QueryZone != nil {
 		name, _, err := dns.UnpackDomainName(m.QueryZone, 0)
 		if err != nil {
-			jMsg.QueryZone = fmt.Sprintf("parse failed: %v", err)
+			b = jsonConvertString(b, "query_zone", "parse failed: "+err.Error())
 		} else {
-			jMsg.QueryZone = string(name)
+			b = jsonConvertString(b, "query_zone", name)
 		}
 	}
 
-	if m.QueryMessage != nil {
-		msg := new(dns.Msg)
-		err := msg.Unpack(m.QueryMessage)
-		if err != nil {
-			jMsg.QueryMessage = fmt.Sprintf("parse failed: %v", err)
-		} else {
-			jMsg.QueryMessage = msg.String()
-		}
-	}
-
-	if m.ResponseMessage != nil {
-		msg := new(dns.Msg)
-		err := msg.Unpack(m.ResponseMessage)
-		if err != nil {
-			jMsg.ResponseMessage = fmt.Sprintf("parse failed: %v", err)
-		} else {
-			jMsg.ResponseMessage = msg.String()
-		}
-	}
-	return jMsg
+	b = jsonConvertDNS(b, "query_message", m.QueryMessage)
+	b = jsonConvertDNS(b, "response_message", m.ResponseMessage)
+	return append(b, '}'), true
 }
 
 // JSONFormat renders a Dnstap message in JSON format. Any encapsulated
 // DNS messages are rendered as strings in a format similar to 'dig' output.
 func JSONFormat(dt *Dnstap) (out []byte, ok bool) {
-	var s bytes.Buffer
+	return AppendJSONFormat(nil, dt)
+}
 
-	j, err := json.Marshal(jsonDnstap{
-		Type:     fmt.Sprint(dt.Type),
-		Identity: string(dt.Identity),
-		Version:  string(dt.Version),
-		Message:  convertJSONMessage(dt.Message),
-	})
-	if err != nil {
-		return nil, false
+// AppendJSONFormat appends the JSON form of a dnstap message rendered by
+// JSONFormat to dst.
+func AppendJSONFormat(dst []byte, dt *Dnstap) (out []byte, ok bool) {
+	b := append(dst, `{"type":`...)
+	b = appendJSONString(b, dnstapTypeName(dt.Type))
+	b = jsonConvertString(b, "identity", string(dt.Identity))
+	b = jsonConvertString(b, "version", string(dt.Version))
+	b = append(b, `,"message":`...)
+	if dt.Message != nil {
+		if b, ok = jsonConvertMessage(b, dt.Message); !ok {
+			return dst, false
+		}
+	} else {
+		b = append(b, `{"type":""}`...)
 	}
-
-	s.WriteString(string(j) + "\n")
-
-	return s.Bytes(), true
+	return append(b, "}\n"...), true
 }
@@ -0,0 +1,363 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// jsonParseDnstap and jsonParseMessage hold the JSON form of a dnstap
+// message as written by JSONFormat.
+type jsonParseDnstap struct {
+	Type     string           `json:"type"`
+	Identity string           `json:"identity"`
+	Version  string           `json:"version"`
+	Message  jsonParseMessage `json:"message"`
+}
+
+type jsonParseMessage struct {
+	Type            string  `json:"type"`
+	QueryTime       string  `json:"query_time"`
+	ResponseTime    string  `json:"response_time"`
+	SocketFamily    string  `json:"socket_family"`
+	SocketProtocol  string  `json:"socket_protocol"`
+	QueryAddress    *string `json:"query_address"`
+	ResponseAddress *string `json:"response_address"`
+	QueryPort       uint32  `json:"query_port"`
+	ResponsePort    uint32  `json:"response_port"`
+	QueryZone       string  `json:"query_zone"`
+	QueryMessage    string  `json:"query_message"`
+	ResponseMessage string  `json:"response_message"`
+}
+
+// ParseJSONFormat parses a dnstap message in the JSON form rendered by
+// JSONFormat, for senders which can produce only JSON.
+//
+// The conversion is lossy: the DNS messages are re-encoded from their
+// 'dig'-like text, so they may differ from the originals in name
+// compression and record order, and lose any EDNS options. Fields which
+// JSONFormat could not render, such as DNS messages which failed to
+// parse, are left unset.
+func ParseJSONFormat(b []byte) (*Dnstap, error) {
+	var j jsonParseDnstap
+	if err := json.Unmarshal(b, &j); err != nil {
+		return nil, err
+	}
+	dt := &Dnstap{}
+	if j.Type != "<nil>" {
+		v, err := parseEnum(j.Type, Dnstap_Type_value)
+		if err != nil {
+			return nil, fmt.Errorf("type: %v", err)
+		}
+		dt.Type = Dnstap_Type(v).Enum()
+	}
+	if j.Identity != "" {
+		dt.Identity = []byte(j.Identity)
+	}
+	if j.Version != "" {
+		dt.Version = []byte(j.Version)
+	}
+	// JSONFormat renders a missing message with an empty type.
+	if j.Message.Type == "" {
+		return dt, nil
+	}
+	m, err := j.Message.message()
+	if err != nil {
+		return nil, fmt.Errorf("message: %v", err)
+	}
+	dt.Message = m
+	return dt, nil
+}
+
+func (j *jsonParseMessage) message() (*Message, error) {
+	m := &Message{}
+	if j.Type != "<nil>" {
+		v, err := parseEnum(j.Type, Message_Type_value)
+		if err != nil {
+			return nil, fmt.Errorf("type: %v", err)
+		}
+		m.Type = Message_Type(v).Enum()
+	}
+	var err error
+	if m.QueryTimeSec, m.QueryTimeNsec, err = parseJSONTime(j.QueryTime); err != nil {
+		return nil, fmt.Errorf("query_time: %v", err)
+	}
+	if m.ResponseTimeSec, m.ResponseTimeNsec, err = parseJSONTime(j.ResponseTime); err != nil {
+		return nil, fmt.Errorf("response_time: %v", err)
+	}
+	if j.SocketFamily != "" && j.SocketFamily != "<nil>" {
+		v, err := parseEnum(j.SocketFamily, SocketFamily_value)
+		if err != nil {
+			return nil, fmt.Errorf("socket_family: %v", err)
+		}
+		m.SocketFamily = SocketFamily(v).Enum()
+	}
+	if j.SocketProtocol != "" && j.SocketProtocol != "<nil>" {
+		v, err := parseEnum(j.SocketProtocol, SocketProtocol_value)
+		if err != nil {
+			return nil, fmt.Errorf("socket_protocol: %v", err)
+		}
+		m.SocketProtocol = SocketProtocol(v).Enum()
+	}
+	if m.QueryAddress, err = parseJSONIP(j.QueryAddress); err != nil {
+		return nil, fmt.Errorf("query_address: %v", err)
+	}
+	if m.ResponseAddress, err = parseJSONIP(j.ResponseAddress); err != nil {
+		return nil, fmt.Errorf("response_address: %v", err)
+	}
+	if j.QueryPort != 0 {
+		m.QueryPort = &j.QueryPort
+	}
+	if j.ResponsePort != 0 {
+		m.ResponsePort = &j.ResponsePort
+	}
+	if j.QueryZone != "" && !strings.HasPrefix(j.QueryZone, "parse failed: ") {
+		buf := make([]byte, 256)
+		n, err := dns.PackDomainName(dns.Fqdn(j.QueryZone), buf, 0, nil, false)
+		if err != nil {
+			return nil, fmt.Errorf("query_zone: %v", err)
+		}
+		m.QueryZone = buf[:n]
+	}
+	if m.QueryMessage, err = parseJSONDNS(j.QueryMessage); err != nil {
+		return nil, fmt.Errorf("query_message: %v", err)
+	}
+	if m.ResponseMessage, err = parseJSONDNS(j.ResponseMessage); err != nil {
+		return nil, fmt.Errorf("response_message: %v", err)
+	}
+	return m, nil
+}
+
+// parseEnum returns the value of the enum named s, which may be a number
+// for values unknown when the message was rendered.
+func parseEnum(s string, values map[string]int32) (int32, error) {
+	if v, ok := values[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unknown value %q", s)
+	}
+	return int32(v), nil
+}
+
+func parseJSONTime(s string) (*uint64, *uint32, error) {
+	if s == "" {
+		return nil, nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	secs, nsecs := uint64(t.Unix()), uint32(t.Nanosecond())
+	return &secs, &nsecs, nil
+}
+
+func parseJSONIP(s *string) ([]byte, error) {
+	if s == nil {
+		return nil, nil
+	}
+	if *s == "" {
+		return []byte{}, nil
+	}
+	ip := net.ParseIP(*s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", *s)
+	}
+	if ip4 := ip.To4(); ip4 != nil && !strings.Contains(*s, ":") {
+		return []byte(ip4), nil
+	}
+	return []byte(ip), nil
+}
+
+// parseJSONDNS returns the wire form of a DNS message rendered as text by
+// JSONFormat, or nil if it could not be rendered.
+func parseJSONDNS(s string) ([]byte, error) {
+	if s == "" || strings.HasPrefix(s, "parse failed: ") {
+		return nil, nil
+	}
+	msg, err := parseDigText(s)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Pack()
+}
+
+// parseDigText parses the text form of a DNS message produced by
+// dns.Msg.String.
+func parseDigText(s string) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	lines := strings.Split(s, "\n")
+	if len(lines) < 2 {
+		return nil, errors.New("missing header")
+	}
+	if err := parseDigHeader(msg, lines[0], lines[1]); err != nil {
+		return nil, err
+	}
+
+	var section *[]dns.RR
+	for _, line := range lines[2:] {
+		switch line {
+		case "":
+			continue
+		case ";; QUESTION SECTION:":
+			section = nil
+			continue
+		case ";; ANSWER SECTION:":
+			section = &msg.Answer
+			continue
+		case ";; AUTHORITY SECTION:":
+			section = &msg.Ns
+			continue
+		case ";; ADDITIONAL SECTION:", ";; OPT PSEUDOSECTION:":
+			section = &msg.Extra
+			continue
+		}
+		if section == nil {
+			q, err := parseDigQuestion(line)
+			if err != nil {
+				return nil, err
+			}
+			msg.Question = append(msg.Question, q)
+			continue
+		}
+		if strings.HasPrefix(line, "; EDNS: ") {
+			opt, err := parseDigEDNS(line)
+			if err != nil {
+				return nil, err
+			}
+			*section = append(*section, opt)
+			continue
+		}
+		if strings.HasPrefix(line, ";") {
+			// EDNS options are not restored.
+			continue
+		}
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			return nil, err
+		}
+		if rr != nil {
+			*section = append(*section, rr)
+		}
+	}
+	return msg, nil
+}
+
+// parseDigHeader parses the header lines of the form
+//
+//	;; opcode: QUERY, status: NOERROR, id: 1234
+//	;; flags: qr rd ra; QUERY: 1, ANSWER: 1, AUTHORITY: 0, ADDITIONAL: 0
+func parseDigHeader(msg *dns.Msg, opline, flagline string) error {
+	var opcode, status string
+	var id uint16
+	if _, err := fmt.Sscanf(opline, ";; opcode: %s status: %s id: %d", &opcode, &status, &id); err != nil {
+		return fmt.Errorf("invalid header %q", opline)
+	}
+	var ok bool
+	if msg.Opcode, ok = dns.StringToOpcode[strings.TrimSuffix(opcode, ",")]; !ok {
+		return fmt.Errorf("unknown opcode %q", opcode)
+	}
+	if msg.Rcode, ok = dns.StringToRcode[strings.TrimSuffix(status, ",")]; !ok {
+		return fmt.Errorf("unknown status %q", status)
+	}
+	msg.Id = id
+
+	flags := strings.TrimPrefix(flagline, ";; flags:")
+	i := strings.IndexByte(flags, ';')
+	if i < 0 {
+		return fmt.Errorf("invalid header %q", flagline)
+	}
+	for _, f := range strings.Fields(flags[:i]) {
+		switch f {
+		case "qr":
+			msg.Response = true
+		case "aa":
+			msg.Authoritative = true
+		case "tc":
+			msg.Truncated = true
+		case "rd":
+			msg.RecursionDesired = true
+		case "ra":
+			msg.RecursionAvailable = true
+		case "z":
+			msg.Zero = true
+		case "ad":
+			msg.AuthenticatedData = true
+		case "cd":
+			msg.CheckingDisabled = true
+		default:
+			return fmt.Errorf("unknown flag %q", f)
+		}
+	}
+	return nil
+}
+
+// parseDigQuestion parses a question of the form ";name\tclass\t type".
+func parseDigQuestion(line string) (dns.Question, error) {
+	f := strings.Split(strings.TrimPrefix(line, ";"), "\t")
+	if len(f) != 3 {
+		return dns.Question{}, fmt.Errorf("invalid question %q", line)
+	}
+	q := dns.Question{Name: f[0]}
+	var ok bool
+	if q.Qclass, ok = parseDigCode(f[1], "CLASS", dns.StringToClass); !ok {
+		return q, fmt.Errorf("unknown class %q", f[1])
+	}
+	if q.Qtype, ok = parseDigCode(strings.TrimSpace(f[2]), "TYPE", dns.StringToType); !ok {
+		return q, fmt.Errorf("unknown type %q", f[2])
+	}
+	return q, nil
+}
+
+// parseDigCode parses a class or type mnemonic, or its generic form with
+// the given prefix, such as "TYPE65280".
+func parseDigCode(s, prefix string, codes map[string]uint16) (uint16, bool) {
+	if c, ok := codes[s]; ok {
+		return c, true
+	}
+	if !strings.HasPrefix(s, prefix) {
+		return 0, false
+	}
+	c, err := strconv.ParseUint(s[len(prefix):], 10, 16)
+	return uint16(c), err == nil
+}
+
+// parseDigEDNS parses the OPT pseudo-record line of the form
+// "; EDNS: version 0; flags: do; udp: 4096".
+func parseDigEDNS(line string) (*dns.OPT, error) {
+	var version uint8
+	var flags string
+	var udp uint16
+	// Without the do flag, the flags are empty, and scanned as ";".
+	if _, err := fmt.Sscanf(line, "; EDNS: version %d; flags: %s udp: %d", &version, &flags, &udp); err != nil {
+		return nil, fmt.Errorf("invalid EDNS %q", line)
+	}
+	opt := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+	opt.SetVersion(version)
+	opt.SetUDPSize(udp)
+	opt.SetDo(flags == "do;")
+	return opt, nil
+}
@@ -0,0 +1,558 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// A KafkaFormat is the format of the records produced by a KafkaOutput.
+type KafkaFormat int
+
+const (
+	// KafkaProtobuf produces the dnstap protobuf messages.
+	KafkaProtobuf KafkaFormat = iota
+	// KafkaJSON produces the messages in the JSON form rendered by
+	// JSONFormat, without the trailing newline.
+	KafkaJSON
+)
+
+// A KafkaCompression is the compression applied to the record batches
+// produced by a KafkaOutput.
+type KafkaCompression int
+
+const (
+	KafkaCompressionNone KafkaCompression = iota
+	KafkaCompressionGzip
+)
+
+// KafkaAcks is the acknowledgement a KafkaOutput requires from the
+// brokers for each batch it produces.
+type KafkaAcks int
+
+const (
+	// KafkaAcksLeader requires the partition leader to have written the
+	// records.
+	KafkaAcksLeader KafkaAcks = iota
+	// KafkaAcksAll requires all in-sync replicas of the partition to
+	// have written the records.
+	KafkaAcksAll
+	// KafkaAcksNone requires no acknowledgement: records are counted as
+	// delivered once sent.
+	KafkaAcksNone
+)
+
+// KafkaOptions specifies configuration for a KafkaOutput.
+type KafkaOptions struct {
+	// Brokers holds the "host:port" addresses of the brokers from
+	// which the cluster metadata is first requested.
+	Brokers []string
+	// Topic is the topic records are produced to. The strings
+	// "{identity}" and "{type}" in Topic are replaced by the identity of
+	// each message, or "unknown" if it has none, and by its message type
+	// in lower case, such as "client_response". Characters not allowed
+	// in topic names are replaced by "_".
+	Topic string
+	// Format is the format of the records.
+	Format KafkaFormat
+	// KeyByClient sets the key of each record to the query (client)
+	// address of its message. Records with the same key are produced
+	// to the same partition, chosen as by the Kafka Java client. Other
+	// records are spread across the partitions of their topic, one
+	// partition per batch.
+	KeyByClient bool
+	// Compression is the compression of the record batches.
+	Compression KafkaCompression
+	// Acks is the acknowledgement required for each batch.
+	Acks KafkaAcks
+	// BatchSize and BatchBytes are the number of records, and their
+	// size in bytes, at which the pending records are produced without
+	// waiting for more. The defaults are 1000 records and 512 KiB.
+	BatchSize  int
+	BatchBytes int
+	// FlushInterval is the interval at which pending records are
+	// produced. The default is one second.
+	FlushInterval time.Duration
+	// Timeout is the time allowed to connect to a broker and for each
+	// request. The default is 30 seconds.
+	Timeout time.Duration
+	// MaxRetries is the number of times records failing with a network
+	// error or a retriable broker error are retried, after refreshing
+	// the cluster metadata, before they are counted as failed. Retries
+	// are not idempotent: if a batch was written by the broker but its
+	// response was lost, as when the connection fails or the request
+	// times out, the retried batch is written again, duplicating its
+	// records.
+	MaxRetries int
+	// RetryInterval is the delay before each retry. The default is one
+	// second.
+	RetryInterval time.Duration
+	// ClientID identifies the KafkaOutput to the brokers. The default
+	// is "dnstap".
+	ClientID string
+	// TLS, if set, is used to connect to the brokers with TLS.
+	TLS *tls.Config
+	// Logger receives delivery failures.
+	Logger Logger
+}
+
+// KafkaStats counts the records produced by a KafkaOutput.
+type KafkaStats struct {
+	// Delivered counts the records acknowledged by the brokers, or sent
+	// if no acknowledgement is required.
+	Delivered uint64
+	// Failed counts the records discarded after failing to be
+	// delivered, or failing to be formatted.
+	Failed uint64
+	// Retried counts the records retried after a failure.
+	Retried uint64
+}
+
+// A KafkaOutput is a dnstap Output producing the messages it receives as
+// records of Kafka topics.
+//
+// Records are produced in batches, one batch at a time, so a slow or
+// unavailable cluster holds up the messages sent to the KafkaOutput.
+// Records are not produced idempotently, so a retried batch which was in
+// fact delivered is delivered twice.
+type KafkaOutput struct {
+	opt           KafkaOptions
+	outputChannel chan []byte
+	wait          chan bool
+	pool          *FramePool
+
+	pending   map[string][]kafkaRecord // by topic
+	count     int
+	bytes     int
+	next      map[string]int32 // the partition of the next unkeyed batch
+	md        *kafkaMetadata
+	conns     map[int32]*kafkaConn
+	delivered uint64
+	failed    uint64
+	retried   uint64
+}
+
+// NewKafkaOutput creates a KafkaOutput with the given options.
+func NewKafkaOutput(opt *KafkaOptions) (*KafkaOutput, error) {
+	o := &KafkaOutput{
+		outputChannel: make(chan []byte, outputChannelSize),
+		wait:          make(chan bool),
+		pending:       make(map[string][]kafkaRecord),
+		next:          make(map[string]int32),
+		conns:         make(map[int32]*kafkaConn),
+	}
+	if opt != nil {
+		o.opt = *opt
+	}
+	if len(o.opt.Brokers) == 0 {
+		return nil, errors.New("no Kafka brokers given")
+	}
+	if o.opt.Topic == "" {
+		return nil, errors.New("no Kafka topic given")
+	}
+	if o.opt.BatchSize <= 0 {
+		o.opt.BatchSize = 1000
+	}
+	if o.opt.BatchBytes <= 0 {
+		o.opt.BatchBytes = 512 << 10
+	}
+	if o.opt.FlushInterval <= 0 {
+		o.opt.FlushInterval = time.Second
+	}
+	if o.opt.Timeout <= 0 {
+		o.opt.Timeout = 30 * time.Second
+	}
+	if o.opt.RetryInterval <= 0 {
+		o.opt.RetryInterval = time.Second
+	}
+	if o.opt.ClientID == "" {
+		o.opt.ClientID = "dnstap"
+	}
+	if o.opt.Logger == nil {
+		o.opt.Logger = nullLogger{}
+	}
+	return o, nil
+}
+
+// SetFramePool configures the KafkaOutput to return the buffers of the
+// frames it has batched to pool.
+func (o *KafkaOutput) SetFramePool(pool *FramePool) {
+	o.pool = pool
+}
+
+// Stats returns the counts of records produced so far. It is safe to call
+// while the output loop runs.
+func (o *KafkaOutput) Stats() KafkaStats {
+	return KafkaStats{
+		Delivered: atomic.LoadUint64(&o.delivered),
+		Failed:    atomic.LoadUint64(&o.failed),
+		Retried:   atomic.LoadUint64(&o.retried),
+	}
+}
+
+// GetOutputChannel returns the channel on which the KafkaOutput accepts
+// dnstap data.
+//
+// GetOutputChannel satisfies the dnstap Output interface.
+func (o *KafkaOutput) GetOutputChannel() chan []byte {
+	return o.outputChannel
+}
+
+// RunOutputLoop produces the data received on the output channel in
+// batches, returning after Close is called and the last batch has been
+// produced.
+//
+// RunOutputLoop satisfies the dnstap Output interface.
+func (o *KafkaOutput) RunOutputLoop() {
+	t := time.NewTicker(o.opt.FlushInterval)
+	defer t.Stop()
+	var v View
+	dt := &Dnstap{}
+	for {
+		select {
+		case frame, ok := <-o.outputChannel:
+			if !ok {
+				o.flush()
+				for _, c := range o.conns {
+					c.Close()
+				}
+				if s := o.Stats(); s.Failed > 0 {
+					o.opt.Logger.Printf("KafkaOutput: %d records delivered, %d failed", s.Delivered, s.Failed)
+				}
+				close(o.wait)
+				return
+			}
+			o.add(frame, &v, dt)
+			o.pool.Put(frame)
+			if o.count >= o.opt.BatchSize || o.bytes >= o.opt.BatchBytes {
+				o.flush()
+			}
+		case <-t.C:
+			o.flush()
+		}
+	}
+}
+
+// Close closes the KafkaOutput's output channel and returns after all
+// pending records have been delivered or have failed.
+//
+// Close satisfies the dnstap Output interface.
+func (o *KafkaOutput) Close() {
+	close(o.outputChannel)
+	<-o.wait
+}
+
+// add adds a record for frame to the pending records of its topic.
+func (o *KafkaOutput) add(frame []byte, v *View, dt *Dnstap) {
+	if err := v.Parse(frame); err != nil {
+		o.opt.Logger.Printf("KafkaOutput: invalid frame: %v", err)
+		atomic.AddUint64(&o.failed, 1)
+		return
+	}
+	r := kafkaRecord{time: time.Now()}
+	if t, ok := v.Message.Time(); ok && v.HasMessage {
+		r.time = t
+	}
+	if o.opt.KeyByClient && v.HasMessage && len(v.Message.QueryAddress) > 0 {
+		r.key = []byte(net.IP(v.Message.QueryAddress).String())
+	}
+	topic := o.topic(v)
+
+	if o.opt.Format == KafkaJSON {
+		if err := proto.Unmarshal(frame, dt); err != nil {
+			o.opt.Logger.Printf("KafkaOutput: proto.Unmarshal() failed: %s", err)
+			atomic.AddUint64(&o.failed, 1)
+			return
+		}
+		b, ok := JSONFormat(dt)
+		if !ok {
+			o.opt.Logger.Printf("KafkaOutput: JSON format failed")
+			atomic.AddUint64(&o.failed, 1)
+			return
+		}
+		r.value = b[:len(b)-1]
+	} else {
+		r.value = append([]byte(nil), frame...)
+	}
+	o.pending[topic] = append(o.pending[topic], r)
+	o.count++
+	o.bytes += len(r.key) + len(r.value)
+}
+
+// topic returns the topic of the message viewed in v.
+func (o *KafkaOutput) topic(v *View) string {
+	topic := o.opt.Topic
+	if strings.Contains(topic, "{identity}") {
+		id := string(v.Identity)
+		if id == "" {
+			id = "unknown"
+		}
+		topic = strings.Replace(topic, "{identity}", id, -1)
+	}
+	if strings.Contains(topic, "{type}") {
+		var typ string
+		switch {
+		case v.HasMessage:
+			typ = v.Message.Type.String()
+		case v.Type != 0:
+			typ = v.Type.String()
+		default:
+			typ = "unknown"
+		}
+		topic = strings.Replace(topic, "{type}", strings.ToLower(typ), -1)
+	}
+	return kafkaTopicName(topic)
+}
+
+// kafkaTopicName replaces the characters of topic not allowed in Kafka
+// topic names with "_", and truncates it to the maximum length.
+func kafkaTopicName(topic string) string {
+	b := []byte(topic)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '.', c == '_', c == '-':
+		default:
+			b[i] = '_'
+		}
+	}
+	if len(b) > 249 {
+		b = b[:249]
+	}
+	return string(b)
+}
+
+// flush produces the pending records, retrying failures.
+func (o *KafkaOutput) flush() {
+	if o.count == 0 {
+		return
+	}
+	pending := o.pending
+	o.pending = make(map[string][]kafkaRecord)
+	o.count, o.bytes = 0, 0
+
+	var batches map[kafkaPartition][]kafkaRecord
+	var err error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			time.Sleep(o.opt.RetryInterval)
+		}
+		if batches == nil {
+			batches, err = o.partition(pending, attempt > 0)
+			if err != nil {
+				if attempt < o.opt.MaxRetries {
+					o.opt.Logger.Printf("KafkaOutput: %v; retrying", err)
+					continue
+				}
+				for _, records := range pending {
+					o.fail(len(records), err)
+				}
+				return
+			}
+		} else if err := o.refresh(o.topics(batches)); err != nil {
+			o.opt.Logger.Printf("KafkaOutput: %v", err)
+		}
+
+		failed := o.produce(batches)
+		if len(failed) == 0 {
+			return
+		}
+		retry := make(map[kafkaPartition][]kafkaRecord)
+		for tp, err := range failed {
+			records := batches[tp]
+			if ke, ok := err.(kafkaError); (!ok || ke.retriable()) && attempt < o.opt.MaxRetries {
+				o.opt.Logger.Printf("KafkaOutput: %s/%d: %v; retrying", tp.topic, tp.partition, err)
+				atomic.AddUint64(&o.retried, uint64(len(records)))
+				retry[tp] = records
+				continue
+			}
+			o.fail(len(records), fmt.Errorf("%s/%d: %v", tp.topic, tp.partition, err))
+		}
+		if len(retry) == 0 {
+			return
+		}
+		batches = retry
+	}
+}
+
+func (o *KafkaOutput) fail(n int, err error) {
+	o.opt.Logger.Printf("KafkaOutput: discarding %d records: %v", n, err)
+	atomic.AddUint64(&o.failed, uint64(n))
+}
+
+// topics returns the sorted topics of batches.
+func (o *KafkaOutput) topics(batches map[kafkaPartition][]kafkaRecord) []string {
+	seen := make(map[string]bool)
+	var topics []string
+	for tp := range batches {
+		if !seen[tp.topic] {
+			seen[tp.topic] = true
+			topics = append(topics, tp.topic)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// partition assigns the pending records of each topic to its partitions,
+// refreshing the metadata first if it lacks a topic, or if refresh is
+// true.
+func (o *KafkaOutput) partition(pending map[string][]kafkaRecord, refresh bool) (map[kafkaPartition][]kafkaRecord, error) {
+	var topics []string
+	for topic := range pending {
+		topics = append(topics, topic)
+		if o.md == nil || o.md.leaders[topic] == nil {
+			refresh = true
+		}
+	}
+	sort.Strings(topics)
+	if refresh {
+		if err := o.refresh(topics); err != nil {
+			return nil, err
+		}
+	}
+
+	batches := make(map[kafkaPartition][]kafkaRecord)
+	for _, topic := range topics {
+		n := int32(len(o.md.leaders[topic]))
+		if n == 0 {
+			err := o.md.errs[topic]
+			if err == nil {
+				err = kafkaError(3) // UNKNOWN_TOPIC_OR_PARTITION
+			}
+			return nil, fmt.Errorf("topic %s: %v", topic, err)
+		}
+		unkeyed := o.next[topic] % n
+		o.next[topic] = unkeyed + 1
+		for _, r := range pending[topic] {
+			p := unkeyed
+			if r.key != nil {
+				p = (kafkaMurmur2(r.key) & 0x7fffffff) % n
+			}
+			tp := kafkaPartition{topic, p}
+			batches[tp] = append(batches[tp], r)
+		}
+	}
+	return batches, nil
+}
+
+// refresh requests the metadata of topics from the known brokers, or
+// failing that, the configured brokers.
+func (o *KafkaOutput) refresh(topics []string) error {
+	var addrs []string
+	if o.md != nil {
+		for _, addr := range o.md.brokers {
+			addrs = append(addrs, addr)
+		}
+	}
+	addrs = append(addrs, o.opt.Brokers...)
+	var err error
+	for _, addr := range addrs {
+		var c *kafkaConn
+		c, err = dialKafka(addr, o.opt.ClientID, o.opt.Timeout, o.opt.TLS)
+		if err != nil {
+			continue
+		}
+		var md *kafkaMetadata
+		md, err = c.metadata(topics)
+		c.Close()
+		if err != nil {
+			continue
+		}
+		o.md = md
+		// Connections to brokers which have left the cluster, or
+		// changed address, are closed.
+		for id, c := range o.conns {
+			if md.brokers[id] != c.addr {
+				c.Close()
+				delete(o.conns, id)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Kafka metadata request failed: %v", err)
+}
+
+// produce sends the batches to the leaders of their partitions, returning
+// the errors of the batches which failed.
+func (o *KafkaOutput) produce(batches map[kafkaPartition][]kafkaRecord) map[kafkaPartition]error {
+	failed := make(map[kafkaPartition]error)
+	byLeader := make(map[int32]map[kafkaPartition][]byte)
+	for tp, records := range batches {
+		leaders := o.md.leaders[tp.topic]
+		if int(tp.partition) >= len(leaders) || leaders[tp.partition] < 0 {
+			failed[tp] = kafkaError(5) // LEADER_NOT_AVAILABLE
+			continue
+		}
+		leader := leaders[tp.partition]
+		if byLeader[leader] == nil {
+			byLeader[leader] = make(map[kafkaPartition][]byte)
+		}
+		e := &kafkaEncoder{}
+		appendRecordBatch(e, records, o.opt.Compression == KafkaCompressionGzip)
+		byLeader[leader][tp] = e.b
+	}
+
+	acks := map[KafkaAcks]int16{KafkaAcksLeader: 1, KafkaAcksAll: -1, KafkaAcksNone: 0}[o.opt.Acks]
+	for leader, lb := range byLeader {
+		results, err := o.produceTo(leader, lb, acks)
+		for tp := range lb {
+			perr := err
+			if perr == nil {
+				perr = results[tp]
+			}
+			if perr != nil {
+				failed[tp] = perr
+				continue
+			}
+			atomic.AddUint64(&o.delivered, uint64(len(batches[tp])))
+		}
+	}
+	return failed
+}
+
+// produceTo sends batches to the broker leader, connecting to it if
+// necessary.
+func (o *KafkaOutput) produceTo(leader int32, batches map[kafkaPartition][]byte, acks int16) (map[kafkaPartition]error, error) {
+	c := o.conns[leader]
+	if c == nil {
+		addr, ok := o.md.brokers[leader]
+		if !ok {
+			return nil, fmt.Errorf("unknown Kafka broker %d", leader)
+		}
+		var err error
+		if c, err = dialKafka(addr, o.opt.ClientID, o.opt.Timeout, o.opt.TLS); err != nil {
+			return nil, err
+		}
+		o.conns[leader] = c
+	}
+	results, err := c.produce(batches, acks)
+	if err != nil {
+		c.Close()
+		delete(o.conns, leader)
+	}
+	return results, err
+}
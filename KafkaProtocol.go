@@ -0,0 +1,544 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"time"
+)
+
+// This file implements the parts of the Kafka protocol used by
+// KafkaOutput: Metadata (API key 3) version 1 and Produce (API key 0)
+// version 3 requests, and the version 2 record batches carried by Produce
+// requests, as described at https://kafka.apache.org/protocol.
+
+const (
+	kafkaProduceKey  = 0
+	kafkaMetadataKey = 3
+)
+
+// kafkaErrors names the Kafka error codes KafkaOutput is likely to
+// encounter.
+var kafkaErrors = map[int16]string{
+	1:  "OFFSET_OUT_OF_RANGE",
+	2:  "CORRUPT_MESSAGE",
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_OR_FOLLOWER",
+	7:  "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE",
+	13: "NETWORK_EXCEPTION",
+	17: "INVALID_TOPIC_EXCEPTION",
+	18: "RECORD_LIST_TOO_LARGE",
+	19: "NOT_ENOUGH_REPLICAS",
+	20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+	87: "INVALID_RECORD",
+}
+
+// A kafkaError is an error code returned by a Kafka broker.
+type kafkaError int16
+
+func (e kafkaError) Error() string {
+	if name, ok := kafkaErrors[int16(e)]; ok {
+		return name
+	}
+	return fmt.Sprintf("Kafka error %d", int16(e))
+}
+
+// retriable reports whether a request failing with the error may succeed
+// if retried, possibly with another broker after refreshing the metadata.
+func (e kafkaError) retriable() bool {
+	switch e {
+	case 3, 5, 6, 7, 13, 19, 20:
+		return true
+	}
+	return false
+}
+
+// A kafkaEncoder appends the Kafka protocol encodings of values to b.
+type kafkaEncoder struct {
+	b []byte
+}
+
+func (e *kafkaEncoder) int8(v int8) { e.b = append(e.b, byte(v)) }
+
+func (e *kafkaEncoder) int16(v int16) {
+	e.b = binary.BigEndian.AppendUint16(e.b, uint16(v))
+}
+
+func (e *kafkaEncoder) int32(v int32) {
+	e.b = binary.BigEndian.AppendUint32(e.b, uint32(v))
+}
+
+func (e *kafkaEncoder) int64(v int64) {
+	e.b = binary.BigEndian.AppendUint64(e.b, uint64(v))
+}
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *kafkaEncoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// varint appends v as a zigzag-encoded variable-length integer, as used
+// in record batches.
+func (e *kafkaEncoder) varint(v int64) {
+	e.b = binary.AppendVarint(e.b, v)
+}
+
+// varbytes appends b preceded by its length as a varint, or a length of
+// -1 if b is nil.
+func (e *kafkaEncoder) varbytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// A kafkaDecoder reads the Kafka protocol encodings of values from b,
+// recording the first error encountered. Values read after an error are
+// zero.
+type kafkaDecoder struct {
+	b   []byte
+	err error
+}
+
+var errKafkaShort = errors.New("truncated Kafka response")
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil || n < 0 || len(d.b) < n {
+		if d.err == nil {
+			d.err = errKafkaShort
+		}
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string reads a string or nullable string, returning a null string as
+// empty.
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+// bytes reads a byte array or nullable byte array.
+func (d *kafkaDecoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.next(int(n))
+}
+
+// arrayLen reads the length of an array, which is -1 for a null array.
+func (d *kafkaDecoder) arrayLen() int {
+	n := int(d.int32())
+	if n > len(d.b) && d.err == nil {
+		// Each element takes at least one byte.
+		d.err = errKafkaShort
+	}
+	if d.err != nil {
+		return 0
+	}
+	return n
+}
+
+func (d *kafkaDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errKafkaShort
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *kafkaDecoder) varbytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	return d.next(int(n))
+}
+
+// A kafkaRecord is a record produced to a Kafka topic partition.
+type kafkaRecord struct {
+	key, value []byte
+	time       time.Time
+}
+
+const (
+	kafkaCompressionGzip  = 1
+	kafkaRecordBatchMagic = 2
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// appendRecordBatch appends a version 2 record batch holding records to
+// e, compressing the records with gzip if compress is true.
+func appendRecordBatch(e *kafkaEncoder, records []kafkaRecord, compress bool) {
+	base := records[0].time.UnixNano() / int64(time.Millisecond)
+	max := base
+	var re kafkaEncoder
+	var rec kafkaEncoder
+	for i, r := range records {
+		ts := r.time.UnixNano() / int64(time.Millisecond)
+		if ts > max {
+			max = ts
+		}
+		rec.b = rec.b[:0]
+		rec.int8(0) // attributes
+		rec.varint(ts - base)
+		rec.varint(int64(i))
+		rec.varbytes(r.key)
+		rec.varbytes(r.value)
+		rec.varint(0) // headers
+		re.varint(int64(len(rec.b)))
+		re.b = append(re.b, rec.b...)
+	}
+	var attributes int16
+	if compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(re.b)
+		zw.Close()
+		re.b = buf.Bytes()
+		attributes = kafkaCompressionGzip
+	}
+
+	e.int64(0) // base offset
+	lengthAt := len(e.b)
+	e.int32(0)  // batch length, set below
+	e.int32(-1) // partition leader epoch
+	e.int8(kafkaRecordBatchMagic)
+	crcAt := len(e.b)
+	e.int32(0) // CRC, set below
+	e.int16(attributes)
+	e.int32(int32(len(records) - 1)) // last offset delta
+	e.int64(base)
+	e.int64(max)
+	e.int64(-1) // producer ID
+	e.int16(-1) // producer epoch
+	e.int32(-1) // base sequence
+	e.int32(int32(len(records)))
+	e.b = append(e.b, re.b...)
+	binary.BigEndian.PutUint32(e.b[lengthAt:], uint32(len(e.b)-lengthAt-4))
+	binary.BigEndian.PutUint32(e.b[crcAt:], crc32.Checksum(e.b[crcAt+4:], crc32c))
+}
+
+// kafkaMurmur2 is the murmur2 hash used by the default partitioner of the
+// Kafka Java client, so that records with the same key are produced to
+// the same partition as by other producers.
+func kafkaMurmur2(data []byte) int32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+	n := len(data)
+	h := uint32(seed) ^ uint32(n)
+	for i := 0; i+4 <= n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[n&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// A kafkaConn is a connection to a Kafka broker.
+type kafkaConn struct {
+	addr        string
+	conn        net.Conn
+	r           *bufio.Reader
+	clientID    string
+	correlation int32
+	timeout     time.Duration
+}
+
+func dialKafka(addr, clientID string, timeout time.Duration, tc *tls.Config) (*kafkaConn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if tc != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tc)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaConn{
+		addr:     addr,
+		conn:     conn,
+		r:        bufio.NewReader(conn),
+		clientID: clientID,
+		timeout:  timeout,
+	}, nil
+}
+
+// roundTrip sends a request with the given API key, version, and body,
+// and returns the body of the response. If noResponse is true, as for a
+// Produce request not requiring acknowledgement, roundTrip returns once
+// the request is sent.
+func (c *kafkaConn) roundTrip(key, version int16, body []byte, noResponse bool) ([]byte, error) {
+	c.correlation++
+	e := &kafkaEncoder{b: make([]byte, 4, 4+14+len(c.clientID)+len(body))}
+	e.int16(key)
+	e.int16(version)
+	e.int32(c.correlation)
+	e.string(c.clientID)
+	e.b = append(e.b, body...)
+	binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := c.conn.Write(e.b); err != nil {
+		return nil, err
+	}
+	if noResponse {
+		return nil, nil
+	}
+	var hdr [8]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return nil, err
+	}
+	size := int32(binary.BigEndian.Uint32(hdr[:]))
+	if size < 4 || size > 64<<20 {
+		return nil, fmt.Errorf("invalid Kafka response size %d", size)
+	}
+	if id := int32(binary.BigEndian.Uint32(hdr[4:])); id != c.correlation {
+		return nil, fmt.Errorf("Kafka response correlation ID %d, expected %d", id, c.correlation)
+	}
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *kafkaConn) Close() error {
+	return c.conn.Close()
+}
+
+// kafkaMetadata holds the brokers and topic partition leaders returned by
+// a Metadata request.
+type kafkaMetadata struct {
+	brokers map[int32]string // node ID to address
+	// leaders holds the leader node ID of each partition of each topic,
+	// or -1 if the partition has no leader.
+	leaders map[string][]int32
+	errs    map[string]error
+}
+
+// metadata requests the metadata of topics.
+func (c *kafkaConn) metadata(topics []string) (*kafkaMetadata, error) {
+	e := &kafkaEncoder{}
+	e.int32(int32(len(topics)))
+	for _, t := range topics {
+		e.string(t)
+	}
+	resp, err := c.roundTrip(kafkaMetadataKey, 1, e.b, false)
+	if err != nil {
+		return nil, err
+	}
+	return parseKafkaMetadata(resp)
+}
+
+func parseKafkaMetadata(resp []byte) (*kafkaMetadata, error) {
+	md := &kafkaMetadata{
+		brokers: make(map[int32]string),
+		leaders: make(map[string][]int32),
+		errs:    make(map[string]error),
+	}
+	d := &kafkaDecoder{b: resp}
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		md.brokers[id] = net.JoinHostPort(host, fmt.Sprint(port))
+	}
+	d.int32() // controller ID
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		code := d.int16()
+		topic := d.string()
+		d.int8() // is internal
+		np := d.arrayLen()
+		leaders := make([]int32, np)
+		for j := 0; j < np; j++ {
+			d.int16() // partition error code
+			p := d.int32()
+			leader := d.int32()
+			for k, nr := 0, d.arrayLen(); k < nr; k++ {
+				d.int32() // replica
+			}
+			for k, ni := 0, d.arrayLen(); k < ni; k++ {
+				d.int32() // in-sync replica
+			}
+			if p >= 0 && int(p) < np {
+				leaders[p] = leader
+			}
+		}
+		if code != 0 {
+			md.errs[topic] = kafkaError(code)
+			continue
+		}
+		md.leaders[topic] = leaders
+	}
+	return md, d.err
+}
+
+// A kafkaPartition identifies a topic partition.
+type kafkaPartition struct {
+	topic     string
+	partition int32
+}
+
+// produce sends the record batches to the partitions they are keyed by,
+// all of which are led by the broker c is connected to, and returns the
+// error for each partition. If acks is zero, the broker sends no response,
+// and the errors are nil if the request was sent.
+func (c *kafkaConn) produce(batches map[kafkaPartition][]byte, acks int16) (map[kafkaPartition]error, error) {
+	topics := make(map[string][]int32)
+	var order []string
+	for tp := range batches {
+		if topics[tp.topic] == nil {
+			order = append(order, tp.topic)
+		}
+		topics[tp.topic] = append(topics[tp.topic], tp.partition)
+	}
+
+	e := &kafkaEncoder{}
+	e.int16(-1) // null transactional ID
+	e.int16(acks)
+	e.int32(int32(c.timeout / time.Millisecond))
+	e.int32(int32(len(order)))
+	for _, t := range order {
+		e.string(t)
+		e.int32(int32(len(topics[t])))
+		for _, p := range topics[t] {
+			e.int32(p)
+			e.bytes(batches[kafkaPartition{t, p}])
+		}
+	}
+	resp, err := c.roundTrip(kafkaProduceKey, 3, e.b, acks == 0)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[kafkaPartition]error)
+	if acks == 0 {
+		for tp := range batches {
+			results[tp] = nil
+		}
+		return results, nil
+	}
+
+	d := &kafkaDecoder{b: resp}
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		topic := d.string()
+		for j, np := 0, d.arrayLen(); j < np; j++ {
+			p := d.int32()
+			code := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if code != 0 {
+				results[kafkaPartition{topic, p}] = kafkaError(code)
+			} else {
+				results[kafkaPartition{topic, p}] = nil
+			}
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	for tp := range batches {
+		if _, ok := results[tp]; !ok {
+			results[tp] = errors.New("partition missing from Kafka response")
+		}
+	}
+	return results, nil
+}
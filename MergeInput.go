@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"container/heap"
+	"io"
+	"os"
+	"time"
+)
+
+// messageTime returns the time of the event recorded in dt: the query
+// time for query messages and the response time for response messages,
+// falling back to the other if the preferred time is absent.
+func messageTime(dt *Dnstap) (time.Time, bool) {
+	m := dt.GetMessage()
+	if m == nil {
+		return time.Time{}, false
+	}
+	qt := m.QueryTimeSec != nil
+	rt := m.ResponseTimeSec != nil
+	if rt && (!qt || m.Type != nil && !isQueryType(*m.Type)) {
+		return time.Unix(int64(*m.ResponseTimeSec), int64(m.GetResponseTimeNsec())), true
+	}
+	if qt {
+		return time.Unix(int64(*m.QueryTimeSec), int64(m.GetQueryTimeNsec())), true
+	}
+	return time.Time{}, false
+}
+
+// A MergeInput reads dnstap data from several sources and presents it in
+// timestamp order.
+//
+// MergeInput assumes that each source is in timestamp order, as files
+// written by a single DNS server are. Frames without a timestamp are
+// presented in their original position relative to the other frames of
+// their source.
+type MergeInput struct {
+	wait    chan bool
+	readers []Reader
+	closers []io.Closer
+	dedup   bool
+	log     Logger
+}
+
+// NewMergeInput creates a MergeInput merging the dnstap data read from
+// the given Readers. Readers which are also io.Closers are closed when
+// the MergeInput finishes.
+func NewMergeInput(readers ...Reader) *MergeInput {
+	return &MergeInput{
+		wait:    make(chan bool),
+		readers: readers,
+		log:     nullLogger{},
+	}
+}
+
+// NewMergeInputFromFilenames creates a MergeInput merging the dnstap data
+// in the named Frame Streams files.
+func NewMergeInputFromFilenames(fnames ...string) (*MergeInput, error) {
+	mi := NewMergeInput()
+	for _, fname := range fnames {
+		f, err := os.Open(fname)
+		if err != nil {
+			mi.close()
+			return nil, err
+		}
+		r, err := NewReader(f, nil)
+		if err != nil {
+			f.Close()
+			mi.close()
+			return nil, err
+		}
+		mi.readers = append(mi.readers, r)
+		mi.closers = append(mi.closers, f)
+	}
+	return mi, nil
+}
+
+// SetLogger configures a logger for MergeInput read error reporting.
+func (mi *MergeInput) SetLogger(logger Logger) {
+	mi.log = logger
+}
+
+// SetDeduplicate configures whether the MergeInput discards frames
+// identical to a frame already presented with the same timestamp, as
+// happens when captures of the same traffic are merged. Deduplication is
+// disabled by default.
+func (mi *MergeInput) SetDeduplicate(dedup bool) {
+	mi.dedup = dedup
+}
+
+func (mi *MergeInput) close() {
+	for _, r := range mi.readers {
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+	}
+	for _, c := range mi.closers {
+		c.Close()
+	}
+}
+
+type mergeSource struct {
+	r     Reader
+	index int
+	frame []byte
+	t     time.Time
+}
+
+// next reads the next frame from the source, returning false at the end
+// of the source's data.
+func (ms *mergeSource) next(buf []byte, log Logger) bool {
+	n, err := ms.r.ReadFrame(buf)
+	if err != nil {
+		if err != io.EOF {
+			log.Printf("MergeInput: input %d: Read error: %v", ms.index, err)
+		}
+		return false
+	}
+	ms.frame = make([]byte, n)
+	copy(ms.frame, buf)
+
+	if t, ok := frameTime(ms.frame); ok {
+		ms.t = t
+	}
+	return true
+}
+
+type mergeHeap []*mergeSource
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].t.Equal(h[j].t) {
+		return h[i].index < h[j].index
+	}
+	return h[i].t.Before(h[j].t)
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*mergeSource)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	ms := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return ms
+}
+
+// ReadInto reads data from all of the MergeInput's sources into the output
+// channel in timestamp order.
+//
+// ReadInto satisfies the dnstap Input interface.
+func (mi *MergeInput) ReadInto(output chan []byte) {
+	buf := make([]byte, MaxPayloadSize)
+	h := make(mergeHeap, 0, len(mi.readers))
+	for i, r := range mi.readers {
+		ms := &mergeSource{r: r, index: i}
+		if ms.next(buf, mi.log) {
+			h = append(h, ms)
+		}
+	}
+	heap.Init(&h)
+
+	var last time.Time
+	var duplicates uint64
+	seen := make(map[string]bool)
+	for h.Len() > 0 {
+		ms := h[0]
+		frame := ms.frame
+		if mi.dedup {
+			if !ms.t.Equal(last) {
+				last = ms.t
+				seen = make(map[string]bool)
+			}
+			if seen[string(frame)] {
+				duplicates++
+				frame = nil
+			} else {
+				seen[string(frame)] = true
+			}
+		}
+		if frame != nil {
+			output <- frame
+		}
+		if ms.next(buf, mi.log) {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	if duplicates > 0 {
+		mi.log.Printf("MergeInput: discarded %d duplicate frames", duplicates)
+	}
+	mi.close()
+	close(mi.wait)
+}
+
+// Wait returns when ReadInto has finished.
+//
+// Wait satisfies the dnstap Input interface.
+func (mi *MergeInput) Wait() {
+	<-mi.wait
+}
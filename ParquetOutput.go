@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ParquetOutputOptions specifies configuration for a ParquetOutput.
+type ParquetOutputOptions struct {
+	// Writer configures the ParquetWriter of each file.
+	Writer ParquetOptions
+	// MaxRows, if non-zero, limits the number of rows written to each
+	// file.
+	MaxRows int64
+	// MaxAge, if non-zero, limits the time each file is open for
+	// writing, counted from its first row.
+	MaxAge time.Duration
+	// Create opens the nth (counting from zero) file, when its first row
+	// is written. If the returned io.Writer is also an io.Closer, the
+	// ParquetOutput closes it after completing the file.
+	Create func(n int) (io.Writer, error)
+	// Logger receives messages which cannot be decoded and file errors.
+	Logger Logger
+}
+
+// A ParquetOutput is a dnstap Output writing the messages it receives to
+// a series of Parquet files with ParquetWriter, starting a new file when
+// the configured limits are reached. No file is created until there is a
+// message to write.
+type ParquetOutput struct {
+	opt           ParquetOutputOptions
+	outputChannel chan []byte
+	wait          chan bool
+	pool          *FramePool
+
+	n       int
+	pw      *ParquetWriter
+	wc      io.Writer
+	opened  time.Time
+	discard bool // the current file failed
+}
+
+// NewParquetOutput creates a ParquetOutput with the given options. The
+// Create option must be set.
+func NewParquetOutput(opt *ParquetOutputOptions) (*ParquetOutput, error) {
+	if opt == nil || opt.Create == nil {
+		return nil, errors.New("ParquetOutput requires a Create function")
+	}
+	o := &ParquetOutput{
+		opt:           *opt,
+		outputChannel: make(chan []byte, outputChannelSize),
+		wait:          make(chan bool),
+	}
+	if o.opt.Logger == nil {
+		o.opt.Logger = nullLogger{}
+	}
+	return o, nil
+}
+
+// SetFramePool configures the ParquetOutput to return the buffers of the
+// frames it has written to pool.
+func (o *ParquetOutput) SetFramePool(pool *FramePool) {
+	o.pool = pool
+}
+
+// GetOutputChannel returns the channel on which the ParquetOutput accepts
+// dnstap data.
+//
+// GetOutputChannel satisfies the dnstap Output interface.
+func (o *ParquetOutput) GetOutputChannel() chan []byte {
+	return o.outputChannel
+}
+
+// RunOutputLoop writes the data received on the output channel, returning
+// after Close is called and the last file has been completed.
+//
+// RunOutputLoop satisfies the dnstap Output interface.
+func (o *ParquetOutput) RunOutputLoop() {
+	var tick <-chan time.Time
+	if o.opt.MaxAge > 0 {
+		t := time.NewTicker(o.opt.MaxAge / 10)
+		defer t.Stop()
+		tick = t.C
+	}
+	dt := &Dnstap{}
+	for {
+		select {
+		case frame, ok := <-o.outputChannel:
+			if !ok {
+				o.close()
+				close(o.wait)
+				return
+			}
+			err := proto.Unmarshal(frame, dt)
+			o.pool.Put(frame)
+			if err != nil {
+				o.opt.Logger.Printf("ParquetOutput: proto.Unmarshal() failed: %s", err)
+				continue
+			}
+			o.write(dt)
+		case <-tick:
+			if o.pw != nil && time.Since(o.opened) >= o.opt.MaxAge {
+				o.close()
+			}
+		}
+	}
+}
+
+// Close closes the ParquetOutput's output channel and returns after the
+// last file has been completed.
+//
+// Close satisfies the dnstap Output interface.
+func (o *ParquetOutput) Close() {
+	close(o.outputChannel)
+	<-o.wait
+}
+
+func (o *ParquetOutput) write(dt *Dnstap) {
+	if o.pw == nil {
+		wc, err := o.opt.Create(o.n)
+		o.n++
+		if err != nil {
+			o.opt.Logger.Printf("ParquetOutput: %v", err)
+			return
+		}
+		o.wc = wc
+		o.pw = NewParquetWriter(wc, &o.opt.Writer)
+		o.opened = time.Now()
+		o.discard = false
+	}
+	if o.discard {
+		return
+	}
+	if err := o.pw.Write(dt); err != nil {
+		o.opt.Logger.Printf("ParquetOutput: write failed: %v", err)
+		o.discard = true
+	}
+	if o.opt.MaxRows > 0 && o.pw.Rows() >= o.opt.MaxRows {
+		o.close()
+	}
+}
+
+// close completes and closes the current file, if any.
+func (o *ParquetOutput) close() {
+	if o.pw == nil {
+		return
+	}
+	if err := o.pw.Close(); err != nil && !o.discard {
+		o.opt.Logger.Printf("ParquetOutput: write failed: %v", err)
+	}
+	if c, ok := o.wc.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			o.opt.Logger.Printf("ParquetOutput: %v", err)
+		}
+	}
+	o.pw, o.wc = nil, nil
+}
@@ -0,0 +1,736 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// This file implements the subset of the Apache Parquet format needed to
+// write dnstap messages as flat rows: a schema of optional columns of the
+// BOOLEAN, INT32, INT64, and BYTE_ARRAY types, each row group column
+// written as a single version 1 data page in the PLAIN encoding, with
+// definition levels in the RLE/bit-packed hybrid encoding, and the file
+// metadata in the Thrift compact protocol, as described at
+// https://parquet.apache.org/docs/file-format/.
+
+// A ParquetCompression is the compression codec of the pages written by a
+// ParquetWriter.
+type ParquetCompression int
+
+const (
+	ParquetUncompressed ParquetCompression = iota
+	ParquetGzip
+)
+
+// ParquetOptions specifies configuration for a ParquetWriter.
+type ParquetOptions struct {
+	// RowGroupSize is the number of rows buffered in memory and written
+	// together as a row group. The default is 100000.
+	RowGroupSize int
+	// Compression is the compression of the column data.
+	Compression ParquetCompression
+}
+
+// Parquet physical types, repetition types, converted types, encodings,
+// codecs, and page types.
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetCodecGzip = 2
+
+	parquetDataPage = 0
+)
+
+var parquetMagic = []byte("PAR1")
+
+// parquetSchema holds the columns written by a ParquetWriter, each of
+// which is optional. The indexes of the columns are given by the pq
+// constants below.
+var parquetSchema = []struct {
+	name      string
+	typ       int32
+	converted int32 // -1 if none
+}{
+	{"time", parquetInt64, parquetTimestampMicros},
+	{"identity", parquetByteArray, parquetUTF8},
+	{"type", parquetByteArray, parquetUTF8},
+	{"socket_family", parquetByteArray, parquetUTF8},
+	{"socket_protocol", parquetByteArray, parquetUTF8},
+	{"query_address", parquetByteArray, parquetUTF8},
+	{"query_port", parquetInt32, -1},
+	{"response_address", parquetByteArray, parquetUTF8},
+	{"response_port", parquetInt32, -1},
+	{"query_zone", parquetByteArray, parquetUTF8},
+	{"query_time", parquetInt64, parquetTimestampMicros},
+	{"response_time", parquetInt64, parquetTimestampMicros},
+	{"query_size", parquetInt32, -1},
+	{"response_size", parquetInt32, -1},
+	{"id", parquetInt32, -1},
+	{"qname", parquetByteArray, parquetUTF8},
+	{"qtype", parquetByteArray, parquetUTF8},
+	{"qclass", parquetByteArray, parquetUTF8},
+	{"rcode", parquetByteArray, parquetUTF8},
+	{"aa", parquetBoolean, -1},
+	{"tc", parquetBoolean, -1},
+	{"rd", parquetBoolean, -1},
+	{"ra", parquetBoolean, -1},
+	{"ad", parquetBoolean, -1},
+	{"cd", parquetBoolean, -1},
+	{"answer_count", parquetInt32, -1},
+	{"authority_count", parquetInt32, -1},
+	{"additional_count", parquetInt32, -1},
+}
+
+const (
+	pqTime = iota
+	pqIdentity
+	pqType
+	pqSocketFamily
+	pqSocketProtocol
+	pqQueryAddress
+	pqQueryPort
+	pqResponseAddress
+	pqResponsePort
+	pqQueryZone
+	pqQueryTime
+	pqResponseTime
+	pqQuerySize
+	pqResponseSize
+	pqID
+	pqQname
+	pqQtype
+	pqQclass
+	pqRcode
+	pqAA
+	pqTC
+	pqRD
+	pqRA
+	pqAD
+	pqCD
+	pqAnswerCount
+	pqAuthorityCount
+	pqAdditionalCount
+)
+
+// A parquetColumn buffers the values of a column for a row group.
+type parquetColumn struct {
+	levels   []uint8 // definition levels: 1 for a value, 0 for null
+	values   []byte  // PLAIN-encoded values, except booleans
+	bools    []bool
+	nulls    int64
+	min, max int64 // of integer values
+}
+
+func (c *parquetColumn) null() {
+	c.levels = append(c.levels, 0)
+	c.nulls++
+}
+
+func (c *parquetColumn) integer(v int64) {
+	if len(c.levels) == int(c.nulls) || v < c.min {
+		c.min = v
+	}
+	if len(c.levels) == int(c.nulls) || v > c.max {
+		c.max = v
+	}
+	c.levels = append(c.levels, 1)
+}
+
+func (c *parquetColumn) int32(v int32) {
+	c.integer(int64(v))
+	c.values = binary.LittleEndian.AppendUint32(c.values, uint32(v))
+}
+
+func (c *parquetColumn) int64(v int64) {
+	c.integer(v)
+	c.values = binary.LittleEndian.AppendUint64(c.values, uint64(v))
+}
+
+func (c *parquetColumn) string(s string) {
+	c.levels = append(c.levels, 1)
+	c.values = binary.LittleEndian.AppendUint32(c.values, uint32(len(s)))
+	c.values = append(c.values, s...)
+}
+
+func (c *parquetColumn) bool(v bool) {
+	c.levels = append(c.levels, 1)
+	c.bools = append(c.bools, v)
+}
+
+func (c *parquetColumn) optString(s string) {
+	if s == "" {
+		c.null()
+		return
+	}
+	c.string(s)
+}
+
+func (c *parquetColumn) time(t time.Time, ok bool) {
+	if !ok {
+		c.null()
+		return
+	}
+	c.int64(t.UnixNano() / int64(time.Microsecond))
+}
+
+func (c *parquetColumn) reset() {
+	c.levels = c.levels[:0]
+	c.values = c.values[:0]
+	c.bools = c.bools[:0]
+	c.nulls = 0
+}
+
+// appendPage appends the data of the column's page, its definition levels
+// and values, to b.
+func (c *parquetColumn) appendPage(b []byte) []byte {
+	start := len(b)
+	b = append(b, 0, 0, 0, 0)
+	b = appendParquetLevels(b, c.levels)
+	binary.LittleEndian.PutUint32(b[start:], uint32(len(b)-start-4))
+	if len(c.bools) == 0 {
+		return append(b, c.values...)
+	}
+	// Booleans are bit-packed, least significant bit first.
+	for i := 0; i < len(c.bools); i += 8 {
+		var v byte
+		for j := 0; j < 8 && i+j < len(c.bools); j++ {
+			if c.bools[i+j] {
+				v |= 1 << j
+			}
+		}
+		b = append(b, v)
+	}
+	return b
+}
+
+// appendParquetLevels appends levels, each 0 or 1, in the RLE/bit-packed
+// hybrid encoding with a bit width of 1. Runs of at least 8 equal levels
+// are run-length encoded, and others bit-packed in groups of 8.
+func appendParquetLevels(b []byte, levels []uint8) []byte {
+	run := func(i int) int {
+		n := 1
+		for i+n < len(levels) && levels[i+n] == levels[i] {
+			n++
+		}
+		return n
+	}
+	for i := 0; i < len(levels); {
+		if n := run(i); n >= 8 || i+n == len(levels) {
+			b = binary.AppendUvarint(b, uint64(n)<<1)
+			b = append(b, levels[i])
+			i += n
+			continue
+		}
+		// At most 63 groups, so that the header is a single byte. The
+		// last group may be padded.
+		hdr := len(b)
+		b = append(b, 0)
+		groups := 0
+		for groups < 63 && i < len(levels) && (groups == 0 || run(i) < 8) {
+			var v byte
+			for j := 0; j < 8 && i+j < len(levels); j++ {
+				v |= levels[i+j] << j
+			}
+			b = append(b, v)
+			groups++
+			i += 8
+		}
+		b[hdr] = byte(groups<<1 | 1)
+	}
+	return b
+}
+
+// A parquetChunk describes a column chunk written to the file.
+type parquetChunk struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+	nulls        int64
+	min, max     int64
+}
+
+type parquetRowGroup struct {
+	chunks []parquetChunk
+	rows   int64
+	bytes  int64
+}
+
+// A ParquetWriter writes dnstap messages to an Apache Parquet file, one
+// row per message, with a flat schema of columns holding the fields of the
+// Message and the header and question of its DNS message:
+//
+//	time               timestamp (µs)  the query time of query messages,
+//	                                   the response time of responses
+//	identity           string
+//	type               string          message type, e.g. CLIENT_QUERY
+//	socket_family      string          INET or INET6
+//	socket_protocol    string          UDP, TCP, DOT, DOH, ...
+//	query_address      string
+//	query_port         int32
+//	response_address   string
+//	response_port      int32
+//	query_zone         string
+//	query_time         timestamp (µs)
+//	response_time      timestamp (µs)
+//	query_size         int32           size of the query message
+//	response_size      int32           size of the response message
+//	id                 int32           DNS message ID
+//	qname              string
+//	qtype              string          e.g. AAAA
+//	qclass             string          e.g. IN
+//	rcode              string          e.g. NXDOMAIN, for responses
+//	aa, tc, rd,
+//	ra, ad, cd         boolean         DNS header flags
+//	answer_count       int32
+//	authority_count    int32
+//	additional_count   int32
+//
+// The DNS fields are those of the query message of query types and the
+// response message of response types. All columns are optional, and are
+// null when the field is absent.
+//
+// The file is written sequentially, so the writer need not be seekable.
+// It is complete only once Close has been called.
+type ParquetWriter struct {
+	w         io.Writer
+	opt       ParquetOptions
+	off       int64
+	err       error
+	cols      []parquetColumn
+	rows      int64
+	total     int64
+	rowGroups []parquetRowGroup
+
+	page []byte
+	zbuf bytes.Buffer
+	zw   *gzip.Writer
+}
+
+// NewParquetWriter creates a ParquetWriter writing to w with the given
+// options.
+func NewParquetWriter(w io.Writer, opt *ParquetOptions) *ParquetWriter {
+	pw := &ParquetWriter{
+		w:    w,
+		cols: make([]parquetColumn, len(parquetSchema)),
+	}
+	if opt != nil {
+		pw.opt = *opt
+	}
+	if pw.opt.RowGroupSize <= 0 {
+		pw.opt.RowGroupSize = 100000
+	}
+	return pw
+}
+
+// Rows returns the number of rows written so far, including those
+// buffered in the current row group.
+func (pw *ParquetWriter) Rows() int64 {
+	return pw.total + pw.rows
+}
+
+// Write adds a row for the message dt, writing a row group when the
+// configured number of rows is buffered.
+func (pw *ParquetWriter) Write(dt *Dnstap) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	c := pw.cols
+	m := dt.GetMessage()
+	if m == nil {
+		m = &Message{}
+	}
+	c[pqTime].time(messageTime(dt))
+	c[pqIdentity].optString(strings.ToValidUTF8(string(dt.Identity), "\uFFFD"))
+	if m.Type != nil {
+		c[pqType].string(m.Type.String())
+	} else {
+		c[pqType].null()
+	}
+	if m.SocketFamily != nil {
+		c[pqSocketFamily].string(m.SocketFamily.String())
+	} else {
+		c[pqSocketFamily].null()
+	}
+	if m.SocketProtocol != nil {
+		c[pqSocketProtocol].string(m.SocketProtocol.String())
+	} else {
+		c[pqSocketProtocol].null()
+	}
+	pw.address(pqQueryAddress, m.QueryAddress)
+	pw.port(pqQueryPort, m.QueryPort)
+	pw.address(pqResponseAddress, m.ResponseAddress)
+	pw.port(pqResponsePort, m.ResponsePort)
+	zone := ""
+	if len(m.QueryZone) > 0 {
+		zone, _, _ = dns.UnpackDomainName(m.QueryZone, 0)
+	}
+	c[pqQueryZone].optString(zone)
+	c[pqQueryTime].time(time.Unix(int64(m.GetQueryTimeSec()), int64(m.GetQueryTimeNsec())), m.QueryTimeSec != nil)
+	c[pqResponseTime].time(time.Unix(int64(m.GetResponseTimeSec()), int64(m.GetResponseTimeNsec())), m.ResponseTimeSec != nil)
+	pw.size(pqQuerySize, m.QueryMessage)
+	pw.size(pqResponseSize, m.ResponseMessage)
+
+	wire := m.ResponseMessage
+	if isQueryType(m.GetType()) {
+		wire = m.QueryMessage
+	}
+	if h, err := ParseDNSHeader(wire); err == nil {
+		c[pqID].int32(int32(h.ID))
+		for i, flag := range []uint16{0x0400, 0x0200, 0x0100, 0x0080, 0x0020, 0x0010} {
+			c[pqAA+i].bool(h.Flags&flag != 0)
+		}
+		c[pqAnswerCount].int32(int32(h.ANCount))
+		c[pqAuthorityCount].int32(int32(h.NSCount))
+		c[pqAdditionalCount].int32(int32(h.ARCount))
+		if h.Response() {
+			name, ok := dns.RcodeToString[h.Rcode()]
+			c[pqRcode].string(parquetName(name, ok, "RCODE", h.Rcode()))
+		} else {
+			c[pqRcode].null()
+		}
+	} else {
+		for _, i := range []int{pqID, pqAA, pqTC, pqRD, pqRA, pqAD, pqCD,
+			pqAnswerCount, pqAuthorityCount, pqAdditionalCount, pqRcode} {
+			c[i].null()
+		}
+	}
+	if q, err := ParseDNSQuestion(wire); err == nil {
+		c[pqQname].string(q.Name)
+		name, ok := dns.TypeToString[q.Qtype]
+		c[pqQtype].string(parquetName(name, ok, "TYPE", int(q.Qtype)))
+		name, ok = dns.ClassToString[q.Qclass]
+		c[pqQclass].string(parquetName(name, ok, "CLASS", int(q.Qclass)))
+	} else {
+		c[pqQname].null()
+		c[pqQtype].null()
+		c[pqQclass].null()
+	}
+
+	pw.rows++
+	if pw.rows >= int64(pw.opt.RowGroupSize) {
+		return pw.flush()
+	}
+	return nil
+}
+
+// parquetName returns name if ok, or otherwise the generic form of code,
+// as in "TYPE65534".
+func parquetName(name string, ok bool, prefix string, code int) string {
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("%s%d", prefix, code)
+}
+
+func (pw *ParquetWriter) address(col int, ip []byte) {
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		pw.cols[col].null()
+		return
+	}
+	pw.cols[col].string(net.IP(ip).String())
+}
+
+func (pw *ParquetWriter) port(col int, port *uint32) {
+	if port == nil {
+		pw.cols[col].null()
+		return
+	}
+	pw.cols[col].int32(int32(*port))
+}
+
+func (pw *ParquetWriter) size(col int, msg []byte) {
+	if msg == nil {
+		pw.cols[col].null()
+		return
+	}
+	pw.cols[col].int32(int32(len(msg)))
+}
+
+func (pw *ParquetWriter) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.off += int64(n)
+	pw.err = err
+}
+
+// flush writes the buffered rows as a row group.
+func (pw *ParquetWriter) flush() error {
+	if pw.rows == 0 || pw.err != nil {
+		return pw.err
+	}
+	if pw.off == 0 {
+		pw.write(parquetMagic)
+	}
+	rg := parquetRowGroup{rows: pw.rows}
+	for i := range pw.cols {
+		c := &pw.cols[i]
+		pw.page = c.appendPage(pw.page[:0])
+		data := pw.page
+		if pw.opt.Compression == ParquetGzip {
+			pw.zbuf.Reset()
+			if pw.zw == nil {
+				pw.zw = gzip.NewWriter(&pw.zbuf)
+			} else {
+				pw.zw.Reset(&pw.zbuf)
+			}
+			pw.zw.Write(data)
+			pw.zw.Close()
+			data = pw.zbuf.Bytes()
+		}
+		hdr := &thriftEncoder{}
+		hdr.i32(1, parquetDataPage)
+		hdr.i32(2, int32(len(pw.page)))
+		hdr.i32(3, int32(len(data)))
+		hdr.beginStruct(5)
+		hdr.i32(1, int32(pw.rows))
+		hdr.i32(2, parquetPlain)
+		hdr.i32(3, parquetRLE)
+		hdr.i32(4, parquetRLE)
+		hdr.endStruct()
+		hdr.end()
+
+		rg.chunks = append(rg.chunks, parquetChunk{
+			offset:       pw.off,
+			uncompressed: int64(len(hdr.b) + len(pw.page)),
+			compressed:   int64(len(hdr.b) + len(data)),
+			nulls:        c.nulls,
+			min:          c.min,
+			max:          c.max,
+		})
+		rg.bytes += int64(len(hdr.b) + len(pw.page))
+		pw.write(hdr.b)
+		pw.write(data)
+		c.reset()
+	}
+	pw.rowGroups = append(pw.rowGroups, rg)
+	pw.total += pw.rows
+	pw.rows = 0
+	return pw.err
+}
+
+// Close writes the buffered rows and the file metadata, completing the
+// file. It does not close the underlying writer.
+func (pw *ParquetWriter) Close() error {
+	if err := pw.flush(); err != nil {
+		return err
+	}
+	if pw.off == 0 {
+		pw.write(parquetMagic)
+	}
+	meta := pw.metadata()
+	pw.write(meta)
+	pw.write(binary.LittleEndian.AppendUint32(nil, uint32(len(meta))))
+	pw.write(parquetMagic)
+	if pw.err == nil {
+		pw.err = errParquetClosed
+		return nil
+	}
+	return pw.err
+}
+
+var errParquetClosed = errors.New("ParquetWriter closed")
+
+// metadata returns the encoded FileMetaData of the file.
+func (pw *ParquetWriter) metadata() []byte {
+	e := &thriftEncoder{}
+	e.i32(1, 1) // version
+	e.list(2, thriftStruct, len(parquetSchema)+1)
+	e.beginElem()
+	e.binary(4, "dnstap")
+	e.i32(5, int32(len(parquetSchema)))
+	e.endStruct()
+	for _, col := range parquetSchema {
+		e.beginElem()
+		e.i32(1, col.typ)
+		e.i32(3, parquetOptional)
+		e.binary(4, col.name)
+		if col.converted >= 0 {
+			e.i32(6, col.converted)
+		}
+		e.endStruct()
+	}
+	e.i64(3, pw.total)
+
+	e.list(4, thriftStruct, len(pw.rowGroups))
+	for _, rg := range pw.rowGroups {
+		e.beginElem()
+		e.list(1, thriftStruct, len(rg.chunks))
+		for i, ch := range rg.chunks {
+			col := parquetSchema[i]
+			e.beginElem()
+			e.i64(2, ch.offset)
+			e.beginStruct(3)
+			e.i32(1, col.typ)
+			e.list(2, thriftI32, 2)
+			e.listI32(parquetPlain)
+			e.listI32(parquetRLE)
+			e.list(3, thriftBinary, 1)
+			e.listBinary(col.name)
+			if pw.opt.Compression == ParquetGzip {
+				e.i32(4, parquetCodecGzip)
+			} else {
+				e.i32(4, 0)
+			}
+			e.i64(5, rg.rows)
+			e.i64(6, ch.uncompressed)
+			e.i64(7, ch.compressed)
+			e.i64(9, ch.offset)
+			e.beginStruct(12)
+			e.i64(3, ch.nulls)
+			if ch.nulls < rg.rows && (col.typ == parquetInt32 || col.typ == parquetInt64) {
+				var min, max []byte
+				if col.typ == parquetInt32 {
+					max = binary.LittleEndian.AppendUint32(nil, uint32(ch.max))
+					min = binary.LittleEndian.AppendUint32(nil, uint32(ch.min))
+				} else {
+					max = binary.LittleEndian.AppendUint64(nil, uint64(ch.max))
+					min = binary.LittleEndian.AppendUint64(nil, uint64(ch.min))
+				}
+				e.binary(5, string(max))
+				e.binary(6, string(min))
+			}
+			e.endStruct()
+			e.endStruct()
+			e.endStruct()
+		}
+		e.i64(2, rg.bytes)
+		e.i64(3, rg.rows)
+		e.endStruct()
+	}
+	e.binary(6, "golang-dnstap")
+	// Column orders declare the min and max statistics to use the
+	// natural order of each type.
+	e.list(7, thriftStruct, len(parquetSchema))
+	for range parquetSchema {
+		e.beginElem()
+		e.beginStruct(1)
+		e.endStruct()
+		e.endStruct()
+	}
+	e.end()
+	return e.b
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// A thriftEncoder appends a struct in the Thrift compact protocol to b.
+// Field IDs are delta-encoded against the previous field of the innermost
+// struct, tracked in last.
+type thriftEncoder struct {
+	b    []byte
+	last []int16
+}
+
+func (e *thriftEncoder) field(id int16, typ byte) {
+	if len(e.last) == 0 {
+		e.last = append(e.last, 0)
+	}
+	last := &e.last[len(e.last)-1]
+	if d := id - *last; d > 0 && d <= 15 {
+		e.b = append(e.b, byte(d)<<4|typ)
+	} else {
+		e.b = append(e.b, typ)
+		e.b = binary.AppendUvarint(e.b, uint64(uint16(id<<1^id>>15)))
+	}
+	*last = id
+}
+
+func (e *thriftEncoder) i32(id int16, v int32) {
+	e.field(id, thriftI32)
+	e.listI32(v)
+}
+
+func (e *thriftEncoder) i64(id int16, v int64) {
+	e.field(id, thriftI64)
+	e.b = binary.AppendUvarint(e.b, uint64(v<<1^v>>63))
+}
+
+func (e *thriftEncoder) binary(id int16, s string) {
+	e.field(id, thriftBinary)
+	e.listBinary(s)
+}
+
+func (e *thriftEncoder) list(id int16, elem byte, n int) {
+	e.field(id, thriftList)
+	if n < 15 {
+		e.b = append(e.b, byte(n)<<4|elem)
+		return
+	}
+	e.b = append(e.b, 0xf0|elem)
+	e.b = binary.AppendUvarint(e.b, uint64(n))
+}
+
+func (e *thriftEncoder) listI32(v int32) {
+	e.b = binary.AppendUvarint(e.b, uint64(uint32(v<<1^v>>31)))
+}
+
+func (e *thriftEncoder) listBinary(s string) {
+	e.b = binary.AppendUvarint(e.b, uint64(len(s)))
+	e.b = append(e.b, s...)
+}
+
+// beginStruct begins a struct field, and beginElem a struct list element,
+// each ended by endStruct.
+func (e *thriftEncoder) beginStruct(id int16) {
+	e.field(id, thriftStruct)
+	e.last = append(e.last, 0)
+}
+
+func (e *thriftEncoder) beginElem() {
+	e.last = append(e.last, 0)
+}
+
+func (e *thriftEncoder) endStruct() {
+	e.b = append(e.b, 0)
+	e.last = e.last[:len(e.last)-1]
+}
+
+// end ends the outermost struct.
+func (e *thriftEncoder) end() {
+	e.b = append(e.b, 0)
+}
@@ -17,9 +17,6 @@
 package dnstap
 
 import (
-	"bytes"
-	"fmt"
-	"net"
 	"strconv"
 	"time"
 
@@ -28,31 +25,52 @@ import (
 
 const quietTimeFormat = "15:04:05"
 
-func textConvertTime(s *bytes.Buffer, secs *uint64, nsecs *uint32) {
+func textConvertTime(b []byte, secs *uint64, nsecs *uint32) []byte {
 	if secs != nil {
-		s.WriteString(time.Unix(int64(*secs), 0).Format(quietTimeFormat))
+		b = time.Unix(int64(*secs), 0).AppendFormat(b, quietTimeFormat)
 	} else {
-		s.WriteString("??:??:??")
+		b = append(b, "??:??:??"...)
 	}
 	if nsecs != nil {
-		s.WriteString(fmt.Sprintf(".%06d", *nsecs/1000))
+		b = append(b, '.')
+		b = appendPaddedUint(b, uint64(*nsecs/1000), 6)
 	} else {
-		s.WriteString(".??????")
+		b = append(b, ".??????"...)
 	}
+	return b
 }
 
-func textConvertIP(s *bytes.Buffer, ip []byte) {
+func textConvertIP(b []byte, ip []byte) []byte {
 	if ip != nil {
-		s.WriteString(net.IP(ip).String())
-	} else {
-		s.WriteString("MISSING_ADDRESS")
+		return appendIP(b, ip)
 	}
+	return append(b, "MISSING_ADDRESS"...)
 }
 
-func textConvertMessage(m *Message, s *bytes.Buffer) {
+// textConvertQuestion appends the first question of the DNS message in
+// wire, or "X " if it has none or the message cannot be parsed.
+func textConvertQuestion(b []byte, wire []byte) []byte {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(wire); err != nil || len(msg.Question) == 0 {
+		return append(b, "X "...)
+	}
+	q := msg.Question[0]
+	b = append(b, '"')
+	b = append(b, q.Name...)
+	b = append(b, "\" "...)
+	b = append(b, dns.Class(q.Qclass).String()...)
+	b = append(b, ' ')
+	return append(b, dns.Type(q.Qtype).String()...)
+}
+
+func textConvertMessage(b []byte, m *Message) []byte {
 	isQuery := false
 	printQueryAddress := false
 
+	if m.Type == nil {
+		return append(b, "[missing Message.Type]\n"...)
+	}
+
 	switch *m.Type {
 	case Message_CLIENT_QUERY,
 		Message_RESOLVER_QUERY,
@@ -69,59 +87,58 @@ func textConvertMessage(m *Message, s *bytes.Buffer) {
 		Message_UPDATE_RESPONSE:
 		isQuery = false
 	default:
-		s.WriteString("[unhandled Message.Type]\n")
-		return
+		return append(b, "[unhandled Message.Type]\n"...)
 	}
 
 	if isQuery {
-		textConvertTime(s, m.QueryTimeSec, m.QueryTimeNsec)
+		b = textConvertTime(b, m.QueryTimeSec, m.QueryTimeNsec)
 	} else {
-		textConvertTime(s, m.ResponseTimeSec, m.ResponseTimeNsec)
+		b = textConvertTime(b, m.ResponseTimeSec, m.ResponseTimeNsec)
 	}
-	s.WriteString(" ")
+	b = append(b, ' ')
 
 	switch *m.Type {
 	case Message_CLIENT_QUERY,
 		Message_CLIENT_RESPONSE:
 		{
-			s.WriteString("C")
+			b = append(b, 'C')
 		}
 	case Message_RESOLVER_QUERY,
 		Message_RESOLVER_RESPONSE:
 		{
-			s.WriteString("R")
+			b = append(b, 'R')
 		}
 	case Message_AUTH_QUERY,
 		Message_AUTH_RESPONSE:
 		{
-			s.WriteString("A")
+			b = append(b, 'A')
 		}
 	case Message_FORWARDER_QUERY,
 		Message_FORWARDER_RESPONSE:
 		{
-			s.WriteString("F")
+			b = append(b, 'F')
 		}
 	case Message_STUB_QUERY,
 		Message_STUB_RESPONSE:
 		{
-			s.WriteString("S")
+			b = append(b, 'S')
 		}
 	case Message_TOOL_QUERY,
 		Message_TOOL_RESPONSE:
 		{
-			s.WriteString("T")
+			b = append(b, 'T')
 		}
 	case Message_UPDATE_QUERY,
 		Message_UPDATE_RESPONSE:
 		{
-			s.WriteString("U")
+			b = append(b, 'U')
 		}
 	}
 
 	if isQuery {
-		s.WriteString("Q ")
+		b = append(b, "Q "...)
 	} else {
-		s.WriteString("R ")
+		b = append(b, "R "...)
 	}
 
 	switch *m.Type {
@@ -133,49 +150,40 @@ func textConvertMessage(m *Message, s *bytes.Buffer) {
 	}
 
 	if printQueryAddress {
-		textConvertIP(s, m.QueryAddress)
+		b = textConvertIP(b, m.QueryAddress)
 	} else {
-		textConvertIP(s, m.ResponseAddress)
+		b = textConvertIP(b, m.ResponseAddress)
 	}
-	s.WriteString(" ")
+	b = append(b, ' ')
 
 	if m.SocketProtocol != nil {
-		s.WriteString(m.SocketProtocol.String())
+		b = append(b, m.SocketProtocol.String()...)
 	}
-	s.WriteString(" ")
+	b = append(b, ' ')
 
-	var err error
-	msg := new(dns.Msg)
+	wire := m.ResponseMessage
 	if isQuery {
-		s.WriteString(strconv.Itoa(len(m.QueryMessage)))
-		s.WriteString("b ")
-		err = msg.Unpack(m.QueryMessage)
-	} else {
-		s.WriteString(strconv.Itoa(len(m.ResponseMessage)))
-		s.WriteString("b ")
-		err = msg.Unpack(m.ResponseMessage)
-	}
-
-	if err != nil || len(msg.Question) == 0 {
-		s.WriteString("X ")
-	} else {
-		s.WriteString("\"" + msg.Question[0].Name + "\" ")
-		s.WriteString(dns.Class(msg.Question[0].Qclass).String() + " ")
-		s.WriteString(dns.Type(msg.Question[0].Qtype).String())
+		wire = m.QueryMessage
 	}
+	b = strconv.AppendInt(b, int64(len(wire)), 10)
+	b = append(b, "b "...)
+	b = textConvertQuestion(b, wire)
 
-	s.WriteString("\n")
+	return append(b, '\n')
 }
 
 // TextFormat renders a dnstap message in a compact human-readable text
 // form.
 func TextFormat(dt *Dnstap) (out []byte, ok bool) {
-	var s bytes.Buffer
+	return AppendTextFormat(nil, dt)
+}
 
-	if *dt.Type == Dnstap_MESSAGE {
-		textConvertMessage(dt.Message, &s)
-		return s.Bytes(), true
+// AppendTextFormat appends the compact text form of a dnstap message
+// rendered by TextFormat to dst.
+func AppendTextFormat(dst []byte, dt *Dnstap) (out []byte, ok bool) {
+	if dt.GetType() == Dnstap_MESSAGE && dt.Message != nil {
+		return textConvertMessage(dst, dt.Message), true
 	}
 
-	return nil, false
+	return dst, false
 }
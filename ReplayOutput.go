@@ -0,0 +1,274 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// ReplayOptions specifies configuration for a ReplayOutput.
+type ReplayOptions struct {
+	// Speed is the pacing of the replay relative to the original
+	// query times: 1 replays at the original pace, 2 at twice the
+	// original pace, and so on. If Speed is zero, queries are sent as
+	// fast as the workers allow.
+	Speed float64
+	// Workers is the number of queries which may be outstanding at
+	// once. The default is one.
+	Workers int
+	// Timeout is the time allowed for each query's connection, send,
+	// and response. The default is five seconds.
+	Timeout time.Duration
+	// Network, if set to "udp" or "tcp", overrides the transport
+	// chosen by the SocketProtocol of each message.
+	Network string
+	// Identity is the identity recorded in the TOOL_QUERY and
+	// TOOL_RESPONSE messages.
+	Identity []byte
+	// Logger receives query errors and the replay summary.
+	Logger Logger
+}
+
+// A ReplayOutput is a dnstap Output which re-sends the DNS queries of the
+// CLIENT_QUERY messages it receives to a DNS server. Each exchange is
+// recorded as a TOOL_QUERY and, if a response is received, TOOL_RESPONSE
+// message sent on a results channel.
+type ReplayOutput struct {
+	server        string
+	results       chan []byte
+	opt           ReplayOptions
+	outputChannel chan []byte
+	wait          chan bool
+
+	// now and sleep pace the queries, and are replaced in tests.
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	sent, answered, failed uint64
+}
+
+type replayQuery struct {
+	network string
+	wire    []byte
+}
+
+// NewReplayOutput creates a ReplayOutput sending queries to the DNS
+// server at the given "host:port" address, and sending serialized Dnstap
+// records of the exchanges on results. If results is nil, the records are
+// discarded.
+func NewReplayOutput(server string, results chan []byte, opt *ReplayOptions) *ReplayOutput {
+	o := &ReplayOutput{
+		server:        server,
+		results:       results,
+		outputChannel: make(chan []byte, outputChannelSize),
+		wait:          make(chan bool),
+		now:           time.Now,
+		sleep:         time.Sleep,
+	}
+	if opt != nil {
+		o.opt = *opt
+	}
+	if o.opt.Workers < 1 {
+		o.opt.Workers = 1
+	}
+	if o.opt.Timeout == 0 {
+		o.opt.Timeout = 5 * time.Second
+	}
+	if o.opt.Logger == nil {
+		o.opt.Logger = nullLogger{}
+	}
+	return o
+}
+
+// GetOutputChannel returns the channel on which the ReplayOutput accepts
+// dnstap data.
+//
+// GetOutputChannel satisfies the dnstap Output interface.
+func (o *ReplayOutput) GetOutputChannel() chan []byte {
+	return o.outputChannel
+}
+
+// RunOutputLoop replays the CLIENT_QUERY messages received on the output
+// channel, pacing them according to the Speed option, and returns after
+// Close is called and all outstanding queries have completed.
+//
+// RunOutputLoop satisfies the dnstap Output interface.
+func (o *ReplayOutput) RunOutputLoop() {
+	queries := make(chan replayQuery, o.opt.Workers)
+	var wg sync.WaitGroup
+	for i := 0; i < o.opt.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			for q := range queries {
+				o.exchange(q)
+			}
+			wg.Done()
+		}()
+	}
+
+	var first, start time.Time
+	dt := &Dnstap{}
+	for frame := range o.outputChannel {
+		if err := proto.Unmarshal(frame, dt); err != nil {
+			o.opt.Logger.Printf("ReplayOutput: proto.Unmarshal() failed: %s", err)
+			continue
+		}
+		m := dt.Message
+		if dt.GetType() != Dnstap_MESSAGE || m.GetType() != Message_CLIENT_QUERY ||
+			m.QueryMessage == nil {
+			continue
+		}
+
+		if t, ok := messageTime(dt); ok && o.opt.Speed > 0 {
+			if first.IsZero() {
+				first, start = t, o.now()
+			}
+			due := start.Add(time.Duration(float64(t.Sub(first)) / o.opt.Speed))
+			if d := due.Sub(o.now()); d > 0 {
+				o.sleep(d)
+			}
+		}
+
+		network := o.opt.Network
+		if network == "" {
+			network = "udp"
+			switch m.GetSocketProtocol() {
+			case SocketProtocol_TCP, SocketProtocol_DOT, SocketProtocol_DOH:
+				network = "tcp"
+			}
+		}
+		queries <- replayQuery{network: network, wire: m.QueryMessage}
+	}
+	close(queries)
+	wg.Wait()
+
+	o.opt.Logger.Printf("ReplayOutput: %s: %d queries sent, %d answered, %d failed",
+		o.server, o.sent, o.answered, o.failed)
+	close(o.wait)
+}
+
+func (o *ReplayOutput) exchange(q replayQuery) {
+	deadline := time.Now().Add(o.opt.Timeout)
+	d := net.Dialer{Deadline: deadline}
+	c, err := d.Dial(q.network, o.server)
+	if err != nil {
+		atomic.AddUint64(&o.failed, 1)
+		o.opt.Logger.Printf("ReplayOutput: %s: %v", o.server, err)
+		return
+	}
+	defer c.Close()
+	c.SetDeadline(deadline)
+	conn := &dns.Conn{Conn: c}
+
+	qt := time.Now()
+	if _, err := conn.Write(q.wire); err != nil {
+		atomic.AddUint64(&o.failed, 1)
+		o.opt.Logger.Printf("ReplayOutput: %s: %v", o.server, err)
+		return
+	}
+	atomic.AddUint64(&o.sent, 1)
+	o.record(Message_TOOL_QUERY, c, qt, q.wire, time.Time{}, nil)
+
+	buf := make([]byte, dns.MaxMsgSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			atomic.AddUint64(&o.failed, 1)
+			o.opt.Logger.Printf("ReplayOutput: %s: %v", o.server, err)
+			return
+		}
+		// Ignore stray UDP responses to earlier queries.
+		if n < 2 || len(q.wire) < 2 ||
+			binary.BigEndian.Uint16(buf) != binary.BigEndian.Uint16(q.wire) {
+			continue
+		}
+		atomic.AddUint64(&o.answered, 1)
+		resp := make([]byte, n)
+		copy(resp, buf)
+		o.record(Message_TOOL_RESPONSE, c, qt, q.wire, time.Now(), resp)
+		return
+	}
+}
+
+// record sends a Dnstap message describing an exchange on the connection c
+// to the results channel.
+func (o *ReplayOutput) record(mt Message_Type, c net.Conn, qt time.Time, query []byte, rt time.Time, response []byte) {
+	if o.results == nil {
+		return
+	}
+
+	m := &Message{
+		Type:          mt.Enum(),
+		QueryTimeSec:  proto.Uint64(uint64(qt.Unix())),
+		QueryTimeNsec: proto.Uint32(uint32(qt.Nanosecond())),
+		QueryMessage:  query,
+	}
+	if response != nil {
+		m.ResponseTimeSec = proto.Uint64(uint64(rt.Unix()))
+		m.ResponseTimeNsec = proto.Uint32(uint32(rt.Nanosecond()))
+		m.ResponseMessage = response
+	}
+
+	var qip, rip net.IP
+	var qport, rport int
+	switch c.RemoteAddr().Network() {
+	case "udp", "udp4", "udp6":
+		m.SocketProtocol = SocketProtocol_UDP.Enum()
+		qip, qport = c.LocalAddr().(*net.UDPAddr).IP, c.LocalAddr().(*net.UDPAddr).Port
+		rip, rport = c.RemoteAddr().(*net.UDPAddr).IP, c.RemoteAddr().(*net.UDPAddr).Port
+	default:
+		m.SocketProtocol = SocketProtocol_TCP.Enum()
+		qip, qport = c.LocalAddr().(*net.TCPAddr).IP, c.LocalAddr().(*net.TCPAddr).Port
+		rip, rport = c.RemoteAddr().(*net.TCPAddr).IP, c.RemoteAddr().(*net.TCPAddr).Port
+	}
+	if ip4 := rip.To4(); ip4 != nil {
+		m.SocketFamily = SocketFamily_INET.Enum()
+		m.QueryAddress, m.ResponseAddress = qip.To4(), ip4
+	} else {
+		m.SocketFamily = SocketFamily_INET6.Enum()
+		m.QueryAddress, m.ResponseAddress = qip.To16(), rip.To16()
+	}
+	m.QueryPort = proto.Uint32(uint32(qport))
+	m.ResponsePort = proto.Uint32(uint32(rport))
+
+	b, err := proto.Marshal(&Dnstap{
+		Type:     Dnstap_MESSAGE.Enum(),
+		Identity: o.opt.Identity,
+		Message:  m,
+	})
+	if err != nil {
+		o.opt.Logger.Printf("ReplayOutput: proto.Marshal() failed: %s", err)
+		return
+	}
+	o.results <- b
+}
+
+// Close closes the output channel and returns when all queries have been
+// replayed and their results sent.
+//
+// Close satisfies the dnstap Output interface.
+func (o *ReplayOutput) Close() {
+	close(o.outputChannel)
+	<-o.wait
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"io"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// SplitOptions specifies how a SplitEncoder selects Dnstap messages and
+// divides them among output files.
+type SplitOptions struct {
+	// Start and End, if non-zero, restrict the output to messages
+	// with times in the range [Start, End). Message times are taken
+	// from the query time of query messages and the response time
+	// of response messages.
+	Start, End time.Time
+	// MaxMessages, if non-zero, limits the number of messages written
+	// to each output file.
+	MaxMessages int
+	// MaxBytes, if non-zero, limits the size of the data frames
+	// written to each output file. A file may exceed MaxBytes only if
+	// a single message does.
+	MaxBytes int64
+	// If ByIdentity is true, messages with different Identity values
+	// are written to different series of output files.
+	ByIdentity bool
+	// MaxOpenFiles limits the number of output files open at once when
+	// ByIdentity is true. Opening another file closes the least
+	// recently written one, and the next message with its identity
+	// starts a new file. The default is 256.
+	MaxOpenFiles int
+	// Create opens the nth (counting from zero) output file for
+	// messages with the given identity. The identity is always empty
+	// unless ByIdentity is true. If the returned io.Writer is also an
+	// io.Closer, the SplitEncoder closes it after writing the file's
+	// stop frame.
+	Create func(identity string, n int) (io.Writer, error)
+}
+
+type splitFile struct {
+	w        Writer
+	wc       io.Writer
+	enc      *Encoder
+	messages int
+	bytes    int64
+	used     uint64 // the SplitEncoder's clock when last written
+}
+
+// A SplitEncoder serializes Dnstap messages and writes them to a series
+// of Frame Streams files, starting a new file when the configured limits
+// are reached.
+type SplitEncoder struct {
+	opt   SplitOptions
+	files map[string]*splitFile
+	seq   map[string]int
+	clock uint64
+}
+
+// NewSplitEncoder creates a SplitEncoder using the given options. The
+// Create option must be set.
+func NewSplitEncoder(opt *SplitOptions) *SplitEncoder {
+	se := &SplitEncoder{
+		opt:   *opt,
+		files: make(map[string]*splitFile),
+		seq:   make(map[string]int),
+	}
+	if se.opt.MaxOpenFiles <= 0 {
+		se.opt.MaxOpenFiles = 256
+	}
+	return se
+}
+
+// Encode serializes the Dnstap message m and writes it to the appropriate
+// output file, opening it if needed. Messages outside the configured time
+// range are silently discarded.
+func (se *SplitEncoder) Encode(m *Dnstap) error {
+	if !se.opt.Start.IsZero() || !se.opt.End.IsZero() {
+		t, ok := messageTime(m)
+		if !ok {
+			return nil
+		}
+		if !se.opt.Start.IsZero() && t.Before(se.opt.Start) {
+			return nil
+		}
+		if !se.opt.End.IsZero() && !t.Before(se.opt.End) {
+			return nil
+		}
+	}
+
+	var identity string
+	if se.opt.ByIdentity {
+		identity = string(m.Identity)
+	}
+
+	size := int64(proto.Size(m)) + 4
+	f := se.files[identity]
+	if f != nil && f.messages > 0 &&
+		(se.opt.MaxMessages > 0 && f.messages >= se.opt.MaxMessages ||
+			se.opt.MaxBytes > 0 && f.bytes+size > se.opt.MaxBytes) {
+		delete(se.files, identity)
+		if err := f.close(); err != nil {
+			return err
+		}
+		f = nil
+	}
+
+	if f == nil {
+		if len(se.files) >= se.opt.MaxOpenFiles {
+			if err := se.closeLeastRecent(); err != nil {
+				return err
+			}
+		}
+		var err error
+		if f, err = se.open(identity); err != nil {
+			return err
+		}
+		se.files[identity] = f
+	}
+
+	if err := f.enc.Encode(m); err != nil {
+		return err
+	}
+	f.messages++
+	f.bytes += size
+	se.clock++
+	f.used = se.clock
+	return nil
+}
+
+// closeLeastRecent closes the output file least recently written.
+func (se *SplitEncoder) closeLeastRecent() error {
+	var lru *splitFile
+	var identity string
+	for id, f := range se.files {
+		if lru == nil || f.used < lru.used {
+			lru, identity = f, id
+		}
+	}
+	delete(se.files, identity)
+	return lru.close()
+}
+
+func (se *SplitEncoder) open(identity string) (*splitFile, error) {
+	n := se.seq[identity]
+	se.seq[identity] = n + 1
+	wc, err := se.opt.Create(identity, n)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(wc, nil)
+	if err != nil {
+		if c, ok := wc.(io.Closer); ok {
+			c.Close()
+		}
+		return nil, err
+	}
+	return &splitFile{w: w, wc: wc, enc: NewEncoder(w)}, nil
+}
+
+func (f *splitFile) close() error {
+	err := f.w.Close()
+	if c, ok := f.wc.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Split decodes all messages from d, encoding them with the SplitEncoder
+// until d reaches the end of its input. Split does not close the
+// SplitEncoder.
+func (se *SplitEncoder) Split(d *Decoder) error {
+	for {
+		m := &Dnstap{}
+		if err := d.Decode(m); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := se.Encode(m); err != nil {
+			return err
+		}
+	}
+}
+
+// Close writes stop frames to and closes all open output files.
+func (se *SplitEncoder) Close() error {
+	var err error
+	for identity, f := range se.files {
+		if cerr := f.close(); err == nil {
+			err = cerr
+		}
+		delete(se.files, identity)
+	}
+	return err
+}
@@ -0,0 +1,420 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// A SyslogFormat is the format of the message body of the syslog messages
+// sent by a SyslogOutput.
+type SyslogFormat int
+
+const (
+	// SyslogText sends the messages in the quiet text form rendered by
+	// TextFormat.
+	SyslogText SyslogFormat = iota
+	// SyslogJSON sends the messages in the JSON form rendered by
+	// JSONFormat.
+	SyslogJSON
+)
+
+// A SyslogFacility is a syslog facility code, as defined in RFC 5424.
+type SyslogFacility int
+
+const (
+	SyslogKern SyslogFacility = iota
+	SyslogUser
+	SyslogMail
+	SyslogDaemon
+	SyslogAuth
+	SyslogSyslog
+	SyslogLPR
+	SyslogNews
+	SyslogUUCP
+	SyslogCron
+	SyslogAuthPriv
+	SyslogFTP
+	SyslogNTP
+	SyslogAudit
+	SyslogAlert
+	SyslogClock
+	SyslogLocal0
+	SyslogLocal1
+	SyslogLocal2
+	SyslogLocal3
+	SyslogLocal4
+	SyslogLocal5
+	SyslogLocal6
+	SyslogLocal7
+)
+
+// A SyslogSeverity is a syslog severity level, as defined in RFC 5424.
+type SyslogSeverity int
+
+const (
+	SyslogEmergency SyslogSeverity = iota
+	SyslogAlertSeverity
+	SyslogCritical
+	SyslogError
+	SyslogWarning
+	SyslogNotice
+	SyslogInfo
+	SyslogDebug
+)
+
+// SyslogOptions specifies configuration for a SyslogOutput.
+type SyslogOptions struct {
+	// Format is the format of the message bodies.
+	Format SyslogFormat
+	// Facility is the facility of the messages. The default, as the
+	// kernel facility cannot be chosen, is local0.
+	Facility SyslogFacility
+	// Severity is the severity of messages not given one by
+	// RcodeSeverity. The default, as the emergency severity cannot be
+	// chosen, is informational.
+	Severity SyslogSeverity
+	// RcodeSeverity maps DNS response codes, such as dns.RcodeServerFailure,
+	// to the severity of the response messages with those codes.
+	RcodeSeverity map[int]SyslogSeverity
+	// Hostname is the HOSTNAME of the messages. The default is the
+	// host name reported by the kernel.
+	Hostname string
+	// AppName is the APP-NAME of the messages. The default is "dnstap".
+	AppName string
+	// SDID is the ID of the structured data element describing each
+	// message. The default, "dnstap@32473", uses the example enterprise
+	// number reserved for documentation by RFC 5612.
+	SDID string
+	// MaxLength is the length at which messages are truncated. The
+	// default is 2048 bytes for datagram sockets, as recommended by RFC
+	// 5426, and no limit for stream sockets.
+	MaxLength int
+	// Timeout is the time allowed to connect and for each write to a
+	// stream socket. The default is 30 seconds.
+	Timeout time.Duration
+	// RetryInterval is the time the SyslogOutput waits after a failed
+	// connection attempt before connecting again. Messages received
+	// meanwhile are discarded. The default is 10 seconds.
+	RetryInterval time.Duration
+	// Logger receives connection failures.
+	Logger Logger
+}
+
+// A SyslogOutput is a dnstap Output sending the messages it receives as
+// RFC 5424 syslog messages, over UDP, TCP, or a unix domain socket.
+//
+// Each syslog message has the dnstap message type as its MSGID, and a
+// structured data element with the identity, message type, client address,
+// and query name and type of the message, and for responses, the response
+// code, as in
+//
+//	<134>1 2026-10-19T12:00:00.123456Z ns1 dnstap 1234 CLIENT_RESPONSE [dnstap@32473 identity="ns1" type="CLIENT_RESPONSE" client="192.0.2.1" qname="example.com." qtype="A" rcode="NOERROR"] ...
+//
+// Messages sent over TCP or a unix stream socket are framed by octet
+// counting, as described in RFC 6587.
+type SyslogOutput struct {
+	network, address string
+	opt              SyslogOptions
+	outputChannel    chan []byte
+	wait             chan bool
+	pool             *FramePool
+
+	datagram    bool
+	conn        net.Conn
+	lastAttempt time.Time
+	procID      string
+	buf         []byte
+}
+
+// NewSyslogOutput creates a SyslogOutput sending to the given network
+// ("udp", "tcp", or "unix") and address, with the given options. A unix
+// socket is used as a datagram socket if possible, as /dev/log usually is,
+// and otherwise as a stream socket. The connection is established when the
+// first message is sent.
+func NewSyslogOutput(network, address string, opt *SyslogOptions) (*SyslogOutput, error) {
+	switch network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q", network)
+	}
+	o := &SyslogOutput{
+		network:       network,
+		address:       address,
+		outputChannel: make(chan []byte, outputChannelSize),
+		wait:          make(chan bool),
+		datagram:      strings.HasPrefix(network, "udp"),
+		procID:        strconv.Itoa(os.Getpid()),
+	}
+	if opt != nil {
+		o.opt = *opt
+	}
+	if o.opt.Facility <= SyslogKern || o.opt.Facility > SyslogLocal7 {
+		o.opt.Facility = SyslogLocal0
+	}
+	if o.opt.Severity <= SyslogEmergency || o.opt.Severity > SyslogDebug {
+		o.opt.Severity = SyslogInfo
+	}
+	if o.opt.Hostname == "" {
+		o.opt.Hostname, _ = os.Hostname()
+	}
+	if o.opt.AppName == "" {
+		o.opt.AppName = "dnstap"
+	}
+	if o.opt.SDID == "" {
+		o.opt.SDID = "dnstap@32473"
+	}
+	if o.opt.Timeout <= 0 {
+		o.opt.Timeout = 30 * time.Second
+	}
+	if o.opt.RetryInterval <= 0 {
+		o.opt.RetryInterval = 10 * time.Second
+	}
+	if o.opt.Logger == nil {
+		o.opt.Logger = nullLogger{}
+	}
+	return o, nil
+}
+
+// SetFramePool configures the SyslogOutput to return the buffers of the
+// frames it has sent to pool.
+func (o *SyslogOutput) SetFramePool(pool *FramePool) {
+	o.pool = pool
+}
+
+// GetOutputChannel returns the channel on which the SyslogOutput accepts
+// dnstap data.
+//
+// GetOutputChannel satisfies the dnstap Output interface.
+func (o *SyslogOutput) GetOutputChannel() chan []byte {
+	return o.outputChannel
+}
+
+// RunOutputLoop sends the data received on the output channel as syslog
+// messages, returning after Close is called.
+//
+// RunOutputLoop satisfies the dnstap Output interface.
+func (o *SyslogOutput) RunOutputLoop() {
+	dt := &Dnstap{}
+	for frame := range o.outputChannel {
+		if err := proto.Unmarshal(frame, dt); err != nil {
+			o.opt.Logger.Printf("SyslogOutput: proto.Unmarshal() failed: %s", err)
+			o.pool.Put(frame)
+			continue
+		}
+		o.pool.Put(frame)
+		msg, ok := o.format(o.buf[:0], dt)
+		if !ok {
+			o.opt.Logger.Printf("SyslogOutput: text format failed")
+			continue
+		}
+		o.buf = msg
+		o.send(msg)
+	}
+	if o.conn != nil {
+		o.conn.Close()
+	}
+	close(o.wait)
+}
+
+// Close closes the SyslogOutput's output channel and returns after all
+// messages have been sent.
+//
+// Close satisfies the dnstap Output interface.
+func (o *SyslogOutput) Close() {
+	close(o.outputChannel)
+	<-o.wait
+}
+
+// format appends the syslog message for dt to b, with room for the octet
+// count before it.
+func (o *SyslogOutput) format(b []byte, dt *Dnstap) ([]byte, bool) {
+	m := dt.GetMessage()
+	severity := o.opt.Severity
+	var wire []byte
+	if m != nil {
+		if isQueryType(m.GetType()) {
+			wire = m.QueryMessage
+		} else {
+			wire = m.ResponseMessage
+			if h, err := ParseDNSHeader(wire); err == nil {
+				if s, ok := o.opt.RcodeSeverity[h.Rcode()]; ok {
+					severity = s
+				}
+			}
+		}
+	}
+
+	// The octet count, if any, is written in place of the padding once
+	// the length of the message is known.
+	b = append(b, "          "...)
+	b = append(b, '<')
+	b = strconv.AppendInt(b, int64(o.opt.Facility)*8+int64(severity), 10)
+	b = append(b, ">1 "...)
+	t, ok := messageTime(dt)
+	if !ok {
+		t = time.Now()
+	}
+	b = t.UTC().AppendFormat(b, "2006-01-02T15:04:05.000000Z07:00")
+	b = append(b, ' ')
+	b = appendSyslogName(b, o.opt.Hostname, 255)
+	b = append(b, ' ')
+	b = appendSyslogName(b, o.opt.AppName, 48)
+	b = append(b, ' ')
+	b = append(b, o.procID...)
+	b = append(b, ' ')
+	if m != nil {
+		b = appendSyslogName(b, m.GetType().String(), 32)
+	} else {
+		b = appendSyslogName(b, dt.GetType().String(), 32)
+	}
+
+	b = append(b, " ["...)
+	b = append(b, o.opt.SDID...)
+	if len(dt.Identity) > 0 {
+		b = appendSDParam(b, "identity", string(dt.Identity))
+	}
+	if m != nil {
+		b = appendSDParam(b, "type", m.GetType().String())
+		if len(m.QueryAddress) > 0 {
+			b = appendSDParam(b, "client", net.IP(m.QueryAddress).String())
+		}
+		if q, err := ParseDNSQuestion(wire); err == nil {
+			b = appendSDParam(b, "qname", q.Name)
+			b = appendSDParam(b, "qtype", dns.TypeToString[q.Qtype])
+		}
+		if h, err := ParseDNSHeader(wire); err == nil && h.Response() {
+			b = appendSDParam(b, "rcode", dns.RcodeToString[h.Rcode()])
+		}
+	}
+	b = append(b, "] "...)
+
+	if o.opt.Format == SyslogJSON {
+		b, ok = AppendJSONFormat(b, dt)
+	} else {
+		b, ok = AppendTextFormat(b, dt)
+	}
+	if !ok {
+		return b, false
+	}
+	return bytes.TrimRight(b, "\n"), true
+}
+
+// appendSyslogName appends s to b as an RFC 5424 header field of at most
+// max printable ASCII characters, or "-" if s is empty.
+func appendSyslogName(b []byte, s string, max int) []byte {
+	if s == "" {
+		return append(b, '-')
+	}
+	for i := 0; i < len(s) && i < max; i++ {
+		c := s[i]
+		if c < 33 || c > 126 {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// appendSDParam appends a structured data parameter with the given name
+// and value, escaping the value as RFC 5424 requires, and replacing
+// invalid UTF-8.
+func appendSDParam(b []byte, name, value string) []byte {
+	b = append(b, ' ')
+	b = append(b, name...)
+	b = append(b, `="`...)
+	for _, r := range value {
+		switch r {
+		case '"', '\\', ']':
+			b = append(b, '\\')
+		}
+		b = append(b, string(r)...)
+	}
+	return append(b, '"')
+}
+
+// send sends the message msg, formatted by format, truncated to the
+// maximum length, connecting first if necessary.
+func (o *SyslogOutput) send(msg []byte) {
+	if o.conn == nil && !o.connect() {
+		return
+	}
+	start := len("          ")
+	if max := o.opt.MaxLength; max > 0 && len(msg)-start > max {
+		// Truncation does not split a UTF-8 sequence.
+		n := start + max
+		for n > start && !utf8.RuneStart(msg[n]) {
+			n--
+		}
+		msg = msg[:n]
+	}
+	if !o.datagram {
+		// RFC 6587 octet counting: the length and a space precede
+		// the message.
+		n := strconv.Itoa(len(msg) - start)
+		start -= len(n) + 1
+		copy(msg[start:], n)
+		msg[start+len(n)] = ' '
+		o.conn.SetWriteDeadline(time.Now().Add(o.opt.Timeout))
+	}
+	if _, err := o.conn.Write(msg[start:]); err != nil {
+		o.opt.Logger.Printf("SyslogOutput: write to %s failed: %v", o.address, err)
+		if !o.datagram {
+			o.conn.Close()
+			o.conn = nil
+		}
+	}
+}
+
+// connect connects to the syslog server, unless the last attempt failed
+// within the retry interval.
+func (o *SyslogOutput) connect() bool {
+	if !o.lastAttempt.IsZero() && time.Since(o.lastAttempt) < o.opt.RetryInterval {
+		return false
+	}
+	o.lastAttempt = time.Now()
+	var err error
+	if o.network == "unix" {
+		if o.conn, err = net.DialTimeout("unixgram", o.address, o.opt.Timeout); err == nil {
+			o.datagram = true
+		} else if o.conn, err = net.DialTimeout("unix", o.address, o.opt.Timeout); err == nil {
+			o.datagram = false
+		}
+	} else {
+		o.conn, err = net.DialTimeout(o.network, o.address, o.opt.Timeout)
+	}
+	if err != nil {
+		o.conn = nil
+		o.opt.Logger.Printf("SyslogOutput: connection to %s failed: %v", o.address, err)
+		return false
+	}
+	if o.datagram && o.opt.MaxLength == 0 {
+		o.opt.MaxLength = 2048
+	}
+	o.lastAttempt = time.Time{}
+	return true
+}
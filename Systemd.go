@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemdFirstFD is the first file descriptor passed by systemd socket
+// activation.
+const systemdFirstFD = 3
+
+// SystemdListeners returns the listening sockets passed to the process by
+// systemd socket activation, indexed by the names given to them with
+// FileDescriptorName= in the socket units, or "unknown" if not named. The
+// listeners can be used with NewFrameStreamSockInput, so that a socket
+// exists before the name server starts and survives restarts of the
+// collector.
+//
+// SystemdListeners returns no listeners if the process was not started
+// by socket activation. It unsets the environment variables describing the
+// sockets, so it returns the listeners only once, and they are not passed
+// on to child processes.
+func SystemdListeners() (map[string][]net.Listener, error) {
+	return systemdListeners(systemdFirstFD)
+}
+
+func systemdListeners(firstFD int) (map[string][]net.Listener, error) {
+	pid, nfds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	names := os.Getenv("LISTEN_FDNAMES")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(nfds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", nfds)
+	}
+
+	var fdnames []string
+	if names != "" {
+		fdnames = strings.Split(names, ":")
+	}
+	listeners := make(map[string][]net.Listener)
+	for i := 0; i < n; i++ {
+		name := "unknown"
+		if i < len(fdnames) && fdnames[i] != "" {
+			name = fdnames[i]
+		}
+		f := os.NewFile(uintptr(firstFD+i), name)
+		// FileListener duplicates the descriptor, so the original
+		// is closed.
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, ls := range listeners {
+				for _, l := range ls {
+					l.Close()
+				}
+			}
+			return nil, fmt.Errorf("socket %d (%s): %v", firstFD+i, name, err)
+		}
+		listeners[name] = append(listeners[name], l)
+	}
+	return listeners, nil
+}
+
+// SystemdNotify sends the state, such as "READY=1" or "WATCHDOG=1", to
+// systemd, as with sd_notify(3). It does nothing if the process was not
+// started by systemd with notification enabled.
+func SystemdNotify(state string) error {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// SystemdWatchdogInterval returns the interval within which systemd
+// expects the process to send "WATCHDOG=1" with SystemdNotify, or zero if
+// the watchdog is not enabled for the process. Pings are conventionally
+// sent at half the interval.
+func SystemdWatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
@@ -18,8 +18,12 @@ package dnstap
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"sync"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -27,23 +31,45 @@ import (
 // A TextFormatFunc renders a dnstap message into a human readable format.
 type TextFormatFunc func(*Dnstap) ([]byte, bool)
 
+// An AppendFormatFunc renders a dnstap message into a human readable format,
+// appending the result to a caller-provided buffer and returning the
+// extended buffer.
+type AppendFormatFunc func(dst []byte, dt *Dnstap) ([]byte, bool)
+
 // TextOutput implements a dnstap Output rendering dnstap data as text.
 type TextOutput struct {
-	format        TextFormatFunc
+	format        AppendFormatFunc
 	outputChannel chan []byte
 	wait          chan bool
+	w             io.Writer
 	writer        *bufio.Writer
 	log           Logger
+	pool          *FramePool
+	workers       int
+	bufferSize    int
+	flushTimeout  time.Duration
 }
 
 // NewTextOutput creates a TextOutput writing dnstap data to the given io.Writer
 // in the text format given by the TextFormatFunc format.
 func NewTextOutput(writer io.Writer, format TextFormatFunc) (o *TextOutput) {
+	return NewAppendTextOutput(writer, func(dst []byte, dt *Dnstap) ([]byte, bool) {
+		out, ok := format(dt)
+		return append(dst, out...), ok
+	})
+}
+
+// NewAppendTextOutput creates a TextOutput writing dnstap data to the given
+// io.Writer in the text format given by the AppendFormatFunc format, which
+// renders each message into a buffer reused by the TextOutput.
+func NewAppendTextOutput(writer io.Writer, format AppendFormatFunc) (o *TextOutput) {
 	o = new(TextOutput)
 	o.format = format
 	o.outputChannel = make(chan []byte, outputChannelSize)
+	o.w = writer
 	o.writer = bufio.NewWriter(writer)
 	o.wait = make(chan bool)
+	o.log = nullLogger{}
 	return
 }
 
@@ -52,26 +78,76 @@ func NewTextOutput(writer io.Writer, format TextFormatFunc) (o *TextOutput) {
 // is false, the file is truncated if it already exists, otherwise the file
 // is opened for appending.
 func NewTextOutputFromFilename(fname string, format TextFormatFunc, doAppend bool) (o *TextOutput, err error) {
-	if fname == "" || fname == "-" {
-		return NewTextOutput(os.Stdout, format), nil
-	}
-	var writer io.Writer
-	if doAppend {
-		writer, err = os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
-	} else {
-		writer, err = os.Create(fname)
-	}
+	writer, err := openTextFile(fname, doAppend)
 	if err != nil {
 		return
 	}
 	return NewTextOutput(writer, format), nil
 }
 
+// NewAppendTextOutputFromFilename creates a TextOutput writing dnstap data
+// to the named file as NewTextOutputFromFilename does, in the format given
+// by the AppendFormatFunc format.
+func NewAppendTextOutputFromFilename(fname string, format AppendFormatFunc, doAppend bool) (o *TextOutput, err error) {
+	writer, err := openTextFile(fname, doAppend)
+	if err != nil {
+		return
+	}
+	return NewAppendTextOutput(writer, format), nil
+}
+
+func openTextFile(fname string, doAppend bool) (io.Writer, error) {
+	if fname == "" || fname == "-" {
+		return os.Stdout, nil
+	}
+	if doAppend {
+		return os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	}
+	return os.Create(fname)
+}
+
 // SetLogger configures a logger for error events in the TextOutput
 func (o *TextOutput) SetLogger(logger Logger) {
 	o.log = logger
 }
 
+// SetFramePool configures the TextOutput to return the buffers of the
+// frames it has formatted to pool.
+func (o *TextOutput) SetFramePool(pool *FramePool) {
+	o.pool = pool
+}
+
+// SetWorkers configures the TextOutput to decode and format data on n
+// goroutines. Output is written in the order the data was received. The
+// TextOutput's format function must be safe for concurrent use if n is
+// greater than one, as are the formats of this package. The default is
+// one worker.
+//
+// SetWorkers must be called before RunOutputLoop.
+func (o *TextOutput) SetWorkers(n int) {
+	o.workers = n
+}
+
+// SetBufferSize sets the size of the TextOutput's output buffer. By
+// default, the output is flushed after every message; if a buffer size is
+// set, output is flushed when the buffer fills, and after the flush timeout
+// if one is set. The default buffer size is 4096 bytes.
+//
+// SetBufferSize must be called before RunOutputLoop.
+func (o *TextOutput) SetBufferSize(size int) {
+	o.bufferSize = size
+	o.writer = bufio.NewWriterSize(o.w, size)
+}
+
+// SetFlushTimeout sets the maximum time data will be kept in the output
+// buffer. If a flush timeout is set, the output is no longer flushed after
+// every message.
+//
+// SetFlushTimeout must be called before RunOutputLoop.
+func (o *TextOutput) SetFlushTimeout(timeout time.Duration) {
+	o.flushTimeout = timeout
+}
+
 // GetOutputChannel returns the channel on which the TextOutput accepts dnstap data.
 //
 // GetOutputChannel satisfies the dnstap Output interface.
@@ -81,28 +157,157 @@ func (o *TextOutput) GetOutputChannel() chan []byte {
 
 // RunOutputLoop receives dnstap data sent on the output channel, formats it
 // with the configured TextFormatFunc, and writes it to the file or io.Writer
-// of the TextOutput.
+// of the TextOutput. After an error decoding, formatting, or writing data,
+// it logs the error and returns, receiving no more data.
 //
 // RunOutputLoop satisfies the dnstap Output interface.
 func (o *TextOutput) RunOutputLoop() {
+	var flush <-chan time.Time
+	if o.flushTimeout > 0 {
+		t := time.NewTicker(o.flushTimeout)
+		defer t.Stop()
+		flush = t.C
+	}
+	if o.workers > 1 {
+		o.runWorkers(flush)
+	} else {
+		o.run(flush)
+	}
+	close(o.wait)
+}
+
+var errTextFormat = errors.New("text format function failed")
+
+// formatFrame decodes frame into dt and appends its text form to buf,
+// releasing the frame once decoded.
+func (o *TextOutput) formatFrame(buf, frame []byte, dt *Dnstap) ([]byte, error) {
+	if err := proto.Unmarshal(frame, dt); err != nil {
+		return buf, fmt.Errorf("proto.Unmarshal() failed: %s", err)
+	}
+	o.pool.Put(frame)
+	buf, ok := o.format(buf, dt)
+	if !ok {
+		return buf, errTextFormat
+	}
+	return buf, nil
+}
+
+// write writes the formatted data in buf, or logs the error from
+// formatFrame, returning false if the output loop should stop writing.
+func (o *TextOutput) write(buf []byte, err error) bool {
+	if err == nil {
+		if _, err = o.writer.Write(buf); err != nil {
+			err = fmt.Errorf("write error: %v", err)
+		}
+	}
+	if err != nil {
+		o.log.Printf("dnstap.TextOutput: %v, returning", err)
+		return false
+	}
+	if o.bufferSize == 0 && o.flushTimeout == 0 {
+		o.writer.Flush()
+	}
+	return true
+}
+
+func (o *TextOutput) run(flush <-chan time.Time) {
 	dt := &Dnstap{}
-	for frame := range o.outputChannel {
-		if err := proto.Unmarshal(frame, dt); err != nil {
-			o.log.Printf("dnstap.TextOutput: proto.Unmarshal() failed: %s, returning", err)
-			break
+	var buf []byte
+	for {
+		select {
+		case frame, ok := <-o.outputChannel:
+			if !ok {
+				return
+			}
+			var err error
+			buf, err = o.formatFrame(buf[:0], frame, dt)
+			if !o.write(buf, err) {
+				return
+			}
+		case <-flush:
+			o.writer.Flush()
 		}
-		buf, ok := o.format(dt)
-		if !ok {
-			o.log.Printf("dnstap.TextOutput: text format function failed, returning")
-			break
+	}
+}
+
+// A textJob carries a frame to a worker goroutine and its formatted text
+// back to the output loop.
+type textJob struct {
+	frame []byte
+	buf   []byte
+	err   error
+	done  chan struct{}
+}
+
+// runWorkers formats frames on o.workers goroutines. Jobs are queued for
+// writing in the order their frames were received, and written as each
+// job at the head of the queue completes. After an error, as in run, no
+// more frames are received, and those already queued are discarded.
+func (o *TextOutput) runWorkers(flush <-chan time.Time) {
+	jobs := make(chan *textJob, o.workers)
+	queue := make(chan *textJob, 2*o.workers)
+	free := make(chan *textJob, 4*o.workers)
+	for i := 0; i < cap(free); i++ {
+		free <- &textJob{done: make(chan struct{}, 1)}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < o.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dt := &Dnstap{}
+			for j := range jobs {
+				j.buf, j.err = o.formatFrame(j.buf[:0], j.frame, dt)
+				j.frame = nil
+				j.done <- struct{}{}
+			}
+		}()
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		defer close(queue)
+		defer close(jobs)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			select {
+			case frame, ok := <-o.outputChannel:
+				if !ok {
+					return
+				}
+				j := <-free
+				j.frame = frame
+				queue <- j
+				jobs <- j
+			case <-stop:
+				return
+			}
 		}
-		if _, err := o.writer.Write(buf); err != nil {
-			o.log.Printf("dnstap.TextOutput: write error: %v, returning", err)
-			break
+	}()
+
+	failed := false
+	for {
+		select {
+		case j, ok := <-queue:
+			if !ok {
+				wg.Wait()
+				return
+			}
+			<-j.done
+			if !failed && !o.write(j.buf, j.err) {
+				failed = true
+				close(stop)
+			}
+			free <- j
+		case <-flush:
+			o.writer.Flush()
 		}
-		o.writer.Flush()
 	}
-	close(o.wait)
 }
 
 // Close closes the output channel and returns when all pending data has been
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnixSocketOptions configures the unix domain socket created by
+// ListenUnixSocket.
+type UnixSocketOptions struct {
+	// Mode, if non-zero, sets the permissions of the socket file, as
+	// 0660 to allow a name server running as a user in the socket's
+	// group to connect. Otherwise the permissions are set by the umask.
+	Mode os.FileMode
+	// Owner and Group, if non-empty, set the owner and group of the
+	// socket file, given by name or numeric ID.
+	Owner, Group string
+	// Force removes whatever exists at the socket path. Otherwise, an
+	// existing socket is removed only if no process is listening on it,
+	// and an existing file of any other type is an error.
+	Force bool
+}
+
+// ListenUnixSocket creates a unix domain socket listening at path, with
+// the given options, for use with NewFrameStreamSockInput. If opt is nil,
+// the default options are used.
+//
+// On Linux, a path beginning with "@" names a socket in the abstract
+// namespace, which has no file and so no permissions or ownership.
+func ListenUnixSocket(path string, opt *UnixSocketOptions) (net.Listener, error) {
+	if opt == nil {
+		opt = &UnixSocketOptions{}
+	}
+	if strings.HasPrefix(path, "@") {
+		if runtime.GOOS != "linux" {
+			return nil, errors.New("abstract unix sockets are supported only on Linux")
+		}
+		if opt.Mode != 0 || opt.Owner != "" || opt.Group != "" {
+			return nil, errors.New("abstract unix sockets have no permissions or ownership")
+		}
+		return net.Listen("unix", path)
+	}
+
+	uid, gid := -1, -1
+	var err error
+	if opt.Owner != "" {
+		if uid, err = lookupUser(opt.Owner); err != nil {
+			return nil, err
+		}
+	}
+	if opt.Group != "" {
+		if gid, err = lookupGroup(opt.Group); err != nil {
+			return nil, err
+		}
+	}
+	if err := removeSocket(path, opt.Force); err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if opt.Mode != 0 {
+		if err := os.Chmod(path, opt.Mode); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(path, uid, gid); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// removeSocket removes an existing socket at path which no process is
+// listening on, or if force is true, whatever exists at path.
+func removeSocket(path string, force bool) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !force {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			c.Close()
+			return fmt.Errorf("%s is in use by another process", path)
+		}
+	}
+	return os.Remove(path)
+}
+
+func lookupUser(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+func lookupGroup(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(g.Gid)
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// A ValidationSeverity classifies a ValidationProblem.
+type ValidationSeverity int
+
+const (
+	// ValidationWarning marks data which is permitted by the dnstap
+	// schema, but departs from the usage recommended for its type.
+	ValidationWarning ValidationSeverity = iota
+	// ValidationError marks data which is malformed or contradicts
+	// the dnstap schema.
+	ValidationError
+)
+
+func (s ValidationSeverity) String() string {
+	switch s {
+	case ValidationWarning:
+		return "warning"
+	case ValidationError:
+		return "error"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// A ValidationProblem describes one way in which a Dnstap message fails
+// to conform to the dnstap schema or its semantics.
+type ValidationProblem struct {
+	Severity ValidationSeverity
+	// Field is the schema name of the offending field, e.g.
+	// "message.query_address", or empty if the problem concerns the
+	// payload as a whole.
+	Field  string
+	Reason string
+}
+
+func (p ValidationProblem) String() string {
+	if p.Field == "" {
+		return fmt.Sprintf("%s: %s", p.Severity, p.Reason)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Severity, p.Field, p.Reason)
+}
+
+type problemList []ValidationProblem
+
+func (pl *problemList) add(sev ValidationSeverity, field, format string, v ...interface{}) {
+	*pl = append(*pl, ValidationProblem{
+		Severity: sev,
+		Field:    field,
+		Reason:   fmt.Sprintf(format, v...),
+	})
+}
+
+// isQueryType returns true if t is one of the *_QUERY message types.
+func isQueryType(t Message_Type) bool {
+	switch t {
+	case Message_AUTH_QUERY,
+		Message_RESOLVER_QUERY,
+		Message_CLIENT_QUERY,
+		Message_FORWARDER_QUERY,
+		Message_STUB_QUERY,
+		Message_TOOL_QUERY,
+		Message_UPDATE_QUERY:
+		return true
+	}
+	return false
+}
+
+// ValidateFrame decodes a dnstap data frame and validates its contents.
+// Unlike proto.Unmarshal, ValidateFrame tolerates missing required fields,
+// reporting them as problems. The decoded message is returned with the
+// problems found, or nil if the frame could not be decoded at all.
+func ValidateFrame(frame []byte) (*Dnstap, []ValidationProblem) {
+	dt := &Dnstap{}
+	if err := (proto.UnmarshalOptions{AllowPartial: true}).Unmarshal(frame, dt); err != nil {
+		return nil, []ValidationProblem{{
+			Severity: ValidationError,
+			Reason:   fmt.Sprintf("protobuf decode failed: %v", err),
+		}}
+	}
+	return dt, Validate(dt)
+}
+
+// Validate checks the Dnstap message dt against the requirements of the
+// dnstap schema, returning any problems found. A nil result means dt is
+// valid.
+func Validate(dt *Dnstap) []ValidationProblem {
+	var pl problemList
+	if dt == nil {
+		pl.add(ValidationError, "", "nil payload")
+		return pl
+	}
+
+	if len(dt.ProtoReflect().GetUnknown()) > 0 {
+		pl.add(ValidationWarning, "", "unknown fields or enum values present")
+	}
+
+	switch {
+	case dt.Type == nil:
+		pl.add(ValidationError, "type", "missing required field")
+	case Dnstap_Type_name[int32(*dt.Type)] == "":
+		pl.add(ValidationError, "type", "unknown value %d", *dt.Type)
+	case *dt.Type == Dnstap_MESSAGE:
+		if dt.Message == nil {
+			pl.add(ValidationError, "message", "missing for type MESSAGE")
+			break
+		}
+		validateMessage(dt.Message, &pl)
+	}
+
+	if dt.Type != nil && *dt.Type != Dnstap_MESSAGE && dt.Message != nil {
+		pl.add(ValidationWarning, "message", "present for type %s", dt.Type)
+	}
+
+	return pl
+}
+
+func validateMessage(m *Message, pl *problemList) {
+	knownType := false
+	switch {
+	case m.Type == nil:
+		pl.add(ValidationError, "message.type", "missing required field")
+	case Message_Type_name[int32(*m.Type)] == "":
+		pl.add(ValidationError, "message.type", "unknown value %d", *m.Type)
+	default:
+		knownType = true
+	}
+
+	if m.SocketFamily != nil && SocketFamily_name[int32(*m.SocketFamily)] == "" {
+		pl.add(ValidationError, "message.socket_family", "unknown value %d", *m.SocketFamily)
+	}
+	if m.SocketProtocol != nil && SocketProtocol_name[int32(*m.SocketProtocol)] == "" {
+		pl.add(ValidationError, "message.socket_protocol", "unknown value %d", *m.SocketProtocol)
+	}
+
+	validateAddress("message.query_address", m.QueryAddress, m.SocketFamily, pl)
+	validateAddress("message.response_address", m.ResponseAddress, m.SocketFamily, pl)
+	validatePort("message.query_port", m.QueryPort, pl)
+	validatePort("message.response_port", m.ResponsePort, pl)
+	validateTime("message.query_time", m.QueryTimeSec, m.QueryTimeNsec, pl)
+	validateTime("message.response_time", m.ResponseTimeSec, m.ResponseTimeNsec, pl)
+
+	if m.QueryZone != nil {
+		if _, _, err := dns.UnpackDomainName(m.QueryZone, 0); err != nil {
+			pl.add(ValidationError, "message.query_zone", "undecodable domain name: %v", err)
+		}
+	}
+
+	validateDNS("message.query_message", m.QueryMessage, false, pl)
+	validateDNS("message.response_message", m.ResponseMessage, true, pl)
+
+	if !knownType {
+		return
+	}
+
+	if isQueryType(*m.Type) {
+		if m.QueryMessage == nil {
+			pl.add(ValidationWarning, "message.query_message", "missing for type %s", m.Type)
+		}
+		if m.QueryTimeSec == nil {
+			pl.add(ValidationWarning, "message.query_time", "missing for type %s", m.Type)
+		}
+		if m.ResponseMessage != nil {
+			pl.add(ValidationWarning, "message.response_message", "present for type %s", m.Type)
+		}
+		return
+	}
+
+	if m.ResponseMessage == nil {
+		pl.add(ValidationWarning, "message.response_message", "missing for type %s", m.Type)
+	}
+	if m.ResponseTimeSec == nil {
+		pl.add(ValidationWarning, "message.response_time", "missing for type %s", m.Type)
+	}
+}
+
+func validateAddress(field string, addr []byte, family *SocketFamily, pl *problemList) {
+	if addr == nil {
+		return
+	}
+	if family == nil {
+		pl.add(ValidationWarning, field, "present without socket_family")
+		return
+	}
+	want := 0
+	switch *family {
+	case SocketFamily_INET:
+		want = 4
+	case SocketFamily_INET6:
+		want = 16
+	default:
+		return
+	}
+	if len(addr) != want {
+		pl.add(ValidationError, field, "%d octets, want %d for socket family %s",
+			len(addr), want, family)
+	}
+}
+
+func validatePort(field string, port *uint32, pl *problemList) {
+	if port != nil && *port > 65535 {
+		pl.add(ValidationError, field, "value %d out of range", *port)
+	}
+}
+
+func validateTime(field string, sec *uint64, nsec *uint32, pl *problemList) {
+	switch {
+	case sec == nil && nsec != nil:
+		pl.add(ValidationWarning, field+"_nsec", "present without %s_sec", field)
+	case sec != nil && nsec == nil:
+		pl.add(ValidationWarning, field+"_sec", "present without %s_nsec", field)
+	}
+	if nsec != nil && *nsec >= 1e9 {
+		pl.add(ValidationError, field+"_nsec", "value %d out of range", *nsec)
+	}
+}
+
+func validateDNS(field string, wire []byte, response bool, pl *problemList) {
+	if wire == nil {
+		return
+	}
+	msg := new(dns.Msg)
+	if err := msg.Unpack(wire); err != nil {
+		pl.add(ValidationError, field, "undecodable DNS message: %v", err)
+		return
+	}
+	if msg.Response != response {
+		if response {
+			pl.add(ValidationError, field, "DNS message is a query (QR bit clear)")
+		} else {
+			pl.add(ValidationError, field, "DNS message is a response (QR bit set)")
+		}
+	}
+}
@@ -0,0 +1,353 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnstap
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the dnstap protobuf messages, from dnstap.proto.
+const (
+	dnstapIdentityField = 1
+	dnstapVersionField  = 2
+	dnstapExtraField    = 3
+	dnstapMessageField  = 14
+	dnstapTypeField     = 15
+
+	messageTypeField             = 1
+	messageSocketFamilyField     = 2
+	messageSocketProtocolField   = 3
+	messageQueryAddressField     = 4
+	messageResponseAddressField  = 5
+	messageQueryPortField        = 6
+	messageResponsePortField     = 7
+	messageQueryTimeSecField     = 8
+	messageQueryTimeNsecField    = 9
+	messageQueryMessageField     = 10
+	messageQueryZoneField        = 11
+	messageResponseTimeSecField  = 12
+	messageResponseTimeNsecField = 13
+	messageResponseMessageField  = 14
+)
+
+// A View holds the fields of a dnstap frame, extracted directly from its
+// protobuf encoding without unmarshaling it into a Dnstap. Parsing a frame
+// into a View does not allocate, which allows filters and routers to
+// examine frames cheaply and fully decode only those they keep.
+//
+// The byte slice fields of a View refer to the frame it was parsed from,
+// and are valid only as long as the frame is. Fields absent from the frame
+// are left at their zero values; none of the enum types has a valid zero
+// value.
+type View struct {
+	Type     Dnstap_Type
+	Identity []byte
+	Version  []byte
+	Extra    []byte
+
+	// HasMessage reports whether the frame contains a Message.
+	HasMessage bool
+	Message    MessageView
+}
+
+// A MessageView holds the fields of the Message in a dnstap frame parsed
+// into a View.
+type MessageView struct {
+	Type            Message_Type
+	SocketFamily    SocketFamily
+	SocketProtocol  SocketProtocol
+	QueryAddress    []byte
+	ResponseAddress []byte
+	QueryPort       uint32
+	ResponsePort    uint32
+	QueryZone       []byte
+	QueryMessage    []byte
+	ResponseMessage []byte
+
+	queryTimeSec     uint64
+	queryTimeNsec    uint32
+	responseTimeSec  uint64
+	responseTimeNsec uint32
+	hasQueryTime     bool
+	hasResponseTime  bool
+}
+
+// ParseView parses the dnstap frame into a new View.
+func ParseView(frame []byte) (*View, error) {
+	v := &View{}
+	if err := v.Parse(frame); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Parse parses the dnstap frame into v, replacing its contents. Unknown
+// fields are skipped, and missing required fields are not reported.
+func (v *View) Parse(frame []byte) error {
+	*v = View{}
+	return walkFields(frame, func(num protowire.Number, typ protowire.Type, val uint64, b []byte) error {
+		switch {
+		case num == dnstapIdentityField && typ == protowire.BytesType:
+			v.Identity = b
+		case num == dnstapVersionField && typ == protowire.BytesType:
+			v.Version = b
+		case num == dnstapExtraField && typ == protowire.BytesType:
+			v.Extra = b
+		case num == dnstapTypeField && typ == protowire.VarintType:
+			v.Type = Dnstap_Type(int32(val))
+		case num == dnstapMessageField && typ == protowire.BytesType:
+			// Repeated occurrences of a message field are merged, so
+			// later fields replace earlier ones as in proto.Unmarshal.
+			v.HasMessage = true
+			return v.Message.parse(b)
+		}
+		return nil
+	})
+}
+
+func (m *MessageView) parse(b []byte) error {
+	return walkFields(b, func(num protowire.Number, typ protowire.Type, val uint64, b []byte) error {
+		if typ == protowire.BytesType {
+			switch num {
+			case messageQueryAddressField:
+				m.QueryAddress = b
+			case messageResponseAddressField:
+				m.ResponseAddress = b
+			case messageQueryMessageField:
+				m.QueryMessage = b
+			case messageQueryZoneField:
+				m.QueryZone = b
+			case messageResponseMessageField:
+				m.ResponseMessage = b
+			}
+			return nil
+		}
+		if typ == protowire.Fixed32Type {
+			switch num {
+			case messageQueryTimeNsecField:
+				m.queryTimeNsec = uint32(val)
+			case messageResponseTimeNsecField:
+				m.responseTimeNsec = uint32(val)
+			}
+			return nil
+		}
+		if typ != protowire.VarintType {
+			return nil
+		}
+		switch num {
+		case messageTypeField:
+			m.Type = Message_Type(int32(val))
+		case messageSocketFamilyField:
+			m.SocketFamily = SocketFamily(int32(val))
+		case messageSocketProtocolField:
+			m.SocketProtocol = SocketProtocol(int32(val))
+		case messageQueryPortField:
+			m.QueryPort = uint32(val)
+		case messageResponsePortField:
+			m.ResponsePort = uint32(val)
+		case messageQueryTimeSecField:
+			m.queryTimeSec = val
+			m.hasQueryTime = true
+		case messageResponseTimeSecField:
+			m.responseTimeSec = val
+			m.hasResponseTime = true
+		}
+		return nil
+	})
+}
+
+// walkFields calls fn for each field of the protobuf message encoded in b,
+// with the value of varint and fixed-width fields in val and the contents
+// of length-delimited fields in data.
+func walkFields(b []byte, fn func(num protowire.Number, typ protowire.Type, val uint64, data []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var val uint64
+		var data []byte
+		switch typ {
+		case protowire.VarintType:
+			val, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v32 uint32
+			v32, n = protowire.ConsumeFixed32(b)
+			val = uint64(v32)
+		case protowire.Fixed64Type:
+			val, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			data, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, val, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryTime returns the query time of the message, if present.
+func (m *MessageView) QueryTime() (time.Time, bool) {
+	if !m.hasQueryTime {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(m.queryTimeSec), int64(m.queryTimeNsec)), true
+}
+
+// ResponseTime returns the response time of the message, if present.
+func (m *MessageView) ResponseTime() (time.Time, bool) {
+	if !m.hasResponseTime {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(m.responseTimeSec), int64(m.responseTimeNsec)), true
+}
+
+// Time returns the time of the message: the query time for query types
+// and the response time for response types, falling back to whichever
+// is present.
+func (m *MessageView) Time() (time.Time, bool) {
+	if m.hasResponseTime && (!m.hasQueryTime || m.Type != 0 && !isQueryType(m.Type)) {
+		return m.ResponseTime()
+	}
+	return m.QueryTime()
+}
+
+// DNS returns the DNS message of the message: the query message for query
+// types and the response message for response types.
+func (m *MessageView) DNS() []byte {
+	if isQueryType(m.Type) {
+		return m.QueryMessage
+	}
+	return m.ResponseMessage
+}
+
+// Header parses the header of the message's DNS message, as returned by
+// DNS.
+func (m *MessageView) Header() (DNSHeader, error) {
+	return ParseDNSHeader(m.DNS())
+}
+
+// Question parses the first question of the message's DNS message, as
+// returned by DNS.
+func (m *MessageView) Question() (DNSQuestion, error) {
+	return ParseDNSQuestion(m.DNS())
+}
+
+// A DNSHeader holds the fixed header of a DNS message.
+type DNSHeader struct {
+	ID      uint16
+	Flags   uint16
+	QDCount uint16
+	ANCount uint16
+	NSCount uint16
+	ARCount uint16
+}
+
+// Response reports whether the QR bit of the header is set.
+func (h DNSHeader) Response() bool {
+	return h.Flags&0x8000 != 0
+}
+
+// Opcode returns the opcode of the header.
+func (h DNSHeader) Opcode() int {
+	return int(h.Flags>>11) & 0xf
+}
+
+// Rcode returns the (non-extended) response code of the header.
+func (h DNSHeader) Rcode() int {
+	return int(h.Flags & 0xf)
+}
+
+// A DNSQuestion holds a question from the question section of a DNS
+// message.
+type DNSQuestion struct {
+	Name   string
+	Qtype  uint16
+	Qclass uint16
+}
+
+// ErrShortDNSMessage is returned when a DNS message is too short to hold
+// the header or question requested.
+var ErrShortDNSMessage = errors.New("short DNS message")
+
+// ErrNoQuestion is returned by ParseDNSQuestion for a DNS message with an
+// empty question section.
+var ErrNoQuestion = errors.New("DNS message has no question")
+
+// ParseDNSHeader parses the header of the wire-format DNS message msg.
+func ParseDNSHeader(msg []byte) (DNSHeader, error) {
+	if len(msg) < 12 {
+		return DNSHeader{}, ErrShortDNSMessage
+	}
+	return DNSHeader{
+		ID:      binary.BigEndian.Uint16(msg[0:]),
+		Flags:   binary.BigEndian.Uint16(msg[2:]),
+		QDCount: binary.BigEndian.Uint16(msg[4:]),
+		ANCount: binary.BigEndian.Uint16(msg[6:]),
+		NSCount: binary.BigEndian.Uint16(msg[8:]),
+		ARCount: binary.BigEndian.Uint16(msg[10:]),
+	}, nil
+}
+
+// ParseDNSQuestion parses the first question of the wire-format DNS
+// message msg, without unpacking the rest of the message. The name is
+// returned in presentation format, as by dns.UnpackDomainName.
+func ParseDNSQuestion(msg []byte) (DNSQuestion, error) {
+	h, err := ParseDNSHeader(msg)
+	if err != nil {
+		return DNSQuestion{}, err
+	}
+	if h.QDCount == 0 {
+		return DNSQuestion{}, ErrNoQuestion
+	}
+	name, off, err := dns.UnpackDomainName(msg, 12)
+	if err != nil {
+		return DNSQuestion{}, err
+	}
+	if len(msg)-off < 4 {
+		return DNSQuestion{}, ErrShortDNSMessage
+	}
+	return DNSQuestion{
+		Name:   name,
+		Qtype:  binary.BigEndian.Uint16(msg[off:]),
+		Qclass: binary.BigEndian.Uint16(msg[off+2:]),
+	}, nil
+}
+
+// frameTime returns the time of the message in a dnstap frame, as
+// messageTime does for a decoded Dnstap.
+func frameTime(frame []byte) (time.Time, bool) {
+	var v View
+	if v.Parse(frame) != nil || !v.HasMessage {
+		return time.Time{}, false
+	}
+	return v.Message.Time()
+}
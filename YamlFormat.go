@@ -17,9 +17,6 @@
 package dnstap
 
 import (
-	"bytes"
-	"fmt"
-	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -29,90 +26,131 @@ import (
 
 const yamlTimeFormat = "2006-01-02 15:04:05.999999999"
 
-func yamlConvertMessage(m *Message, s *bytes.Buffer) {
-	s.WriteString(fmt.Sprint("  type: ", m.Type, "\n"))
+// yamlConvertDNS appends the field named key holding the DNS message in
+// wire, rendered in a format similar to 'dig' output.
+func yamlConvertDNS(b []byte, key string, wire []byte) []byte {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(wire); err != nil {
+		b = append(b, "  # "...)
+		b = append(b, key...)
+		b = append(b, ": parse failed: "...)
+		b = append(b, err.Error()...)
+		return append(b, '\n')
+	}
+	b = append(b, "  "...)
+	b = append(b, key...)
+	b = append(b, ": |\n    "...)
+	text := strings.TrimSpace(msg.String())
+	for i := 0; i < len(text); i++ {
+		b = append(b, text[i])
+		if text[i] == '\n' {
+			b = append(b, "    "...)
+		}
+	}
+	return append(b, '\n')
+}
+
+func yamlConvertMessage(b []byte, m *Message) []byte {
+	b = append(b, "  type: "...)
+	b = append(b, messageTypeName(m.Type)...)
+	b = append(b, '\n')
 
 	if m.QueryTimeSec != nil && m.QueryTimeNsec != nil {
 		t := time.Unix(int64(*m.QueryTimeSec), int64(*m.QueryTimeNsec)).UTC()
-		s.WriteString(fmt.Sprint("  query_time: !!timestamp ", t.Format(yamlTimeFormat), "\n"))
+		b = append(b, "  query_time: !!timestamp "...)
+		b = t.AppendFormat(b, yamlTimeFormat)
+		b = append(b, '\n')
 	}
 
 	if m.ResponseTimeSec != nil && m.ResponseTimeNsec != nil {
 		t := time.Unix(int64(*m.ResponseTimeSec), int64(*m.ResponseTimeNsec)).UTC()
-		s.WriteString(fmt.Sprint("  response_time: !!timestamp ", t.Format(yamlTimeFormat), "\n"))
+		b = append(b, "  response_time: !!timestamp "...)
+		b = t.AppendFormat(b, yamlTimeFormat)
+		b = append(b, '\n')
 	}
 
 	if m.SocketFamily != nil {
-		s.WriteString(fmt.Sprint("  socket_family: ", m.SocketFamily, "\n"))
+		b = append(b, "  socket_family: "...)
+		b = append(b, m.SocketFamily.String()...)
+		b = append(b, '\n')
 	}
 
 	if m.SocketProtocol != nil {
-		s.WriteString(fmt.Sprint("  socket_protocol: ", m.SocketProtocol, "\n"))
+		b = append(b, "  socket_protocol: "...)
+		b = append(b, m.SocketProtocol.String()...)
+		b = append(b, '\n')
 	}
 
 	if m.QueryAddress != nil {
-		s.WriteString(fmt.Sprint("  query_address: ", net.IP(m.QueryAddress), "\n"))
+		b = append(b, "  query_address: "...)
+		b = appendIP(b, m.QueryAddress)
+		b = append(b, '\n')
 	}
 
 	if m.ResponseAddress != nil {
-		s.WriteString(fmt.Sprint("  response_address: ", net.IP(m.ResponseAddress), "\n"))
+		b = append(b, "  response_address: "...)
+		b = appendIP(b, m.ResponseAddress)
+		b = append(b, '\n')
 	}
 
 	if m.QueryPort != nil {
-		s.WriteString(fmt.Sprint("  query_port: ", *m.QueryPort, "\n"))
+		b = append(b, "  query_port: "...)
+		b = strconv.AppendUint(b, uint64(*m.QueryPort), 10)
+		b = append(b, '\n')
 	}
 
 	if m.ResponsePort != nil {
-		s.WriteString(fmt.Sprint("  response_port: ", *m.ResponsePort, "\n"))
+		b = append(b, "  response_port: "...)
+		b = strconv.AppendUint(b, uint64(*m.ResponsePort), 10)
+		b = append(b, '\n')
 	}
 
 	if m.QueryZone != nil {
 		name, _, err := dns.UnpackDomainName(m.QueryZone, 0)
 		if err != nil {
-			fmt.Fprintf(s, "  # query_zone: parse failed: %v\n", err)
+			b = append(b, "  # query_zone: parse failed: "...)
+			b = append(b, err.Error()...)
 		} else {
-			s.WriteString(fmt.Sprint("  query_zone: ", strconv.Quote(name), "\n"))
+			b = append(b, "  query_zone: "...)
+			b = strconv.AppendQuote(b, name)
 		}
+		b = append(b, '\n')
 	}
 
 	if m.QueryMessage != nil {
-		msg := new(dns.Msg)
-		err := msg.Unpack(m.QueryMessage)
-		if err != nil {
-			fmt.Fprintf(s, "  # query_message: parse failed: %v\n", err)
-		} else {
-			s.WriteString("  query_message: |\n")
-			s.WriteString("    " + strings.Replace(strings.TrimSpace(msg.String()), "\n", "\n    ", -1) + "\n")
-		}
+		b = yamlConvertDNS(b, "query_message", m.QueryMessage)
 	}
 	if m.ResponseMessage != nil {
-		msg := new(dns.Msg)
-		err := msg.Unpack(m.ResponseMessage)
-		if err != nil {
-			fmt.Fprintf(s, "  # response_message: parse failed: %v\n", err)
-		} else {
-			s.WriteString("  response_message: |\n")
-			s.WriteString("    " + strings.Replace(strings.TrimSpace(msg.String()), "\n", "\n    ", -1) + "\n")
-		}
+		b = yamlConvertDNS(b, "response_message", m.ResponseMessage)
 	}
-	s.WriteString("---\n")
+	return append(b, "---\n"...)
 }
 
 // YamlFormat renders a dnstap message in YAML format. Any encapsulated DNS
 // messages are rendered as strings in a format similar to 'dig' output.
 func YamlFormat(dt *Dnstap) (out []byte, ok bool) {
-	var s bytes.Buffer
+	return AppendYamlFormat(nil, dt)
+}
 
-	s.WriteString(fmt.Sprint("type: ", dt.Type, "\n"))
+// AppendYamlFormat appends the YAML form of a dnstap message rendered by
+// YamlFormat to dst.
+func AppendYamlFormat(dst []byte, dt *Dnstap) (out []byte, ok bool) {
+	b := append(dst, "type: "...)
+	b = append(b, dnstapTypeName(dt.Type)...)
+	b = append(b, '\n')
 	if dt.Identity != nil {
-		s.WriteString(fmt.Sprint("identity: ", strconv.Quote(string(dt.Identity)), "\n"))
+		b = append(b, "identity: "...)
+		b = strconv.AppendQuote(b, string(dt.Identity))
+		b = append(b, '\n')
 	}
 	if dt.Version != nil {
-		s.WriteString(fmt.Sprint("version: ", strconv.Quote(string(dt.Version)), "\n"))
+		b = append(b, "version: "...)
+		b = strconv.AppendQuote(b, string(dt.Version))
+		b = append(b, '\n')
 	}
-	if *dt.Type == Dnstap_MESSAGE {
-		s.WriteString("message:\n")
-		yamlConvertMessage(dt.Message, &s)
+	if dt.GetType() == Dnstap_MESSAGE && dt.Message != nil {
+		b = append(b, "message:\n"...)
+		b = yamlConvertMessage(b, dt.Message)
 	}
-	return s.Bytes(), true
+	return b, true
 }
@@ -0,0 +1,151 @@
+package dnstap
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// A testResponse describes a response written by testResponseStream. An
+// empty name writes a frame which cannot be decoded.
+type testResponse struct {
+	name  string
+	rcode int
+	ttls  []uint32 // TTLs of the answers, repeated as needed
+	addrs []string
+	sec   uint64
+}
+
+func testResponseStream(t *testing.T, responses ...testResponse) *Decoder {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := NewEncoder(w)
+	for _, tr := range responses {
+		if tr.name == "" {
+			if _, err := w.WriteFrame([]byte("not a dnstap message")); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		msg := new(dns.Msg)
+		msg.SetQuestion(tr.name, dns.TypeA)
+		msg.Response = true
+		msg.Rcode = tr.rcode
+		for i, a := range tr.addrs {
+			ttl := tr.ttls[i%len(tr.ttls)]
+			msg.Answer = append(msg.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: tr.name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+				A:   net.ParseIP(a),
+			})
+		}
+		wire, err := msg.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dt := &Dnstap{
+			Type: Dnstap_MESSAGE.Enum(),
+			Message: &Message{
+				Type:             Message_CLIENT_RESPONSE.Enum(),
+				ResponseTimeSec:  proto.Uint64(tr.sec),
+				ResponseTimeNsec: proto.Uint32(0),
+				ResponseMessage:  wire,
+			},
+		}
+		if err := enc.Encode(dt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	r, err := NewReader(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDecoder(r, int(MaxPayloadSize))
+}
+
+func TestDiff(t *testing.T) {
+	ttl := []uint32{300}
+	a := testResponseStream(t,
+		testResponse{"same.example.", dns.RcodeSuccess, ttl, []string{"192.0.2.1", "192.0.2.2"}, 0},
+		testResponse{"rcode.example.", dns.RcodeSuccess, ttl, []string{"192.0.2.1"}, 0},
+		testResponse{},
+		testResponse{"answer.example.", dns.RcodeSuccess, ttl, []string{"192.0.2.1"}, 0},
+		testResponse{"ttl.example.", dns.RcodeSuccess, ttl, []string{"192.0.2.1"}, 0},
+		testResponse{"minttl.example.", dns.RcodeSuccess, []uint32{300, 30}, []string{"192.0.2.1", "192.0.2.2"}, 0},
+		testResponse{"onlya.example.", dns.RcodeSuccess, ttl, nil, 0},
+	)
+	b := testResponseStream(t,
+		testResponse{"same.example.", dns.RcodeSuccess, ttl, []string{"192.0.2.2", "192.0.2.1"}, 0},
+		testResponse{"rcode.example.", dns.RcodeServerFailure, ttl, []string{"192.0.2.1"}, 0},
+		testResponse{"answer.example.", dns.RcodeSuccess, ttl, []string{"192.0.2.9"}, 0},
+		testResponse{"ttl.example.", dns.RcodeSuccess, []uint32{30}, []string{"192.0.2.1"}, 0},
+		testResponse{},
+		testResponse{"minttl.example.", dns.RcodeSuccess, ttl, []string{"192.0.2.1", "192.0.2.2"}, 0},
+		testResponse{"onlyb.example.", dns.RcodeSuccess, ttl, nil, 0},
+		testResponse{},
+	)
+	report, err := Diff(a, b, &DiffOptions{CompareTTL: true, TTLTolerance: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := report.Format(&out, "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	expected := `5 response pairs compared: 1 identical, 4 differing
+1 responses only in a, 1 only in b
+1 undecodable frames skipped in a, 2 in b
+
+rcode differs in 1 pairs
+    rcode.example. IN A
+        a: NOERROR
+        b: SERVFAIL
+
+answer differs in 1 pairs
+    answer.example. IN A
+        a: answer.example. 0 IN A 192.0.2.1
+        b: answer.example. 0 IN A 192.0.2.9
+
+ttl differs in 2 pairs
+    ttl.example. IN A
+        a: TTL 300-300
+        b: TTL 30-30
+    minttl.example. IN A
+        a: TTL 30-300
+        b: TTL 300-300
+
+`
+	if out.String() != expected {
+		t.Errorf("report:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestDiffWindow(t *testing.T) {
+	// Responses to the same question are paired in order of time, within
+	// the match window.
+	ttl := []uint32{300}
+	var ra, rb []testResponse
+	for i := 0; i < 1000; i++ {
+		ra = append(ra, testResponse{"www.example.", dns.RcodeSuccess, ttl, []string{"192.0.2.1"}, uint64(10 * i)})
+		rb = append(rb, testResponse{"www.example.", dns.RcodeSuccess, ttl, []string{"192.0.2.1"}, uint64(10*i + 1)})
+	}
+	// The last response from a is outside the window of every response
+	// from b, and the last from b outside the window of every one from a.
+	ra[len(ra)-1].sec = 100000
+	rb[len(rb)-1].sec = 200000
+	report, err := Diff(testResponseStream(t, ra...), testResponseStream(t, rb...),
+		&DiffOptions{MatchWindow: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Pairs != 999 || report.Identical != 999 || report.OnlyA != 1 || report.OnlyB != 1 {
+		t.Errorf("report %+v", report)
+	}
+}
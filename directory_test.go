@@ -0,0 +1,191 @@
+package dnstap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirectoryInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "directory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spool := filepath.Join(dir, "spool")
+	done := filepath.Join(dir, "done")
+	for _, d := range []string{spool, done} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := time.Now().Add(-time.Minute)
+	writeFile := func(name string, mtime time.Time, data []byte) {
+		fname := filepath.Join(spool, name)
+		if err := ioutil.WriteFile(fname, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(fname, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opt := &DirectoryOptions{
+		Pattern:    filepath.Join(spool, "*.fstrm"),
+		Order:      OrderByModTime,
+		MinAge:     time.Second,
+		MoveTo:     done,
+		Checkpoint: filepath.Join(dir, "checkpoint"),
+		Once:       true,
+	}
+	run := func(frames ...string) {
+		t.Helper()
+		in, err := NewDirectoryInput(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch := make(chan []byte, 16)
+		go in.ReadInto(ch)
+		in.Wait()
+		expectFrames(t, ch, frames...)
+	}
+
+	// Files are read in order of modification time, except for the one
+	// still being written. Files not matching the pattern are ignored.
+	writeFile("b.fstrm", old, followStream(t, true, "b1", "b2"))
+	writeFile("a.fstrm", old.Add(time.Second), followStream(t, true, "a1"))
+	writeFile("c.fstrm", time.Now(), followStream(t, false, "c1"))
+	writeFile("d.txt", old, followStream(t, true, "d1"))
+	run("b1", "b2", "a1")
+	for _, name := range []string{"a.fstrm", "b.fstrm"} {
+		if _, err := os.Stat(filepath.Join(done, name)); err != nil {
+			t.Errorf("%s not moved: %v", name, err)
+		}
+	}
+
+	// An undecodable file is skipped and left in place.
+	writeFile("c.fstrm", old, followStream(t, true, "c1"))
+	writeFile("e.fstrm", old, []byte("not a frame stream"))
+	run("c1")
+	if _, err := os.Stat(filepath.Join(spool, "e.fstrm")); err != nil {
+		t.Errorf("undecodable file moved: %v", err)
+	}
+	run()
+
+	// Without moving files, the checkpoint prevents reading them again,
+	// until a file is rewritten.
+	opt.MoveTo = ""
+	writeFile("f.fstrm", old, followStream(t, true, "f1"))
+	run("f1")
+	run()
+	writeFile("f.fstrm", old, followStream(t, true, "f2", "f3"))
+	run("f2", "f3")
+
+	// A file recorded in the checkpoint, but whose removal was
+	// interrupted, is removed without being read again.
+	opt.Delete = true
+	run()
+	if _, err := os.Stat(filepath.Join(spool, "f.fstrm")); !os.IsNotExist(err) {
+		t.Errorf("f.fstrm not removed: %v", err)
+	}
+	data, err := ioutil.ReadFile(opt.Checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run()
+	data2, err := ioutil.ReadFile(opt.Checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data2) >= len(data) {
+		t.Errorf("removed file not forgotten in checkpoint:\n%s", data2)
+	}
+}
+
+func TestDirectoryInputStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "directory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	in, err := NewDirectoryInput(&DirectoryOptions{
+		Pattern:  filepath.Join(dir, "*"),
+		Interval: 5 * time.Millisecond,
+		MinAge:   time.Millisecond,
+		Delete:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan []byte, 16)
+	go in.ReadInto(ch)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a"), followStream(t, true, "a1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectFrames(t, ch, "a1")
+	in.Stop()
+	in.Wait()
+}
+
+func TestDirectoryInputManualCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "directory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "a.fstrm")
+	if err := ioutil.WriteFile(fname, followStream(t, true, "a1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(fname, old, old); err != nil {
+		t.Fatal(err)
+	}
+	opt := &DirectoryOptions{
+		Pattern:      filepath.Join(dir, "*.fstrm"),
+		MinAge:       time.Second,
+		Delete:       true,
+		Checkpoint:   filepath.Join(dir, "checkpoint"),
+		Once:         true,
+		ManualCommit: true,
+	}
+	in, err := NewDirectoryInput(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan []byte, 16)
+	go in.ReadInto(ch)
+	in.Wait()
+	expectFrames(t, ch, "a1")
+
+	// The file read is neither recorded nor deleted until committed.
+	if _, err := os.Stat(fname); err != nil {
+		t.Errorf("file deleted before commit: %v", err)
+	}
+	if _, err := os.Stat(opt.Checkpoint); !os.IsNotExist(err) {
+		t.Errorf("checkpoint written before commit: %v", err)
+	}
+	in.Commit()
+	if _, err := os.Stat(fname); !os.IsNotExist(err) {
+		t.Errorf("file not deleted after commit: %v", err)
+	}
+	if _, err := os.Stat(opt.Checkpoint); err != nil {
+		t.Errorf("checkpoint not written after commit: %v", err)
+	}
+}
+
+func TestDirectoryInputOptions(t *testing.T) {
+	for _, opt := range []*DirectoryOptions{
+		{},
+		{Pattern: "["},
+		{Pattern: "*", Delete: true, MoveTo: os.TempDir()},
+		{Pattern: "*", MoveTo: "/nonexistent"},
+	} {
+		if _, err := NewDirectoryInput(opt); err == nil {
+			t.Errorf("NewDirectoryInput(%+v) succeeded", opt)
+		}
+	}
+}
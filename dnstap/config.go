@@ -0,0 +1,597 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+)
+
+// A config describes the named inputs, processing stages, and outputs
+// given by a -config file. Every input sends its data to every output,
+// unless the output names the inputs it accepts data from. An output's
+// stages are applied in order to the data it receives.
+type config struct {
+	inputs  []*inputConfig
+	stages  []*stageConfig
+	outputs []*outputConfig
+}
+
+type inputConfig struct {
+	name string
+	typ  string // "file", "unix", "tcp", "udp", "http", or "systemd"
+	path string // file or unix socket path, tcp, udp, or http address, or systemd socket name
+	sock sockOptions
+	http httpOptions
+}
+
+type stageConfig struct {
+	name       string
+	typ        string // "filter"
+	types      map[dnstap.Message_Type]bool
+	identities map[string]bool
+	zones      []string
+	invert     bool
+}
+
+type outputConfig struct {
+	name    string
+	typ     string // "file", "unix", "tcp", "http", "kafka", or "syslog"
+	path    string // file or unix socket path, tcp address, URL, Kafka brokers, or syslog network:address
+	format  string // "dnstap", "text", "yaml", or "json"
+	file    fileOptions
+	post    postOptions
+	kafka   kafkaOptions
+	syslog  syslogOptions
+	timeout time.Duration
+	flush   time.Duration
+	retry   time.Duration
+	inputs  []string
+	stages  []string
+}
+
+// loadConfig reads and validates the configuration file fname.
+func loadConfig(fname string) (*config, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := parseTOML(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &config{}
+	names := make(map[string]map[string]bool)
+	for _, t := range tables {
+		d := &tableDecoder{t: t, used: make(map[string]bool)}
+		var name string
+		switch t.name {
+		case "input":
+			ic := decodeInput(d)
+			c.inputs = append(c.inputs, ic)
+			name = ic.name
+		case "stage":
+			sc := decodeStage(d)
+			c.stages = append(c.stages, sc)
+			name = sc.name
+		case "output":
+			oc := decodeOutput(d)
+			c.outputs = append(c.outputs, oc)
+			name = oc.name
+		default:
+			return nil, fmt.Errorf("line %d: unknown table [[%s]]", t.line, t.name)
+		}
+		if err := d.finish(); err != nil {
+			return nil, err
+		}
+		if names[t.name] == nil {
+			names[t.name] = make(map[string]bool)
+		}
+		if names[t.name][name] {
+			return nil, fmt.Errorf("line %d: duplicate %s name %q", t.line, t.name, name)
+		}
+		names[t.name][name] = true
+	}
+
+	if len(c.inputs) == 0 {
+		return nil, fmt.Errorf("no inputs configured")
+	}
+	if len(c.outputs) == 0 {
+		return nil, fmt.Errorf("no outputs configured")
+	}
+	for _, oc := range c.outputs {
+		for _, in := range oc.inputs {
+			if !names["input"][in] {
+				return nil, fmt.Errorf("output %q: unknown input %q", oc.name, in)
+			}
+		}
+		for _, st := range oc.stages {
+			if !names["stage"][st] {
+				return nil, fmt.Errorf("output %q: unknown stage %q", oc.name, st)
+			}
+		}
+	}
+	return c, nil
+}
+
+// A tableDecoder extracts the values of a configuration table, recording
+// the first error encountered.
+type tableDecoder struct {
+	t    *tomlTable
+	used map[string]bool
+	err  error
+}
+
+func (d *tableDecoder) errorf(line int, format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+	}
+}
+
+func (d *tableDecoder) value(key string) *tomlValue {
+	d.used[key] = true
+	return d.t.values[key]
+}
+
+func (d *tableDecoder) string(key string) string {
+	v := d.value(key)
+	if v == nil {
+		return ""
+	}
+	s, ok := v.v.(string)
+	if !ok {
+		d.errorf(v.line, "%s must be a string", key)
+	}
+	return s
+}
+
+func (d *tableDecoder) int(key string) int64 {
+	v := d.value(key)
+	if v == nil {
+		return 0
+	}
+	n, ok := v.v.(int64)
+	if !ok || n < 0 {
+		d.errorf(v.line, "%s must be a non-negative integer", key)
+	}
+	return n
+}
+
+// float returns the value of key, which may be written as an integer or
+// a float.
+func (d *tableDecoder) float(key string) float64 {
+	v := d.value(key)
+	if v == nil {
+		return 0
+	}
+	var f float64
+	switch n := v.v.(type) {
+	case int64:
+		f = float64(n)
+	case float64:
+		f = n
+	default:
+		d.errorf(v.line, "%s must be a non-negative number", key)
+	}
+	if f < 0 {
+		d.errorf(v.line, "%s must be a non-negative number", key)
+	}
+	return f
+}
+
+func (d *tableDecoder) bool(key string) bool {
+	v := d.value(key)
+	if v == nil {
+		return false
+	}
+	b, ok := v.v.(bool)
+	if !ok {
+		d.errorf(v.line, "%s must be true or false", key)
+	}
+	return b
+}
+
+func (d *tableDecoder) duration(key string) time.Duration {
+	v := d.value(key)
+	if v == nil {
+		return 0
+	}
+	s, _ := v.v.(string)
+	t, err := time.ParseDuration(s)
+	if err != nil || t < 0 {
+		d.errorf(v.line, "%s must be a duration, such as \"10s\"", key)
+	}
+	return t
+}
+
+func (d *tableDecoder) strings(key string) []string {
+	v := d.value(key)
+	if v == nil {
+		return nil
+	}
+	a, ok := v.v.([]*tomlValue)
+	if !ok {
+		d.errorf(v.line, "%s must be an array of strings", key)
+		return nil
+	}
+	var ss []string
+	for _, e := range a {
+		s, ok := e.v.(string)
+		if !ok {
+			d.errorf(e.line, "%s must be an array of strings", key)
+		}
+		ss = append(ss, s)
+	}
+	return ss
+}
+
+// require records an error if key is not set.
+func (d *tableDecoder) require(key string) {
+	if d.t.values[key] == nil {
+		d.errorf(d.t.line, "[[%s]] requires %s", d.t.name, key)
+	}
+}
+
+// oneOf records an error if the value s of key is not one of choices.
+func (d *tableDecoder) oneOf(key, s string, choices ...string) {
+	for _, c := range choices {
+		if s == c {
+			return
+		}
+	}
+	line := d.t.line
+	if v := d.t.values[key]; v != nil {
+		line = v.line
+	}
+	d.errorf(line, "%s must be one of %s", key, strings.Join(choices, ", "))
+}
+
+// finish returns the first error encountered, or an error if the table
+// has keys which were not used.
+func (d *tableDecoder) finish() error {
+	if d.err != nil {
+		return d.err
+	}
+	for _, key := range d.t.keys {
+		if !d.used[key] {
+			return fmt.Errorf("line %d: unknown [[%s]] key %s",
+				d.t.values[key].line, d.t.name, key)
+		}
+	}
+	return nil
+}
+
+// decodeEndpoint returns the type, one of types, and path or address of
+// an input or output. For a systemd input, the path is the name of the
+// sockets to use, or empty to use all of them, and for an HTTP output, it
+// is the URL.
+func decodeEndpoint(d *tableDecoder, types ...string) (typ, path string) {
+	d.require("type")
+	typ = d.string("type")
+	d.oneOf("type", typ, types...)
+	if typ == "systemd" {
+		return typ, d.string("socket")
+	}
+	if typ == "http" && d.t.name == "output" {
+		d.require("url")
+		return typ, d.string("url")
+	}
+	if typ == "kafka" {
+		d.require("brokers")
+		return typ, strings.Join(d.strings("brokers"), ",")
+	}
+	if typ == "tcp" || typ == "udp" || typ == "http" || typ == "syslog" {
+		d.require("address")
+		return typ, d.string("address")
+	}
+	d.require("path")
+	return typ, d.string("path")
+}
+
+func decodeInput(d *tableDecoder) *inputConfig {
+	d.require("name")
+	ic := &inputConfig{name: d.string("name")}
+	ic.typ, ic.path = decodeEndpoint(d, "file", "unix", "tcp", "udp", "http", "systemd")
+	if ic.typ == "udp" {
+		return ic
+	}
+	if ic.typ == "http" {
+		ic.http.timeout = d.duration("timeout")
+		ic.http.tokenFile = d.string("token-file")
+		ic.http.cert = d.string("cert")
+		ic.http.key = d.string("key")
+		return ic
+	}
+	ic.sock.timeout = d.duration("timeout")
+	if ic.typ == "file" {
+		return ic
+	}
+	if ic.sock.stamp = d.string("stamp"); ic.sock.stamp != "" {
+		d.oneOf("stamp", ic.sock.stamp, "identity", "extra")
+	}
+	ic.sock.maxConns = int(d.int("max-connections"))
+	ic.sock.maxPerSource = int(d.int("max-connections-per-source"))
+	ic.sock.idleTimeout = d.duration("idle-timeout")
+	ic.sock.maxRate = d.float("max-frame-rate")
+	ic.sock.uni = d.bool("unidirectional")
+	if ic.typ != "unix" {
+		return ic
+	}
+	if mode := d.string("mode"); mode != "" {
+		var err error
+		if ic.sock.unix.Mode, err = parseSocketMode(mode); err != nil {
+			d.errorf(d.t.values["mode"].line, "mode: %v", err)
+		}
+	}
+	ic.sock.unix.Owner = d.string("owner")
+	ic.sock.unix.Group = d.string("group")
+	ic.sock.unix.Force = d.bool("force")
+	return ic
+}
+
+func decodeStage(d *tableDecoder) *stageConfig {
+	d.require("name")
+	sc := &stageConfig{name: d.string("name")}
+	d.require("type")
+	sc.typ = d.string("type")
+	d.oneOf("type", sc.typ, "filter")
+
+	if types := d.strings("message-types"); types != nil {
+		sc.types = make(map[dnstap.Message_Type]bool)
+		for _, t := range types {
+			mt, ok := dnstap.Message_Type_value[strings.ToUpper(t)]
+			if !ok {
+				d.errorf(d.t.values["message-types"].line, "unknown message type %q", t)
+			}
+			sc.types[dnstap.Message_Type(mt)] = true
+		}
+	}
+	if ids := d.strings("identities"); ids != nil {
+		sc.identities = make(map[string]bool)
+		for _, id := range ids {
+			sc.identities[id] = true
+		}
+	}
+	for _, z := range d.strings("zones") {
+		sc.zones = append(sc.zones, dns.CanonicalName(z))
+	}
+	sc.invert = d.bool("invert")
+	return sc
+}
+
+func decodeOutput(d *tableDecoder) *outputConfig {
+	d.require("name")
+	oc := &outputConfig{name: d.string("name")}
+	oc.typ, oc.path = decodeEndpoint(d, "file", "unix", "tcp", "http", "kafka", "syslog")
+	oc.inputs = d.strings("inputs")
+	oc.stages = d.strings("stages")
+	oc.flush = d.duration("flush")
+
+	if oc.typ == "http" {
+		oc.timeout = d.duration("timeout")
+		oc.retry = d.duration("retry")
+		oc.post = postOptions{
+			format:    d.string("format"),
+			index:     d.string("index"),
+			batch:     int(d.int("batch-size")),
+			interval:  oc.flush,
+			gzip:      d.bool("gzip"),
+			headers:   d.strings("headers"),
+			tokenFile: d.string("token-file"),
+			timeout:   oc.timeout,
+			retries:   5,
+			retry:     oc.retry,
+		}
+		if oc.post.format == "" {
+			oc.post.format = "json"
+		}
+		d.oneOf("format", oc.post.format, "json", "bulk", "dnstap")
+		if d.t.values["retries"] != nil {
+			oc.post.retries = int(d.int("retries"))
+		}
+		return oc
+	}
+
+	if oc.typ == "kafka" {
+		oc.timeout = d.duration("timeout")
+		oc.retry = d.duration("retry")
+		oc.kafka = kafkaOptions{
+			topic:    d.string("topic"),
+			format:   d.string("format"),
+			byClient: d.bool("key-client"),
+			gzip:     d.bool("gzip"),
+			acks:     d.string("acks"),
+			batch:    int(d.int("batch-size")),
+			interval: oc.flush,
+			timeout:  oc.timeout,
+			retries:  5,
+			retry:    oc.retry,
+			tls:      d.bool("tls"),
+		}
+		if oc.kafka.topic == "" {
+			oc.kafka.topic = "dnstap"
+		}
+		if oc.kafka.format == "" {
+			oc.kafka.format = "dnstap"
+		}
+		d.oneOf("format", oc.kafka.format, "dnstap", "json")
+		if oc.kafka.acks == "" {
+			oc.kafka.acks = "leader"
+		}
+		d.oneOf("acks", oc.kafka.acks, "leader", "all", "none")
+		if d.t.values["retries"] != nil {
+			oc.kafka.retries = int(d.int("retries"))
+		}
+		return oc
+	}
+
+	if oc.typ == "syslog" {
+		oc.timeout = d.duration("timeout")
+		oc.retry = d.duration("retry")
+		oc.syslog = syslogOptions{
+			format:   d.string("format"),
+			facility: d.string("facility"),
+			severity: d.string("severity"),
+			rcodes:   strings.Join(d.strings("rcode-severity"), ","),
+			hostname: d.string("hostname"),
+			timeout:  oc.timeout,
+			retry:    oc.retry,
+		}
+		if oc.syslog.format == "" {
+			oc.syslog.format = "text"
+		}
+		d.oneOf("format", oc.syslog.format, "text", "json")
+		if oc.syslog.facility == "" {
+			oc.syslog.facility = "local0"
+		}
+		if _, ok := syslogFacilities[oc.syslog.facility]; !ok {
+			d.errorf(d.t.values["facility"].line, "unknown facility %q", oc.syslog.facility)
+		}
+		if oc.syslog.severity == "" {
+			oc.syslog.severity = "info"
+		}
+		if _, ok := syslogSeverities[oc.syslog.severity]; !ok {
+			d.errorf(d.t.values["severity"].line, "unknown severity %q", oc.syslog.severity)
+		}
+		return oc
+	}
+
+	if oc.typ != "file" {
+		oc.timeout = d.duration("timeout")
+		oc.retry = d.duration("retry")
+		return oc
+	}
+
+	oc.format = d.string("format")
+	if oc.format == "" {
+		oc.format = "dnstap"
+		if oc.path == "-" {
+			oc.format = "text"
+		}
+	}
+	if formatter, ok := outputFormats[oc.format]; ok {
+		oc.file.formatter = formatter
+	} else {
+		d.oneOf("format", oc.format, "dnstap", "text", "yaml", "json", "parquet")
+	}
+	oc.file.doAppend = d.bool("append")
+	oc.file.indexInterval = uint64(d.int("index"))
+	oc.file.workers = int(d.int("workers"))
+	oc.file.flush = oc.flush
+	if oc.format == "parquet" {
+		oc.file.parquet = true
+		oc.file.rowGroup = int(d.int("row-group"))
+		oc.file.maxRows = d.int("rotate-rows")
+		oc.file.maxAge = d.duration("rotate-interval")
+		oc.file.gzip = d.bool("gzip")
+	}
+	if (oc.format == "dnstap" || oc.format == "parquet") &&
+		(oc.file.doAppend || oc.file.workers > 0 || oc.flush > 0) {
+		d.errorf(d.t.line, "append, workers, and flush require a text format")
+	}
+	if oc.format != "dnstap" && oc.file.indexInterval > 0 {
+		d.errorf(d.t.line, "index requires the dnstap format")
+	}
+	return oc
+}
+
+// inputsChanged reports whether the inputs of c differ from those of old.
+func (c *config) inputsChanged(old *config) bool {
+	if len(c.inputs) != len(old.inputs) {
+		return true
+	}
+	for i, ic := range c.inputs {
+		if *ic != *old.inputs[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// output returns the output named name, or nil if there is none.
+func (c *config) output(name string) *outputConfig {
+	for _, oc := range c.outputs {
+		if oc.name == name {
+			return oc
+		}
+	}
+	return nil
+}
+
+// sameOutput reports whether oc and other open the same output. Their
+// inputs and stages may differ.
+func (oc *outputConfig) sameOutput(other *outputConfig) bool {
+	return oc.typ == other.typ && oc.path == other.path &&
+		oc.format == other.format && oc.timeout == other.timeout &&
+		oc.flush == other.flush && oc.retry == other.retry &&
+		oc.file.doAppend == other.file.doAppend &&
+		oc.file.indexInterval == other.file.indexInterval &&
+		oc.file.workers == other.file.workers &&
+		oc.file.rowGroup == other.file.rowGroup &&
+		oc.file.maxRows == other.file.maxRows &&
+		oc.file.maxAge == other.file.maxAge &&
+		oc.file.gzip == other.file.gzip &&
+		oc.post.equal(&other.post) && oc.kafka == other.kafka &&
+		oc.syslog == other.syslog
+}
+
+// stage returns the stage named name.
+func (c *config) stage(name string) *stageConfig {
+	for _, sc := range c.stages {
+		if sc.name == name {
+			return sc
+		}
+	}
+	return nil
+}
+
+// accept reports whether a filter stage passes the frame viewed in v.
+func (sc *stageConfig) accept(v *dnstap.View) bool {
+	return sc.match(v) != sc.invert
+}
+
+func (sc *stageConfig) match(v *dnstap.View) bool {
+	if sc.identities != nil && !sc.identities[string(v.Identity)] {
+		return false
+	}
+	if sc.types != nil && (!v.HasMessage || !sc.types[v.Message.Type]) {
+		return false
+	}
+	if sc.zones != nil {
+		if !v.HasMessage {
+			return false
+		}
+		q, err := v.Message.Question()
+		if err != nil {
+			return false
+		}
+		name := dns.CanonicalName(q.Name)
+		for _, z := range sc.zones {
+			if dns.IsSubDomain(z, name) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
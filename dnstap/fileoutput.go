@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	dnstap "github.com/dnstap/golang-dnstap"
 )
@@ -29,68 +31,128 @@ import (
 // Output channel buffer size value from main dnstap package.
 const outputChannelSize = 32
 
+// Output buffer size for text outputs flushed by the -flush interval.
+const textBufferSize = 64 * 1024
+
 //
 // A fileOutput implements a dnstap.Output which writes frames to a file
 // and closes and reopens the file on SIGHUP.
 //
 // Data frames are written in binary fstrm format unless a text formatting
-// function (dnstp.TextFormatFunc) is given or the filename is blank or "-".
-// In the latter case, data is written in compact (quiet) text format unless
-// an alternate text format is given on the assumption that stdout is a terminal.
+// function (dnstap.AppendFormatFunc) is given. If the filename is blank or
+// "-", data is written to stdout, which is not reopened on SIGHUP.
 //
+// If the indexInterval option is non-zero, binary fstrm files are written
+// with a sidecar index (dnstap.IndexFilename) of every indexInterval-th
+// frame.
 type fileOutput struct {
-	formatter dnstap.TextFormatFunc
-	filename  string
-	doAppend  bool
-	output    dnstap.Output
-	data      chan []byte
-	done      chan struct{}
+	filename string
+	opt      fileOptions
+	output   dnstap.Output
+	data     chan []byte
+	done     chan struct{}
+}
+
+// fileOptions holds the options for opening an output file.
+type fileOptions struct {
+	formatter     dnstap.AppendFormatFunc
+	doAppend      bool
+	indexInterval uint64
+	workers       int
+	flush         time.Duration
+
+	// Parquet files (-w parquet:file) are written with rows grouped by
+	// rowGroup, rotated after maxRows rows or maxAge.
+	parquet  bool
+	rowGroup int
+	maxRows  int64
+	maxAge   time.Duration
+	gzip     bool
+}
+
+// outputFormats maps the names of output file formats to their formatters.
+// The "dnstap" format writes Frame Streams data.
+var outputFormats = map[string]dnstap.AppendFormatFunc{
+	"dnstap": nil,
+	"text":   dnstap.AppendTextFormat,
+	"yaml":   dnstap.AppendYamlFormat,
+	"json":   dnstap.AppendJSONFormat,
 }
 
-func openOutputFile(filename string, formatter dnstap.TextFormatFunc, doAppend bool) (o dnstap.Output, err error) {
+// parseOutputFile splits an output file argument of the form
+// [format:]file into its format, if one of outputFormats or "parquet" is
+// given, and file name.
+func parseOutputFile(arg string) (format, fname string) {
+	if i := strings.IndexByte(arg, ':'); i > 0 {
+		if _, ok := outputFormats[arg[:i]]; ok || arg[:i] == "parquet" {
+			return arg[:i], arg[i+1:]
+		}
+	}
+	return "", arg
+}
+
+func openOutputFile(filename string, opt *fileOptions) (o dnstap.Output, err error) {
 	var fso *dnstap.FrameStreamOutput
 	var to *dnstap.TextOutput
-	if formatter == nil {
-		if filename == "-" || filename == "" {
-			to = dnstap.NewTextOutput(os.Stdout, dnstap.TextFormat)
-			to.SetLogger(logger)
-			return to, nil
-		}
+	if opt.parquet {
+		return openParquetOutput(filename, opt)
+	}
+	if opt.formatter == nil {
 		fso, err = dnstap.NewFrameStreamOutputFromFilename(filename)
 		if err == nil {
 			fso.SetLogger(logger)
+			fso.SetFramePool(framePool)
+			if opt.indexInterval > 0 && filename != "-" && filename != "" {
+				iw, err := os.Create(dnstap.IndexFilename(filename))
+				if err != nil {
+					return nil, err
+				}
+				fso.SetIndex(iw, opt.indexInterval)
+			}
 			return fso, nil
 		}
 	} else {
 		if filename == "-" || filename == "" {
-			if doAppend {
+			if opt.doAppend {
 				return nil, errors.New("cannot append to stdout (-)")
 			}
-			to = dnstap.NewTextOutput(os.Stdout, formatter)
-			to.SetLogger(logger)
+			to = dnstap.NewAppendTextOutput(os.Stdout, opt.formatter)
+			setupTextOutput(to, opt)
 			return to, nil
 		}
-		to, err = dnstap.NewTextOutputFromFilename(filename, formatter, doAppend)
-		if err == nil {
-			to.SetLogger(logger)
+		to, err = dnstap.NewAppendTextOutputFromFilename(filename, opt.formatter, opt.doAppend)
+		if err != nil {
+			return nil, err
 		}
+		setupTextOutput(to, opt)
 		return to, nil
 	}
 	return
 }
 
-func newFileOutput(filename string, formatter dnstap.TextFormatFunc, doAppend bool) (*fileOutput, error) {
-	o, err := openOutputFile(filename, formatter, doAppend)
+// setupTextOutput configures a text output with the logger, frame pool,
+// and the workers and flush options.
+func setupTextOutput(to *dnstap.TextOutput, opt *fileOptions) {
+	to.SetLogger(logger)
+	to.SetFramePool(framePool)
+	to.SetWorkers(opt.workers)
+	if opt.flush > 0 {
+		to.SetBufferSize(textBufferSize)
+		to.SetFlushTimeout(opt.flush)
+	}
+}
+
+func newFileOutput(filename string, opt *fileOptions) (*fileOutput, error) {
+	o, err := openOutputFile(filename, opt)
 	if err != nil {
 		return nil, err
 	}
 	return &fileOutput{
-		formatter: formatter,
-		filename:  filename,
-		doAppend:  doAppend,
-		output:    o,
-		data:      make(chan []byte, outputChannelSize),
-		done:      make(chan struct{}),
+		filename: filename,
+		opt:      *opt,
+		output:   o,
+		data:     make(chan []byte, outputChannelSize),
+		done:     make(chan struct{}),
 	}, nil
 }
 
@@ -105,7 +167,10 @@ func (fo *fileOutput) Close() {
 
 func (fo *fileOutput) RunOutputLoop() {
 	sigch := make(chan os.Signal, 1)
-	signal.Notify(sigch, os.Interrupt, syscall.SIGHUP)
+	signal.Notify(sigch, syscall.SIGHUP)
+	if !interruptStopsInputs {
+		signal.Notify(sigch, os.Interrupt)
+	}
 	o := fo.output
 	go o.RunOutputLoop()
 	defer func() {
@@ -121,8 +186,11 @@ func (fo *fileOutput) RunOutputLoop() {
 			o.GetOutputChannel() <- b
 		case sig := <-sigch:
 			if sig == syscall.SIGHUP {
+				if fo.filename == "-" || fo.filename == "" {
+					continue
+				}
 				o.Close()
-				newo, err := openOutputFile(fo.filename, fo.formatter, fo.doAppend)
+				newo, err := openOutputFile(fo.filename, &fo.opt)
 				if err != nil {
 					fmt.Fprintf(os.Stderr,
 						"dnstap: Error: failed to reopen %s: %v\n",
@@ -133,6 +201,9 @@ func (fo *fileOutput) RunOutputLoop() {
 				go o.RunOutputLoop()
 				continue
 			}
+			// Write out buffered data, and any file trailer,
+			// before exiting.
+			o.Close()
 			os.Exit(0)
 		}
 	}
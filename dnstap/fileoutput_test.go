@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestFileOutputInterrupt checks that data written to an output file is
+// not lost when dnstap is interrupted. As the interrupt exits the process,
+// the output is run in a child process of the test.
+func TestFileOutputInterrupt(t *testing.T) {
+	if arg := os.Getenv("DNSTAP_TEST_INTERRUPT"); arg != "" {
+		runInterruptedFileOutput(t, arg)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "interrupt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		format string
+		check  func(b []byte) bool
+	}{
+		{"json", func(b []byte) bool { return bytes.Count(b, []byte("\n")) == 3 }},
+		// The footer, ending with the magic number, is written.
+		{"parquet", func(b []byte) bool {
+			return len(b) > 8 && bytes.HasPrefix(b, []byte("PAR1")) && bytes.HasSuffix(b, []byte("PAR1"))
+		}},
+	} {
+		fname := filepath.Join(dir, "out."+tc.format)
+		cmd := exec.Command(os.Args[0], "-test.run=^TestFileOutputInterrupt$")
+		cmd.Env = append(os.Environ(), "DNSTAP_TEST_INTERRUPT="+tc.format+":"+fname)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %v\n%s", tc.format, err, out)
+		}
+		b, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tc.check(b) {
+			t.Errorf("%s: unexpected output after interrupt: %q", tc.format, b)
+		}
+	}
+}
+
+// runInterruptedFileOutput writes three frames to the output file given
+// as format:file by arg, and interrupts the process.
+func runInterruptedFileOutput(t *testing.T, arg string) {
+	format, fname := parseOutputFile(arg)
+	opt := &fileOptions{
+		formatter: outputFormats[format],
+		flush:     time.Hour,
+		parquet:   format == "parquet",
+	}
+	fo, err := newFileOutput(fname, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go fo.RunOutputLoop()
+	for _, id := range strings.Fields("a b c") {
+		fo.GetOutputChannel() <- testFrame(t, id)
+	}
+	// Once the output loop has received every frame, each has been
+	// passed to the file's output.
+	for len(fo.GetOutputChannel()) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGINT)
+	time.Sleep(5 * time.Second)
+	t.Fatal("not exited after interrupt")
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+)
+
+// generatorOptions returns the dnstap.GeneratorOptions given by the
+// -gen-* options.
+func generatorOptions() (*dnstap.GeneratorOptions, error) {
+	opt := &dnstap.GeneratorOptions{
+		Rate:           *flagGenRate,
+		Count:          *flagGenCount,
+		Duration:       *flagGenDuration,
+		Mix:            make(map[dnstap.Message_Type]float64),
+		Names:          *flagGenNames,
+		ZipfS:          *flagGenZipf,
+		Identity:       []byte("dnstap-generate"),
+		ReportInterval: *flagGenReport,
+		Logger:         logger,
+	}
+
+	for _, entry := range strings.Split(*flagGenMix, ",") {
+		kv := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		mt, ok := dnstap.Message_Type_value[strings.ToUpper(kv[0])]
+		if !ok {
+			return nil, fmt.Errorf("invalid -gen-mix message type %q", kv[0])
+		}
+		w := 1.0
+		if len(kv) == 2 {
+			var err error
+			if w, err = strconv.ParseFloat(kv[1], 64); err != nil {
+				return nil, fmt.Errorf("invalid -gen-mix weight %q", kv[1])
+			}
+		}
+		opt.Mix[dnstap.Message_Type(mt)] = w
+	}
+
+	for _, s := range strings.Split(*flagGenClients, ",") {
+		_, n, err := net.ParseCIDR(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid -gen-clients network: %v", err)
+		}
+		opt.Clients = append(opt.Clients, n)
+	}
+
+	if *flagGenSize != "" {
+		sizes := strings.SplitN(*flagGenSize, "-", 2)
+		var err error
+		if opt.MinResponseSize, err = strconv.Atoi(sizes[0]); err != nil {
+			return nil, fmt.Errorf("invalid -gen-response-size %q", *flagGenSize)
+		}
+		opt.MaxResponseSize = opt.MinResponseSize
+		if len(sizes) == 2 {
+			if opt.MaxResponseSize, err = strconv.Atoi(sizes[1]); err != nil {
+				return nil, fmt.Errorf("invalid -gen-response-size %q", *flagGenSize)
+			}
+		}
+	}
+	return opt, nil
+}
+
+// newGenerator creates the input for -generate, which stops generating
+// when dnstap is interrupted so that outputs are flushed and the achieved
+// throughput is reported. The outputs do not exit on an interrupt with
+// -generate (see interruptStopsInputs), but are closed when the
+// generator stops.
+func newGenerator() *dnstap.GeneratorInput {
+	opt, err := generatorOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: %v\n", err)
+		os.Exit(1)
+	}
+	g, err := dnstap.NewGeneratorInput(opt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: -generate: %v\n", err)
+		os.Exit(1)
+	}
+
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigch
+		g.Stop()
+	}()
+	return g
+}
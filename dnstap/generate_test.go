@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestGenerateInterrupt checks that interrupting -generate stops the
+// generator, reports the messages generated, and writes all of them to
+// the outputs. dnstap is run in a child process of the test.
+func TestGenerateInterrupt(t *testing.T) {
+	if fname := os.Getenv("DNSTAP_TEST_GENERATE"); fname != "" {
+		runInterruptedGenerate(fname)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "generate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "out.json")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestGenerateInterrupt$")
+	cmd.Env = append(os.Environ(), "DNSTAP_TEST_GENERATE="+fname)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	m := regexp.MustCompile(`GeneratorInput: generated (\d+) messages`).FindSubmatch(out)
+	if m == nil {
+		t.Fatalf("no throughput reported:\n%s", out)
+	}
+	n, _ := strconv.Atoi(string(m[1]))
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(b, []byte("\n")); lines != n || n == 0 {
+		t.Errorf("%d lines written, %d messages generated", lines, n)
+	}
+}
+
+// runInterruptedGenerate runs dnstap -generate, writing to fname, and
+// interrupts it once data has been written.
+func runInterruptedGenerate(fname string) {
+	go func() {
+		for {
+			if fi, err := os.Stat(fname); err == nil && fi.Size() > 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+	os.Args = []string{"dnstap", "-generate", "-gen-rate", "10000", "-w", "json:" + fname}
+	main()
+}
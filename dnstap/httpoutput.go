@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+)
+
+// postFormats maps the names of the -post-format formats to their
+// HTTPOutputFormats.
+var postFormats = map[string]dnstap.HTTPOutputFormat{
+	"json":   dnstap.HTTPOutputJSON,
+	"bulk":   dnstap.HTTPOutputBulk,
+	"dnstap": dnstap.HTTPOutputBatch,
+}
+
+// postOptions configures the HTTP outputs.
+type postOptions struct {
+	format    string // one of postFormats
+	index     string
+	batch     int
+	interval  time.Duration
+	gzip      bool
+	headers   []string // "Name: value"
+	tokenFile string   // file holding the bearer token, or empty
+	timeout   time.Duration
+	retries   int
+	retry     time.Duration
+}
+
+// equal reports whether opt and other configure the same output.
+func (opt *postOptions) equal(other *postOptions) bool {
+	return opt.format == other.format && opt.index == other.index &&
+		opt.batch == other.batch && opt.interval == other.interval &&
+		opt.gzip == other.gzip && opt.tokenFile == other.tokenFile &&
+		opt.timeout == other.timeout && opt.retries == other.retries &&
+		opt.retry == other.retry &&
+		strings.Join(opt.headers, "\n") == strings.Join(other.headers, "\n")
+}
+
+// newHTTPOutput creates an output posting batches of messages to url,
+// configured by opt.
+func newHTTPOutput(url string, opt *postOptions) (*dnstap.HTTPOutput, error) {
+	format, ok := postFormats[opt.format]
+	if !ok {
+		return nil, fmt.Errorf("invalid format %q", opt.format)
+	}
+	header := make(http.Header)
+	for _, h := range opt.headers {
+		i := strings.IndexByte(h, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", h)
+		}
+		header.Add(textproto.TrimString(h[:i]), textproto.TrimString(h[i+1:]))
+	}
+	var token string
+	if opt.tokenFile != "" {
+		b, err := ioutil.ReadFile(opt.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		if token = strings.TrimSpace(string(b)); token == "" {
+			return nil, fmt.Errorf("%s: empty token", opt.tokenFile)
+		}
+	}
+	o, err := dnstap.NewHTTPOutput(url, &dnstap.HTTPOutputOptions{
+		Format:        format,
+		Index:         opt.index,
+		BatchSize:     opt.batch,
+		FlushInterval: opt.interval,
+		Gzip:          opt.gzip,
+		Header:        header,
+		BearerToken:   token,
+		Timeout:       opt.timeout,
+		MaxRetries:    opt.retries,
+		RetryInterval: opt.retry,
+		Logger:        logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+	o.SetFramePool(framePool)
+	return o, nil
+}
+
+// addHTTPOutputs adds the -post outputs to mo.
+func addHTTPOutputs(mo *mirrorOutput, urls, headers stringList) error {
+	for _, url := range urls {
+		o, err := newHTTPOutput(url, &postOptions{
+			format:    *flagPostFormat,
+			index:     *flagPostIndex,
+			batch:     *flagPostBatch,
+			interval:  *flagPostFlush,
+			gzip:      *flagPostGzip,
+			headers:   headers,
+			tokenFile: *flagPostToken,
+			timeout:   *flagTimeout,
+			retries:   *flagPostRetries,
+		})
+		if err != nil {
+			return fmt.Errorf("HTTP output error on '%s': %v", url, err)
+		}
+		go o.RunOutputLoop()
+		mo.Add(o)
+	}
+	return nil
+}
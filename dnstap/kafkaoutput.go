@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+)
+
+// kafkaFormats maps the names of the -kafka-format formats to their
+// KafkaFormats.
+var kafkaFormats = map[string]dnstap.KafkaFormat{
+	"dnstap": dnstap.KafkaProtobuf,
+	"json":   dnstap.KafkaJSON,
+}
+
+// kafkaAcks maps the names of the -kafka-acks settings to their
+// KafkaAcks.
+var kafkaAcks = map[string]dnstap.KafkaAcks{
+	"leader": dnstap.KafkaAcksLeader,
+	"all":    dnstap.KafkaAcksAll,
+	"none":   dnstap.KafkaAcksNone,
+}
+
+// kafkaOptions configures the Kafka outputs.
+type kafkaOptions struct {
+	topic    string
+	format   string // one of kafkaFormats
+	byClient bool
+	gzip     bool
+	acks     string // one of kafkaAcks
+	batch    int
+	interval time.Duration
+	timeout  time.Duration
+	retries  int
+	retry    time.Duration
+	tls      bool
+}
+
+// newKafkaOutput creates an output producing messages to the Kafka cluster
+// with the comma-separated bootstrap brokers, configured by opt.
+func newKafkaOutput(brokers string, opt *kafkaOptions) (*dnstap.KafkaOutput, error) {
+	format, ok := kafkaFormats[opt.format]
+	if !ok {
+		return nil, fmt.Errorf("invalid format %q", opt.format)
+	}
+	acks, ok := kafkaAcks[opt.acks]
+	if !ok {
+		return nil, fmt.Errorf("invalid acks %q", opt.acks)
+	}
+	ko := &dnstap.KafkaOptions{
+		Topic:         opt.topic,
+		Format:        format,
+		KeyByClient:   opt.byClient,
+		Acks:          acks,
+		BatchSize:     opt.batch,
+		FlushInterval: opt.interval,
+		Timeout:       opt.timeout,
+		MaxRetries:    opt.retries,
+		RetryInterval: opt.retry,
+		Logger:        logger,
+	}
+	for _, b := range strings.Split(brokers, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			ko.Brokers = append(ko.Brokers, b)
+		}
+	}
+	if opt.gzip {
+		ko.Compression = dnstap.KafkaCompressionGzip
+	}
+	if opt.tls {
+		ko.TLS = &tls.Config{}
+	}
+	o, err := dnstap.NewKafkaOutput(ko)
+	if err != nil {
+		return nil, err
+	}
+	o.SetFramePool(framePool)
+	return o, nil
+}
+
+// addKafkaOutputs adds the -kafka outputs to mo.
+func addKafkaOutputs(mo *mirrorOutput, brokers stringList) error {
+	for _, b := range brokers {
+		o, err := newKafkaOutput(b, &kafkaOptions{
+			topic:    *flagKafkaTopic,
+			format:   *flagKafkaFormat,
+			byClient: *flagKafkaKey,
+			gzip:     *flagKafkaGzip,
+			acks:     *flagKafkaAcks,
+			batch:    *flagKafkaBatch,
+			timeout:  *flagTimeout,
+			retries:  *flagKafkaRetry,
+			tls:      *flagKafkaTLS,
+		})
+		if err != nil {
+			return fmt.Errorf("Kafka output error on '%s': %v", b, err)
+		}
+		go o.RunOutputLoop()
+		mo.Add(o)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+)
+
+type lintStats struct {
+	frames   uint64
+	errors   uint64
+	warnings uint64
+	problems map[string]uint64
+}
+
+// A lintOutput implements a dnstap.Output which validates each frame it
+// receives, reports every problem found, and summarizes the problems per
+// identity when closed.
+type lintOutput struct {
+	w       *bufio.Writer
+	frames  uint64
+	stats   map[string]*lintStats
+	data    chan []byte
+	stop    chan struct{}
+	done    chan struct{}
+	summary sync.Once
+}
+
+func newLintOutput(w io.Writer) *lintOutput {
+	return &lintOutput{
+		w:     bufio.NewWriter(w),
+		stats: make(map[string]*lintStats),
+		data:  make(chan []byte, outputChannelSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+func (lo *lintOutput) GetOutputChannel() chan []byte {
+	return lo.data
+}
+
+func (lo *lintOutput) RunOutputLoop() {
+	defer close(lo.done)
+	for {
+		var frame []byte
+		select {
+		case f, ok := <-lo.data:
+			if !ok {
+				return
+			}
+			frame = f
+		case <-lo.stop:
+			return
+		}
+		lo.frames++
+		dt, problems := dnstap.ValidateFrame(frame)
+		identity := lintIdentity(dt)
+		st, ok := lo.stats[identity]
+		if !ok {
+			st = &lintStats{problems: make(map[string]uint64)}
+			lo.stats[identity] = st
+		}
+		st.frames++
+		for _, p := range problems {
+			if p.Severity == dnstap.ValidationError {
+				st.errors++
+			} else {
+				st.warnings++
+			}
+			st.problems[p.String()]++
+			fmt.Fprintf(lo.w, "frame %d (identity %s): %s\n",
+				lo.frames, identity, p)
+		}
+		if len(problems) > 0 {
+			lo.w.Flush()
+		}
+	}
+}
+
+func lintIdentity(dt *dnstap.Dnstap) string {
+	if dt == nil {
+		return "(undecodable)"
+	}
+	if dt.Identity == nil {
+		return "(none)"
+	}
+	return fmt.Sprintf("%q", dt.Identity)
+}
+
+// Close waits for all pending frames to be validated, then writes the
+// per-identity summary.
+func (lo *lintOutput) Close() {
+	close(lo.data)
+	<-lo.done
+	lo.summary.Do(lo.summarize)
+}
+
+// Stop stops validating frames, leaving any pending frames unread, and
+// writes the per-identity summary of the frames validated so far. Unlike
+// Close, Stop may be called while inputs are still sending frames.
+func (lo *lintOutput) Stop() {
+	close(lo.stop)
+	<-lo.done
+	lo.summary.Do(lo.summarize)
+}
+
+func (lo *lintOutput) summarize() {
+	identities := make([]string, 0, len(lo.stats))
+	for id := range lo.stats {
+		identities = append(identities, id)
+	}
+	sort.Strings(identities)
+
+	fmt.Fprintf(lo.w, "\n%d frames from %d identities\n", lo.frames, len(identities))
+	for _, id := range identities {
+		st := lo.stats[id]
+		fmt.Fprintf(lo.w, "identity %s: %d frames, %d errors, %d warnings\n",
+			id, st.frames, st.errors, st.warnings)
+
+		problems := make([]string, 0, len(st.problems))
+		for p := range st.problems {
+			problems = append(problems, p)
+		}
+		sort.Slice(problems, func(i, j int) bool {
+			ci, cj := st.problems[problems[i]], st.problems[problems[j]]
+			if ci != cj {
+				return ci > cj
+			}
+			return problems[i] < problems[j]
+		})
+		for _, p := range problems {
+			fmt.Fprintf(lo.w, "    %8d  %s\n", st.problems[p], p)
+		}
+	}
+	lo.w.Flush()
+}
+
+// Failed returns true if any frame validated by the lintOutput had an
+// error-level problem. Failed must be called after Close or Stop.
+func (lo *lintOutput) Failed() bool {
+	for _, st := range lo.stats {
+		if st.errors > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// runLint validates the data read from the given inputs, writing the
+// problems found and a summary to the named file or stdout. runLint returns
+// true if any errors were found.
+func runLint(fname string, fileInputs, unixInputs, tcpInputs, udpInputs stringList) bool {
+	var w io.Writer = os.Stdout
+	if fname != "" && fname != "-" {
+		f, err := os.Create(fname)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dnstap: File output error on '%s': %v\n", fname, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	lo := newLintOutput(w)
+	go lo.RunOutputLoop()
+
+	// Live socket inputs never finish, so when interrupted, print the
+	// summary of the frames validated so far and exit. The inputs may
+	// still be sending, so the lintOutput is stopped rather than closed.
+	if !interruptStopsInputs {
+		sigch := make(chan os.Signal, 1)
+		signal.Notify(sigch, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sigch
+			lo.Stop()
+			if lo.Failed() {
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}()
+	}
+
+	startInputs(lo, fileInputs, unixInputs, tcpInputs, udpInputs).Wait()
+	lo.Close()
+	commitWatchInput()
+	return lo.Failed()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+)
+
+func TestLintOutput(t *testing.T) {
+	var buf bytes.Buffer
+	lo := newLintOutput(&buf)
+	go lo.RunOutputLoop()
+	lo.GetOutputChannel() <- testFrame(t, "ns1")
+	lo.GetOutputChannel() <- []byte{0xff}
+	lo.GetOutputChannel() <- testFrame(t, "ns1")
+	lo.Close()
+
+	out := buf.String()
+	for _, s := range []string{
+		"frame 2 (identity (undecodable)): error: protobuf decode failed",
+		"3 frames from 2 identities\n",
+		"identity \"ns1\": 2 frames, 0 errors, 4 warnings\n",
+		"       2  warning: message.query_message: missing for type CLIENT_QUERY\n",
+		"identity (undecodable): 1 frames, 1 errors, 0 warnings\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output does not contain %q:\n%s", s, out)
+		}
+	}
+	if !lo.Failed() {
+		t.Error("Failed() false after an undecodable frame")
+	}
+}
+
+func TestLintOutputStop(t *testing.T) {
+	var buf bytes.Buffer
+	lo := newLintOutput(&buf)
+	go lo.RunOutputLoop()
+
+	// An input still sending when the lintOutput is stopped must not
+	// send on a closed channel.
+	sent := make(chan struct{})
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		frame := testFrame(t, "ns1")
+		for i := 0; ; i++ {
+			select {
+			case lo.GetOutputChannel() <- frame:
+			case <-quit:
+				return
+			}
+			if i == 10 {
+				close(sent)
+			}
+		}
+	}()
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("frames not received")
+	}
+	lo.Stop()
+	if !strings.Contains(buf.String(), " identities\n") {
+		t.Errorf("no summary written when stopped:\n%s", buf.String())
+	}
+	if lo.Failed() {
+		t.Error("Failed() true without errors")
+	}
+}
+
+func TestRunLint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeInput := func(frames ...[]byte) string {
+		fname := filepath.Join(dir, "in.fstrm")
+		f, err := os.Create(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := dnstap.NewWriter(f, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, frame := range frames {
+			if _, err := w.WriteFrame(frame); err != nil {
+				t.Fatal(err)
+			}
+		}
+		w.Close()
+		f.Close()
+		return fname
+	}
+	out := filepath.Join(dir, "lint.txt")
+
+	in := writeInput(testFrame(t, "a"), testFrame(t, "b"))
+	if runLint(out, stringList{in}, nil, nil, nil) {
+		t.Error("runLint failed with only warnings")
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "\n2 frames from 2 identities\n") {
+		t.Errorf("unexpected summary:\n%s", b)
+	}
+
+	in = writeInput(testFrame(t, "a"), []byte{0xff})
+	if !runLint(out, stringList{in}, nil, nil, nil) {
+		t.Error("runLint did not fail with an undecodable frame")
+	}
+}
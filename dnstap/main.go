@@ -17,14 +17,23 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/dnstap/golang-dnstap"
 )
@@ -40,14 +49,100 @@ func (sl *stringList) String() string {
 }
 
 var (
-	flagTimeout    = flag.Duration("t", 0, "I/O timeout for tcp/ip and unix domain sockets")
-	flagWriteFile  = flag.String("w", "", "write output to file")
-	flagAppendFile = flag.Bool("a", false, "append to the given file, do not overwrite. valid only when outputting a text or YAML file.")
-	flagQuietText  = flag.Bool("q", false, "use quiet text output")
-	flagYamlText   = flag.Bool("y", false, "use verbose YAML output")
-	flagJSONText   = flag.Bool("j", false, "use verbose JSON output")
+	flagTimeout     = flag.Duration("t", 0, "I/O timeout for tcp/ip and unix domain sockets")
+	flagAppendFile  = flag.Bool("a", false, "append to the given file, do not overwrite. valid only when outputting a text or YAML file.")
+	flagQuietText   = flag.Bool("q", false, "use quiet text output")
+	flagYamlText    = flag.Bool("y", false, "use verbose YAML output")
+	flagJSONText    = flag.Bool("j", false, "use verbose JSON output")
+	flagLint        = flag.Bool("lint", false, "validate dnstap data, report problems, and summarize them per identity")
+	flagMerge       = flag.Bool("merge", false, "read -r files and directories together in timestamp order")
+	flagDedup       = flag.Bool("dedup", false, "with -merge, discard frames identical to one with the same timestamp")
+	flagStart       = flag.String("start", "", "write only messages at or after the given RFC 3339 time")
+	flagEnd         = flag.String("end", "", "write only messages before the given RFC 3339 time")
+	flagSplitCount  = flag.Int("split-count", 0, "split -w output into files of at most this many messages")
+	flagSplitSize   = flag.Int64("split-size", 0, "split -w output into files of at most this many bytes")
+	flagSplitIdent  = flag.Bool("split-identity", false, "split -w output into separate files per identity")
+	flagIndex       = flag.Uint64("index", 0, "write a sidecar index of every nth frame with Frame Streams -w output")
+	flagPqRowGroup  = flag.Int("parquet-row-group", 100000, "write -w parquet: output in row groups of this many rows")
+	flagPqRotRows   = flag.Int64("parquet-rotate-rows", 0, "start a new -w parquet: output file after this many rows")
+	flagPqRotTime   = flag.Duration("parquet-rotate-interval", 0, "start a new -w parquet: output file after this duration")
+	flagPqGzip      = flag.Bool("parquet-gzip", false, "compress -w parquet: output with gzip")
+	flagBuildIndex  = flag.Bool("build-index", false, "write sidecar indexes for the -r files and exit")
+	flagSeek        = flag.String("seek", "", "start reading -r files at the given RFC 3339 time")
+	flagSeekFrame   = flag.Uint64("seek-frame", 0, "start reading -r files at the given frame number")
+	flagReplay      = flag.String("replay", "", "re-send CLIENT_QUERY messages to the DNS server at host:port, outputting TOOL_QUERY/TOOL_RESPONSE records")
+	flagReplaySpd   = flag.Float64("replay-speed", 1, "replay pace relative to the original query times, or 0 for no pacing")
+	flagReplayWkr   = flag.Int("replay-workers", 1, "number of concurrent replay queries")
+	flagReplayNet   = flag.String("replay-net", "", "replay over \"udp\" or \"tcp\" instead of each message's original protocol")
+	flagDiff        = flag.Bool("diff", false, "compare the responses in two -r files and report discrepancies")
+	flagDiffClient  = flag.Bool("diff-client", false, "with -diff, pair responses only if their query addresses match")
+	flagDiffWindow  = flag.Duration("diff-window", 0, "with -diff, pair responses only if their times are within this duration")
+	flagDiffTTL     = flag.Int("diff-ttl", -1, "with -diff, report answer TTLs differing by more than this many seconds")
+	flagFollow      = flag.Bool("follow", false, "follow -r files as they grow, reopening them when rotated or truncated")
+	flagWatch       = flag.String("watch", "", "read the complete Frame Streams files matching the given glob pattern as they appear")
+	flagWatchOrder  = flag.String("watch-order", "name", "with -watch, read files in \"name\" or \"mtime\" order")
+	flagWatchAge    = flag.Duration("watch-age", dnstap.DefaultDirectoryMinAge, "with -watch, consider files complete when unmodified for this duration")
+	flagWatchDelete = flag.Bool("watch-delete", false, "with -watch, delete files after reading them")
+	flagWatchMove   = flag.String("watch-move", "", "with -watch, move files into the given directory after reading them")
+	flagWatchCkpt   = flag.String("watch-checkpoint", "", "with -watch, record the files read in the given file, so they are not read again on restart")
+	flagWatchOnce   = flag.Bool("watch-once", false, "with -watch, exit after reading the files present rather than waiting for more")
+	flagMaxConns    = flag.Int("max-conns", 0, "accept at most this many concurrent -u or -l connections to each socket")
+	flagMaxConnsSrc = flag.Int("max-conns-per-source", 0, "accept at most this many concurrent -u or -l connections from each address or user")
+	flagIdleTimeout = flag.Duration("idle-timeout", 0, "close -u and -l connections receiving no data for this duration")
+	flagMaxRate     = flag.Float64("max-frame-rate", 0, "read at most this many messages per second from each -u or -l connection")
+	flagSockMode    = flag.String("socket-mode", "", "set the permissions of -u sockets, in octal, e.g. 0660")
+	flagSockOwner   = flag.String("socket-owner", "", "set the owner of -u sockets, by name or ID")
+	flagSockGroup   = flag.String("socket-group", "", "set the group of -u sockets, by name or ID")
+	flagSockForce   = flag.Bool("socket-force", false, "remove any file at -u socket paths, even if not a socket or in use")
+	flagUni         = flag.Bool("unidirectional", false, "read -u, -l, and -systemd connections with the unidirectional Frame Streams protocol")
+	flagHTTP        = flag.String("http", "", "read dnstap payloads POSTed to an HTTP server listening on the given address")
+	flagHTTPToken   = flag.String("http-token-file", "", "with -http, accept only requests with the bearer token read from the given file")
+	flagHTTPCert    = flag.String("http-cert", "", "with -http, serve HTTPS with the certificate in the given PEM file")
+	flagHTTPKey     = flag.String("http-key", "", "with -http, serve HTTPS with the private key in the given PEM file")
+	flagPostFormat  = flag.String("post-format", "json", "with -post, post messages as \"json\" lines, Elasticsearch \"bulk\" actions, or \"dnstap\" protobufs")
+	flagPostIndex   = flag.String("post-index", "", "with -post-format bulk, the Elasticsearch index to write to")
+	flagPostBatch   = flag.Int("post-batch", 1000, "with -post, post at most this many messages per request")
+	flagPostFlush   = flag.Duration("post-interval", 5*time.Second, "with -post, post partial batches at this interval")
+	flagPostGzip    = flag.Bool("post-gzip", false, "with -post, compress requests with gzip")
+	flagPostToken   = flag.String("post-token-file", "", "with -post, send the bearer token read from the given file")
+	flagPostRetries = flag.Int("post-retries", 5, "with -post, retry failed requests this many times before discarding the batch")
+	flagKafkaTopic  = flag.String("kafka-topic", "dnstap", "with -kafka, produce to this topic, in which {identity} and {type} are replaced by each message's identity and type")
+	flagKafkaFormat = flag.String("kafka-format", "dnstap", "with -kafka, produce messages as \"dnstap\" protobufs or \"json\"")
+	flagKafkaKey    = flag.Bool("kafka-key-client", false, "with -kafka, key messages by client address, producing each client's messages to one partition")
+	flagKafkaGzip   = flag.Bool("kafka-gzip", false, "with -kafka, compress record batches with gzip")
+	flagKafkaAcks   = flag.String("kafka-acks", "leader", "with -kafka, require acknowledgement from the partition \"leader\", \"all\" replicas, or \"none\"")
+	flagKafkaBatch  = flag.Int("kafka-batch", 1000, "with -kafka, produce at most this many messages per batch")
+	flagKafkaRetry  = flag.Int("kafka-retries", 5, "with -kafka, retry failed batches this many times before discarding them")
+	flagKafkaTLS    = flag.Bool("kafka-tls", false, "with -kafka, connect to the brokers with TLS")
+	flagSyslogFmt   = flag.String("syslog-format", "text", "with -syslog, send messages in \"text\" (as with -q) or \"json\" format")
+	flagSyslogFac   = flag.String("syslog-facility", "local0", "with -syslog, send messages with this facility")
+	flagSyslogSev   = flag.String("syslog-severity", "info", "with -syslog, send messages with this severity")
+	flagSyslogRcode = flag.String("syslog-rcode-severity", "", "with -syslog, set the severity of responses by rcode, given as comma-separated RCODE=severity pairs, e.g. SERVFAIL=warning")
+	flagSyslogHost  = flag.String("syslog-hostname", "", "with -syslog, send messages with this hostname rather than the system's")
+	flagSystemd     = flag.Bool("systemd", false, "read dnstap payloads from the sockets passed by systemd socket activation")
+	flagStamp       = flag.String("stamp", "", "record the source connection of -u and -l data in each message's \"identity\" (if unset) or \"extra\" field")
+	flagConfig      = flag.String("config", "", "read inputs, processing stages, and outputs from the given configuration file")
+	flagWorkers     = flag.Int("workers", 1, "number of goroutines decoding and formatting text output")
+	flagFlush       = flag.Duration("flush", 0, "flush text output at this interval rather than after every message")
+	flagGenerate    = flag.Bool("generate", false, "generate synthetic dnstap traffic instead of reading inputs")
+	flagGenRate     = flag.Float64("gen-rate", 1000, "with -generate, messages per second, or 0 for no limit")
+	flagGenCount    = flag.Uint64("gen-count", 0, "with -generate, stop after this many messages")
+	flagGenDuration = flag.Duration("gen-duration", 0, "with -generate, stop after this duration")
+	flagGenMix      = flag.String("gen-mix", "CLIENT_QUERY=1,CLIENT_RESPONSE=1", "with -generate, relative frequencies of message types")
+	flagGenNames    = flag.Int("gen-names", 10000, "with -generate, number of distinct query names")
+	flagGenZipf     = flag.Float64("gen-zipf", 1.1, "with -generate, Zipf exponent of the query name distribution")
+	flagGenClients  = flag.String("gen-clients", "192.0.2.0/24,2001:db8::/64", "with -generate, networks of client addresses")
+	flagGenSize     = flag.String("gen-response-size", "", "with -generate, response message size range in bytes, as min-max")
+	flagGenReport   = flag.Duration("gen-report", 0, "with -generate, report throughput at this interval")
 )
 
+// socketMode is the parsed value of -socket-mode.
+var socketMode os.FileMode
+
+// seekTime is the parsed value of -seek, or of -start if no -seek or
+// -seek-frame is given.
+var seekTime time.Time
+
 func usage() {
 	fmt.Fprintf(os.Stderr, "Usage: %s [OPTION]...\n", os.Args[0])
 	flag.PrintDefaults()
@@ -68,17 +163,31 @@ Quiet text output format mnemonics:
 `)
 }
 
+// interruptStopsInputs is set if an interrupt stops the inputs, rather
+// than exiting at once, so that the outputs are flushed when the inputs
+// finish.
+var interruptStopsInputs bool
+
 var logger = log.New(os.Stderr, "", log.LstdFlags)
 
+// framePool recycles the frames passed from inputs to outputs.
+var framePool = dnstap.NewFramePool(0)
+
 func main() {
-	var tcpOutputs, unixOutputs stringList
-	var fileInputs, tcpInputs, unixInputs stringList
+	var fileOutputs, tcpOutputs, unixOutputs, postOutputs, postHeaders, kafkaOutputs, syslogOutputs stringList
+	var fileInputs, tcpInputs, unixInputs, udpInputs stringList
 
+	flag.Var(&fileOutputs, "w", "write output to file, given as [format:]file with format dnstap, text, yaml, json, or parquet")
 	flag.Var(&tcpOutputs, "T", "write dnstap payloads to tcp/ip address")
 	flag.Var(&unixOutputs, "U", "write dnstap payloads to unix socket")
+	flag.Var(&postOutputs, "post", "post batches of messages to HTTP or HTTPS URL")
+	flag.Var(&postHeaders, "post-header", "with -post, send the given \"Name: value\" header with each request")
+	flag.Var(&syslogOutputs, "syslog", "send RFC 5424 syslog messages to udp:host:port, tcp:host:port, or unix:path")
+	flag.Var(&kafkaOutputs, "kafka", "produce messages to the Kafka cluster with the given comma-separated host:port brokers")
 	flag.Var(&fileInputs, "r", "read dnstap payloads from file")
 	flag.Var(&tcpInputs, "l", "read dnstap payloads from tcp/ip")
 	flag.Var(&unixInputs, "u", "read dnstap payloads from unix socket")
+	flag.Var(&udpInputs, "udp", "read dnstap payloads, one per datagram, from udp address")
 
 	runtime.GOMAXPROCS(runtime.NumCPU())
 	log.SetFlags(0)
@@ -87,7 +196,70 @@ func main() {
 	// Handle command-line arguments.
 	flag.Parse()
 
-	if len(fileInputs)+len(unixInputs)+len(tcpInputs) == 0 {
+	startWatchdog()
+
+	// Sockets passed by systemd (-systemd) are read as other socket
+	// inputs.
+	sockInputs := len(unixInputs) + len(tcpInputs) + len(udpInputs)
+	if *flagSystemd {
+		sockInputs++
+	}
+	if *flagHTTP != "" {
+		sockInputs++
+	}
+
+	if *flagConfig != "" {
+		if len(fileInputs)+sockInputs+len(tcpOutputs)+len(unixOutputs)+len(postOutputs)+len(kafkaOutputs)+len(syslogOutputs) > 0 ||
+			len(fileOutputs) > 0 || *flagGenerate {
+			fmt.Fprintf(os.Stderr, "dnstap: Error: -config accepts no input or output options.\n")
+			os.Exit(1)
+		}
+		runConfig(*flagConfig)
+		return
+	}
+
+	stdin := 0
+	for _, fname := range fileInputs {
+		if fname == "-" {
+			stdin++
+		}
+	}
+	if stdin > 1 {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: stdin (-r -) may be read only once.\n")
+		os.Exit(1)
+	}
+	if *flagFollow && (stdin > 0 || *flagMerge || *flagDiff || *flagBuildIndex ||
+		*flagSeek != "" || *flagSeekFrame > 0 || *flagStart != "") {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: -follow cannot be used with stdin (-r -), -merge, -diff, -build-index, -seek, -seek-frame, or -start.\n")
+		os.Exit(1)
+	}
+
+	if *flagWatch != "" && (len(fileInputs)+sockInputs > 0 || *flagGenerate ||
+		*flagMerge || *flagDiff || *flagBuildIndex || *flagFollow || *flagSeek != "" || *flagSeekFrame > 0) {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: -watch cannot be used with other inputs, -generate, -merge, -diff, -build-index, -follow, -seek, or -seek-frame.\n")
+		os.Exit(1)
+	}
+	interruptStopsInputs = *flagWatch != "" || *flagGenerate
+
+	if *flagSockMode != "" {
+		mode, err := parseSocketMode(*flagSockMode)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dnstap: Error: invalid -socket-mode: %v\n", err)
+			os.Exit(1)
+		}
+		socketMode = mode
+	}
+	if _, ok := stampFuncs[*flagStamp]; !ok && *flagStamp != "" {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: -stamp must be \"identity\" or \"extra\".\n")
+		os.Exit(1)
+	}
+
+	if *flagGenerate {
+		if len(fileInputs)+sockInputs > 0 {
+			fmt.Fprintf(os.Stderr, "dnstap: Error: -generate accepts no inputs.\n")
+			os.Exit(1)
+		}
+	} else if len(fileInputs)+sockInputs == 0 && *flagWatch == "" {
 		fmt.Fprintf(os.Stderr, "dnstap: Error: no inputs specified.\n")
 		os.Exit(1)
 	}
@@ -101,6 +273,78 @@ func main() {
 		haveFormat = haveFormat || f
 	}
 
+	if *flagBuildIndex {
+		for _, fname := range fileInputs {
+			if err := buildIndex(fname, *flagIndex); err != nil {
+				fmt.Fprintf(os.Stderr, "dnstap: Failed to index %s: %v\n", fname, err)
+				os.Exit(1)
+			}
+		}
+		return
+	}
+
+	switch {
+	case *flagSeek != "":
+		t, err := time.Parse(time.RFC3339Nano, *flagSeek)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dnstap: Error: invalid -seek time: %v\n", err)
+			os.Exit(1)
+		}
+		seekTime = t
+	case *flagStart != "" && *flagSeekFrame == 0:
+		// Errors are reported with the other split options.
+		seekTime, _ = time.Parse(time.RFC3339Nano, *flagStart)
+	}
+
+	if *flagDiff {
+		if len(fileInputs) != 2 || sockInputs > 0 {
+			fmt.Fprintf(os.Stderr, "dnstap: Error: -diff requires exactly two file (-r) inputs.\n")
+			os.Exit(1)
+		}
+		runDiff(fileInputs[0], fileInputs[1], singleOutputFile(fileOutputs, "-diff", ""))
+		return
+	}
+
+	if *flagMerge && sockInputs > 0 {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: -merge accepts only file (-r) inputs.\n")
+		os.Exit(1)
+	}
+	if *flagDedup && !*flagMerge {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: -dedup requires -merge.\n")
+		os.Exit(1)
+	}
+
+	if *flagLint {
+		if haveFormat || len(tcpOutputs)+len(unixOutputs)+len(postOutputs)+len(kafkaOutputs)+len(syslogOutputs) > 0 {
+			fmt.Fprintf(os.Stderr, "dnstap: Error: -lint accepts no output options other than -w.\n")
+			os.Exit(1)
+		}
+		if runLint(singleOutputFile(fileOutputs, "-lint", ""), fileInputs, unixInputs, tcpInputs, udpInputs) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *flagStart != "" || *flagEnd != "" || *flagSplitCount > 0 || *flagSplitSize > 0 || *flagSplitIdent {
+		fname := singleOutputFile(fileOutputs, "-start, -end, and -split-*", "dnstap")
+		if fname == "" || fname == "-" || haveFormat || *flagAppendFile ||
+			len(tcpOutputs)+len(unixOutputs)+len(postOutputs)+len(kafkaOutputs)+len(syslogOutputs) > 0 {
+			fmt.Fprintf(os.Stderr, "dnstap: Error: -start, -end, and -split-* options require a Frame Streams output file (-w) and no other outputs.\n")
+			os.Exit(1)
+		}
+		opt, err := splitOptions()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dnstap: Error: %v\n", err)
+			os.Exit(1)
+		}
+		output := newSplitOutput(fname, opt)
+		go output.RunOutputLoop()
+		startInputs(output, fileInputs, unixInputs, tcpInputs, udpInputs).Wait()
+		output.Close()
+		commitWatchInput()
+		return
+	}
+
 	output := newMirrorOutput()
 	if err := addSockOutputs(output, "tcp", tcpOutputs); err != nil {
 		fmt.Fprintf(os.Stderr, "dnstap: TCP error: %v\n", err)
@@ -110,78 +354,587 @@ func main() {
 		fmt.Fprintf(os.Stderr, "dnstap: Unix socket error: %v\n", err)
 		os.Exit(1)
 	}
-	if *flagWriteFile != "" || len(tcpOutputs)+len(unixOutputs) == 0 {
-		var format dnstap.TextFormatFunc
+	if err := addHTTPOutputs(output, postOutputs, postHeaders); err != nil {
+		fmt.Fprintf(os.Stderr, "dnstap: %v\n", err)
+		os.Exit(1)
+	}
+	if err := addKafkaOutputs(output, kafkaOutputs); err != nil {
+		fmt.Fprintf(os.Stderr, "dnstap: %v\n", err)
+		os.Exit(1)
+	}
+	if err := addSyslogOutputs(output, syslogOutputs); err != nil {
+		fmt.Fprintf(os.Stderr, "dnstap: %v\n", err)
+		os.Exit(1)
+	}
+	if len(fileOutputs)+len(tcpOutputs)+len(unixOutputs)+len(postOutputs)+len(kafkaOutputs)+len(syslogOutputs) == 0 {
+		fileOutputs = stringList{"-"}
+	}
+	if err := addFileOutputs(output, fileOutputs); err != nil {
+		fmt.Fprintf(os.Stderr, "dnstap: %v\n", err)
+		os.Exit(1)
+	}
 
-		switch {
-		case *flagYamlText:
-			format = dnstap.YamlFormat
-		case *flagQuietText:
-			format = dnstap.TextFormat
-		case *flagJSONText:
-			format = dnstap.JSONFormat
-		}
+	go output.RunOutputLoop()
 
-		o, err := newFileOutput(*flagWriteFile, format, *flagAppendFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "dnstap: File output error on '%s': %v\n",
-				*flagWriteFile, err)
+	if *flagReplay != "" {
+		switch *flagReplayNet {
+		case "", "udp", "tcp":
+		default:
+			fmt.Fprintf(os.Stderr, "dnstap: Error: invalid -replay-net %q.\n", *flagReplayNet)
 			os.Exit(1)
 		}
-		go o.RunOutputLoop()
-		output.Add(o)
+		replay := dnstap.NewReplayOutput(*flagReplay, output.GetOutputChannel(),
+			&dnstap.ReplayOptions{
+				Speed:    *flagReplaySpd,
+				Workers:  *flagReplayWkr,
+				Timeout:  *flagTimeout,
+				Network:  *flagReplayNet,
+				Identity: []byte("dnstap-replay"),
+				Logger:   logger,
+			})
+		go replay.RunOutputLoop()
+		startInputs(replay, fileInputs, unixInputs, tcpInputs, udpInputs).Wait()
+		replay.Close()
+		output.Close()
+		commitWatchInput()
+		return
 	}
 
-	go output.RunOutputLoop()
+	startInputs(output, fileInputs, unixInputs, tcpInputs, udpInputs).Wait()
+
+	output.Close()
+	commitWatchInput()
+}
 
+// startInputs opens the given inputs and starts reading their data into
+// the output o. The returned WaitGroup completes when all inputs have
+// finished.
+func startInputs(o dnstap.Output, fileInputs, unixInputs, tcpInputs, udpInputs stringList) *sync.WaitGroup {
 	var iwg sync.WaitGroup
+	if *flagGenerate {
+		iwg.Add(1)
+		go runInput(newGenerator(), o, &iwg)
+	}
+	if *flagWatch != "" {
+		i, err := newDirectoryInput()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dnstap: Error: -watch: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "dnstap: watching %s\n", *flagWatch)
+		watchInput = i
+		iwg.Add(1)
+		go runInput(i, o, &iwg)
+	}
+	if *flagMerge {
+		fnames, err := expandFileInputs(fileInputs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dnstap: Failed to read input directory: %v\n", err)
+			os.Exit(1)
+		}
+		var readers []dnstap.Reader
+		for _, fname := range fnames {
+			r, err := openFileReader(fname)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "dnstap: Failed to open input file %s: %v\n", fname, err)
+				os.Exit(1)
+			}
+			readers = append(readers, r)
+		}
+		i := dnstap.NewMergeInput(readers...)
+		i.SetDeduplicate(*flagDedup)
+		i.SetLogger(logger)
+		fmt.Fprintf(os.Stderr, "dnstap: merging %d input files\n", len(fnames))
+		iwg.Add(1)
+		go runInput(i, o, &iwg)
+		fileInputs = nil
+	}
 	// Open the input and start the input loop.
 	for _, fname := range fileInputs {
-		i, err := dnstap.NewFrameStreamInputFromFilename(fname)
+		if *flagFollow {
+			i := dnstap.NewFollowInput(fname)
+			i.SetLogger(logger)
+			i.SetFramePool(framePool)
+			fmt.Fprintf(os.Stderr, "dnstap: following input file %s\n", fname)
+			iwg.Add(1)
+			go runInput(i, o, &iwg)
+			continue
+		}
+		r, err := openFileReader(fname)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "dnstap: Failed to open input file %s: %v\n", fname, err)
 			os.Exit(1)
 		}
+		i := dnstap.NewFrameStreamInputFromReader(r)
 		i.SetLogger(logger)
+		i.SetFramePool(framePool)
 		fmt.Fprintf(os.Stderr, "dnstap: opened input file %s\n", fname)
 		iwg.Add(1)
-		go runInput(i, output, &iwg)
+		go runInput(i, o, &iwg)
+	}
+	sopt := &sockOptions{
+		timeout:      *flagTimeout,
+		stamp:        *flagStamp,
+		maxConns:     *flagMaxConns,
+		maxPerSource: *flagMaxConnsSrc,
+		idleTimeout:  *flagIdleTimeout,
+		maxRate:      *flagMaxRate,
+		uni:          *flagUni,
+		unix: dnstap.UnixSocketOptions{
+			Mode:  socketMode,
+			Owner: *flagSockOwner,
+			Group: *flagSockGroup,
+			Force: *flagSockForce,
+		},
 	}
 	for _, path := range unixInputs {
-		i, err := dnstap.NewFrameStreamSockInputFromPath(path)
+		i, err := newSockInput("unix", path, sopt)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "dnstap: Failed to open input socket %s: %v\n", path, err)
 			os.Exit(1)
 		}
-		i.SetTimeout(*flagTimeout)
-		i.SetLogger(logger)
 		fmt.Fprintf(os.Stderr, "dnstap: opened input socket %s\n", path)
 		iwg.Add(1)
-		go runInput(i, output, &iwg)
+		go runInput(i, o, &iwg)
 	}
 	for _, addr := range tcpInputs {
-		l, err := net.Listen("tcp", addr)
+		i, err := newSockInput("tcp", addr, sopt)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "dnstap: Failed to listen on %s: %v\n", addr, err)
 			os.Exit(1)
 		}
-		i := dnstap.NewFrameStreamSockInput(l)
-		i.SetTimeout(*flagTimeout)
-		i.SetLogger(logger)
 		iwg.Add(1)
-		go runInput(i, output, &iwg)
+		go runInput(i, o, &iwg)
+	}
+	for _, addr := range udpInputs {
+		i, err := newDatagramInput(addr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dnstap: Failed to listen on udp %s: %v\n", addr, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "dnstap: listening on udp %s\n", addr)
+		iwg.Add(1)
+		go runInput(i, o, &iwg)
+	}
+	if *flagHTTP != "" {
+		i, err := newHTTPInput(*flagHTTP, &httpOptions{
+			timeout:   *flagTimeout,
+			tokenFile: *flagHTTPToken,
+			cert:      *flagHTTPCert,
+			key:       *flagHTTPKey,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dnstap: Failed to listen on http %s: %v\n", *flagHTTP, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "dnstap: listening on http %s\n", *flagHTTP)
+		iwg.Add(1)
+		go runInput(i, o, &iwg)
 	}
-	iwg.Wait()
+	if *flagSystemd {
+		i, err := newSystemdInput("", sopt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dnstap: Failed to use systemd sockets: %v\n", err)
+			os.Exit(1)
+		}
+		iwg.Add(1)
+		go runInput(i, o, &iwg)
+	}
+	dnstap.SystemdNotify("READY=1")
+	return &iwg
+}
 
-	output.Close()
+// stampFuncs maps the names of the fields in which the source connection
+// of socket input data can be recorded to their StampFuncs.
+var stampFuncs = map[string]dnstap.StampFunc{
+	"identity": dnstap.StampIdentity,
+	"extra":    dnstap.StampExtra,
+}
+
+// sockOptions configures the socket inputs.
+type sockOptions struct {
+	timeout      time.Duration
+	stamp        string // one of stampFuncs, or empty
+	maxConns     int
+	maxPerSource int
+	idleTimeout  time.Duration
+	maxRate      float64
+	uni          bool // use unidirectional Frame Streams
+	unix         dnstap.UnixSocketOptions
+}
+
+// parseSocketMode parses the octal permissions of a unix socket.
+func parseSocketMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("%q is not an octal file mode", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// newSockInput creates an input collecting dnstap data from clients of the
+// unix socket path or tcp address addr, configured by opt.
+func newSockInput(network, addr string, opt *sockOptions) (*dnstap.FrameStreamSockInput, error) {
+	var l net.Listener
+	var err error
+	if network == "unix" {
+		l, err = dnstap.ListenUnixSocket(addr, &opt.unix)
+	} else {
+		l, err = net.Listen(network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newListenerInput(l, opt), nil
+}
+
+// newListenerInput creates an input collecting dnstap data from clients
+// of the listener l, configured by opt.
+func newListenerInput(l net.Listener, opt *sockOptions) *dnstap.FrameStreamSockInput {
+	i := dnstap.NewFrameStreamSockInput(l)
+	i.SetTimeout(opt.timeout)
+	i.SetLogger(logger)
+	i.SetFramePool(framePool)
+	if opt.stamp != "" {
+		i.SetStamp(stampFuncs[opt.stamp])
+	}
+	i.SetMaxConnections(opt.maxConns)
+	i.SetMaxConnectionsPerSource(opt.maxPerSource)
+	i.SetIdleTimeout(opt.idleTimeout)
+	i.SetMaxFrameRate(opt.maxRate)
+	i.SetBidirectional(!opt.uni)
+	return i
+}
+
+// newDatagramInput creates an input reading dnstap data sent in UDP
+// datagrams to addr.
+func newDatagramInput(addr string) (*dnstap.DatagramInput, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	i := dnstap.NewDatagramInput(conn)
+	i.SetLogger(logger)
+	i.SetFramePool(framePool)
+	return i, nil
+}
+
+// httpOptions configures the HTTP input.
+type httpOptions struct {
+	timeout   time.Duration
+	tokenFile string // file holding the bearer token, or empty
+	cert, key string // PEM files for HTTPS, or empty for HTTP
+}
+
+// newHTTPInput creates an input reading dnstap data POSTed to an HTTP or
+// HTTPS server listening on addr, configured by opt.
+func newHTTPInput(addr string, opt *httpOptions) (*dnstap.HTTPInput, error) {
+	var token string
+	if opt.tokenFile != "" {
+		b, err := ioutil.ReadFile(opt.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		if token = strings.TrimSpace(string(b)); token == "" {
+			return nil, fmt.Errorf("%s: empty token", opt.tokenFile)
+		}
+	}
+	var tc *tls.Config
+	if opt.cert != "" || opt.key != "" {
+		cert, err := tls.LoadX509KeyPair(opt.cert, opt.key)
+		if err != nil {
+			return nil, err
+		}
+		tc = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tc != nil {
+		l = tls.NewListener(l, tc)
+	}
+	i := dnstap.NewHTTPInput(l)
+	i.SetLogger(logger)
+	i.SetFramePool(framePool)
+	i.SetBearerToken(token)
+	i.SetTimeout(opt.timeout)
+	return i, nil
+}
+
+// watchInput is the input for -watch, if any.
+var watchInput *dnstap.DirectoryInput
+
+// commitWatchInput records the files read by the -watch input, and deletes
+// or moves them, once the outputs have been closed. With -watch-once, this
+// is deferred until then so that no file is disposed of before its frames
+// are written.
+func commitWatchInput() {
+	if watchInput != nil {
+		watchInput.Commit()
+	}
+}
+
+// newDirectoryInput creates the input for -watch. An interrupt stops it
+// after the file being read, so that the files recorded in the checkpoint
+// are written in full before exiting; a second interrupt exits at once.
+func newDirectoryInput() (*dnstap.DirectoryInput, error) {
+	opt := &dnstap.DirectoryOptions{
+		Pattern:    *flagWatch,
+		MinAge:     *flagWatchAge,
+		Delete:     *flagWatchDelete,
+		MoveTo:     *flagWatchMove,
+		Checkpoint: *flagWatchCkpt,
+		Once:       *flagWatchOnce,
+		Logger:     logger,
+
+		// The outputs do not report when they have written their
+		// data, so only with -watch-once, when they are closed before
+		// exiting, can files be disposed of after being written.
+		// Waiting for exit otherwise would keep every file read.
+		ManualCommit: *flagWatchOnce,
+	}
+	switch *flagWatchOrder {
+	case "name":
+		opt.Order = dnstap.OrderByName
+	case "mtime":
+		opt.Order = dnstap.OrderByModTime
+	default:
+		return nil, fmt.Errorf("invalid -watch-order %q", *flagWatchOrder)
+	}
+	i, err := dnstap.NewDirectoryInput(opt)
+	if err != nil {
+		return nil, err
+	}
+	i.SetFramePool(framePool)
+
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigch
+		signal.Stop(sigch)
+		logger.Printf("dnstap: stopping after the current file")
+		i.Stop()
+	}()
+	return i, nil
+}
+
+func splitOptions() (opt dnstap.SplitOptions, err error) {
+	if *flagStart != "" {
+		if opt.Start, err = time.Parse(time.RFC3339Nano, *flagStart); err != nil {
+			return opt, fmt.Errorf("invalid -start time: %v", err)
+		}
+	}
+	if *flagEnd != "" {
+		if opt.End, err = time.Parse(time.RFC3339Nano, *flagEnd); err != nil {
+			return opt, fmt.Errorf("invalid -end time: %v", err)
+		}
+	}
+	opt.MaxMessages = *flagSplitCount
+	opt.MaxBytes = *flagSplitSize
+	opt.ByIdentity = *flagSplitIdent
+	return opt, nil
+}
+
+// openFileReader opens the named Frame Streams file for reading, seeking
+// to the position given by the -seek, -start, or -seek-frame options.
+func openFileReader(fname string) (dnstap.Reader, error) {
+	if fname == "-" {
+		if !seekTime.IsZero() || *flagSeekFrame > 0 {
+			return nil, errors.New("cannot seek in stdin")
+		}
+		return dnstap.NewReader(os.Stdin, nil)
+	}
+	if seekTime.IsZero() && *flagSeekFrame == 0 {
+		f, err := os.Open(fname)
+		if err != nil {
+			return nil, err
+		}
+		return dnstap.NewReader(f, nil)
+	}
+
+	r, err := dnstap.OpenIndexedFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	if seekTime.IsZero() {
+		err = r.SeekFrame(*flagSeekFrame)
+	} else {
+		err = r.SeekTime(seekTime)
+	}
+	if err != nil && err != io.EOF {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// runDiff compares the responses in the named files, writing a report to
+// the named output file or stdout.
+func runDiff(fnameA, fnameB, out string) {
+	var decoders []*dnstap.Decoder
+	for _, fname := range []string{fnameA, fnameB} {
+		r, err := openFileReader(fname)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dnstap: Failed to open input file %s: %v\n", fname, err)
+			os.Exit(1)
+		}
+		decoders = append(decoders, dnstap.NewDecoder(r, int(dnstap.MaxPayloadSize)))
+	}
+
+	report, err := dnstap.Diff(decoders[0], decoders[1], &dnstap.DiffOptions{
+		MatchClient:  *flagDiffClient,
+		MatchWindow:  *flagDiffWindow,
+		CompareTTL:   *flagDiffTTL >= 0,
+		TTLTolerance: uint32(*flagDiffTTL),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: -diff failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	w := os.Stdout
+	if out != "" && out != "-" {
+		if w, err = os.Create(out); err != nil {
+			fmt.Fprintf(os.Stderr, "dnstap: File output error on '%s': %v\n", out, err)
+			os.Exit(1)
+		}
+		defer w.Close()
+	}
+	if err := report.Format(w, fnameA, fnameB); err != nil {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: writing -diff report: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// buildIndex writes a sidecar index for the named Frame Streams file.
+func buildIndex(fname string, interval uint64) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ix, err := dnstap.BuildIndex(f, interval)
+	if err != nil {
+		return err
+	}
+	if err := ix.WriteFile(dnstap.IndexFilename(fname)); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "dnstap: indexed %s: %d entries\n", fname, len(ix.Entries))
+	return nil
+}
+
+// expandFileInputs replaces each directory in fileInputs with the regular
+// files it contains, in name order.
+func expandFileInputs(fileInputs stringList) ([]string, error) {
+	var fnames []string
+	for _, fname := range fileInputs {
+		if fname == "-" {
+			fnames = append(fnames, fname)
+			continue
+		}
+		fi, err := os.Stat(fname)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			fnames = append(fnames, fname)
+			continue
+		}
+		entries, err := os.ReadDir(fname)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Type().IsRegular() {
+				fnames = append(fnames, filepath.Join(fname, e.Name()))
+			}
+		}
+	}
+	return fnames, nil
 }
 
 func runInput(i dnstap.Input, o dnstap.Output, wg *sync.WaitGroup) {
-	go i.ReadInto(o.GetOutputChannel())
+	data, finish := watchdogChannel(o.GetOutputChannel())
+	go i.ReadInto(data)
 	i.Wait()
+	finish()
 	wg.Done()
 }
 
+// addFileOutputs adds the -w outputs, given as [format:]file, to mo.
+// Outputs without a format are written in the format given by -q, -y, or
+// -j, or in Frame Streams format.
+func addFileOutputs(mo *mirrorOutput, args stringList) error {
+	var defaultFormat dnstap.AppendFormatFunc
+	switch {
+	case *flagYamlText:
+		defaultFormat = dnstap.AppendYamlFormat
+	case *flagQuietText:
+		defaultFormat = dnstap.AppendTextFormat
+	case *flagJSONText:
+		defaultFormat = dnstap.AppendJSONFormat
+	}
+
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		format, fname := parseOutputFile(arg)
+		if fname == "" {
+			fname = "-"
+		}
+		if seen[fname] {
+			return fmt.Errorf("Error: output file %s given more than once", fname)
+		}
+		seen[fname] = true
+
+		formatter := defaultFormat
+		if format != "" {
+			formatter = outputFormats[format]
+		} else if formatter == nil && fname == "-" {
+			// Without a format, stdout is assumed to be a terminal.
+			formatter = dnstap.AppendTextFormat
+		}
+		o, err := newFileOutput(fname, &fileOptions{
+			formatter:     formatter,
+			doAppend:      *flagAppendFile,
+			indexInterval: *flagIndex,
+			workers:       *flagWorkers,
+			flush:         *flagFlush,
+			parquet:       format == "parquet",
+			rowGroup:      *flagPqRowGroup,
+			maxRows:       *flagPqRotRows,
+			maxAge:        *flagPqRotTime,
+			gzip:          *flagPqGzip,
+		})
+		if err != nil {
+			return fmt.Errorf("File output error on '%s': %v", fname, err)
+		}
+		go o.RunOutputLoop()
+		mo.Add(o)
+	}
+	return nil
+}
+
+// singleOutputFile returns the file name of the only -w output, for modes
+// writing a single file. The output may be given with the format allowed,
+// if any.
+func singleOutputFile(args stringList, mode, allowed string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	if len(args) > 1 {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: only one output file (-w) may be given with %s.\n", mode)
+		os.Exit(1)
+	}
+	format, fname := parseOutputFile(args[0])
+	if format != "" && format != allowed {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: the %s output format may not be given with %s.\n", format, mode)
+		os.Exit(1)
+	}
+	return fname
+}
+
 func addSockOutputs(mo *mirrorOutput, network string, addrs stringList) error {
 	var naddr net.Addr
 	var err error
@@ -198,14 +951,25 @@ func addSockOutputs(mo *mirrorOutput, network string, addrs stringList) error {
 			return err
 		}
 
-		o, err := dnstap.NewFrameStreamSockOutput(naddr)
+		o, err := newSockOutput(naddr, *flagTimeout)
 		if err != nil {
 			return err
 		}
-		o.SetTimeout(*flagTimeout)
-		o.SetLogger(logger)
 		go o.RunOutputLoop()
 		mo.Add(o)
 	}
 	return nil
 }
+
+// newSockOutput creates an output sending dnstap data to naddr with the
+// given I/O timeout.
+func newSockOutput(naddr net.Addr, timeout time.Duration) (*dnstap.FrameStreamSockOutput, error) {
+	o, err := dnstap.NewFrameStreamSockOutput(naddr)
+	if err != nil {
+		return nil, err
+	}
+	o.SetTimeout(timeout)
+	o.SetLogger(logger)
+	o.SetFramePool(framePool)
+	return o, nil
+}
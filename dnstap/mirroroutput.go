@@ -39,7 +39,14 @@ func (mo *mirrorOutput) Add(o dnstap.Output) {
 
 func (mo *mirrorOutput) RunOutputLoop() {
 	for b := range mo.data {
-		for _, o := range mo.outputs {
+		// Each output releases the frames it receives to framePool,
+		// so all but the last receive copies.
+		last := len(mo.outputs) - 1
+		for i, o := range mo.outputs {
+			if i < last {
+				o.GetOutputChannel() <- framePool.Copy(b)
+				continue
+			}
 			o.GetOutputChannel() <- b
 		}
 	}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+)
+
+// openParquetOutput opens an output writing Parquet files named filename,
+// or numbered before its extension, as with -split-count, if the output
+// is rotated. Numbered files which exist are skipped rather than
+// overwritten.
+func openParquetOutput(filename string, opt *fileOptions) (*dnstap.ParquetOutput, error) {
+	rotate := opt.maxRows > 0 || opt.maxAge > 0
+	stdout := filename == "-" || filename == ""
+	if stdout && rotate {
+		return nil, errors.New("cannot rotate stdout (-)")
+	}
+	po := &dnstap.ParquetOutputOptions{
+		Writer:  dnstap.ParquetOptions{RowGroupSize: opt.rowGroup},
+		MaxRows: opt.maxRows,
+		MaxAge:  opt.maxAge,
+		Logger:  logger,
+	}
+	if opt.gzip {
+		po.Writer.Compression = dnstap.ParquetGzip
+	}
+	next := 0
+	po.Create = func(int) (io.Writer, error) {
+		if stdout {
+			// Stdout is not closed with the file.
+			return struct{ io.Writer }{os.Stdout}, nil
+		}
+		if !rotate {
+			return os.Create(filename)
+		}
+		for {
+			name := splitFilename(filename, true, false, "", next)
+			next++
+			f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+			if os.IsExist(err) {
+				continue
+			}
+			if err == nil {
+				logger.Printf("dnstap: writing %s", name)
+			}
+			return f, err
+		}
+	}
+	if !stdout && !rotate {
+		// Report an unwritable file now rather than at the first
+		// message.
+		f, err := os.Create(filename)
+		if err != nil {
+			return nil, err
+		}
+		f.Close()
+	}
+	o, err := dnstap.NewParquetOutput(po)
+	if err != nil {
+		return nil, fmt.Errorf("Parquet output: %v", err)
+	}
+	o.SetFramePool(framePool)
+	return o, nil
+}
@@ -0,0 +1,361 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+)
+
+// A pipeline holds the outputs opened for a config.
+type pipeline struct {
+	cfg     *config
+	outputs []*pipelineOutput
+}
+
+type pipelineOutput struct {
+	cfg    *outputConfig
+	opened *outputConfig // the configuration the output was opened with
+	output dnstap.Output
+	file   os.FileInfo     // the file opened by a file output
+	sends  *sync.WaitGroup // frames being sent to the output
+	inputs map[string]bool
+	stages []*stageConfig
+}
+
+// openPipeline opens the outputs of c and starts their output loops. The
+// outputs in keep, indexed by name, are used instead of opening their
+// configured outputs again. If reload is true, text files are appended to
+// rather than truncated, so that reopening an output loses no data.
+func openPipeline(c *config, keep map[string]*pipelineOutput, reload bool) (*pipeline, error) {
+	p := &pipeline{cfg: c}
+	var opened []*pipelineOutput
+	for _, oc := range c.outputs {
+		po := &pipelineOutput{cfg: oc}
+		if k := keep[oc.name]; k != nil {
+			po.opened, po.output, po.file, po.sends = k.opened, k.output, k.file, k.sends
+		} else {
+			o, err := openConfigOutput(oc, reload)
+			if err != nil {
+				for _, po := range opened {
+					po.output.Close()
+				}
+				return nil, fmt.Errorf("output %q: %v", oc.name, err)
+			}
+			go o.RunOutputLoop()
+			po.opened, po.output, po.sends = oc, o, new(sync.WaitGroup)
+			if oc.typ == "file" && oc.path != "-" {
+				po.file, _ = os.Stat(oc.path)
+			}
+			opened = append(opened, po)
+		}
+
+		if oc.inputs != nil {
+			po.inputs = make(map[string]bool)
+			for _, in := range oc.inputs {
+				po.inputs[in] = true
+			}
+		}
+		for _, st := range oc.stages {
+			po.stages = append(po.stages, c.stage(st))
+		}
+		p.outputs = append(p.outputs, po)
+	}
+	return p, nil
+}
+
+// reusable reports whether the output can be kept for the configuration
+// oc: its configuration is unchanged, and the file it writes has not been
+// renamed or removed for rotation. Frame Streams and Parquet files cannot
+// be appended to, so an output writing one is kept until its file is
+// rotated, even if its configuration has changed.
+func (po *pipelineOutput) reusable(oc *outputConfig) bool {
+	cfg := po.opened
+	if cfg.typ != "file" || cfg.path == "-" {
+		return cfg.sameOutput(oc)
+	}
+	fi, err := os.Stat(cfg.path)
+	if err != nil || po.file == nil || !os.SameFile(fi, po.file) {
+		return false
+	}
+	if cfg.sameOutput(oc) {
+		return true
+	}
+	return oc.typ == "file" && oc.path == cfg.path &&
+		(cfg.file.formatter == nil || oc.file.formatter == nil)
+}
+
+// openConfigOutput opens the output configured by oc, appending to a text
+// file if reload is true.
+func openConfigOutput(oc *outputConfig, reload bool) (dnstap.Output, error) {
+	var naddr net.Addr
+	var err error
+	switch oc.typ {
+	case "file":
+		opt := oc.file
+		if reload && opt.formatter != nil && oc.path != "-" {
+			opt.doAppend = true
+		}
+		return openOutputFile(oc.path, &opt)
+	case "http":
+		return newHTTPOutput(oc.path, &oc.post)
+	case "kafka":
+		return newKafkaOutput(oc.path, &oc.kafka)
+	case "syslog":
+		return newSyslogOutput(oc.path, &oc.syslog)
+	case "unix":
+		naddr, err = net.ResolveUnixAddr("unix", oc.path)
+	default:
+		naddr, err = net.ResolveTCPAddr("tcp", oc.path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	o, err := newSockOutput(naddr, oc.timeout)
+	if err != nil {
+		return nil, err
+	}
+	if oc.flush > 0 {
+		o.SetFlushTimeout(oc.flush)
+	}
+	if oc.retry > 0 {
+		o.SetRetryInterval(oc.retry)
+	}
+	return o, nil
+}
+
+// close closes the pipeline's outputs, returning after they have written
+// all the data sent to them.
+func (p *pipeline) close() {
+	for _, po := range p.outputs {
+		po.close()
+	}
+}
+
+// close closes the output once the frames being sent to it have been
+// delivered.
+func (po *pipelineOutput) close() {
+	po.sends.Wait()
+	po.output.Close()
+}
+
+// targets appends to dst the outputs which accept frame from the named
+// input. The frame is parsed into v only if an output has stages.
+func (p *pipeline) targets(dst []*pipelineOutput, input string, frame []byte, v *dnstap.View) []*pipelineOutput {
+	parsed, valid := false, false
+outputs:
+	for _, po := range p.outputs {
+		if po.inputs != nil && !po.inputs[input] {
+			continue
+		}
+		for _, sc := range po.stages {
+			if !parsed {
+				valid = v.Parse(frame) == nil
+				parsed = true
+			}
+			if !valid || !sc.accept(v) {
+				continue outputs
+			}
+		}
+		dst = append(dst, po)
+	}
+	return dst
+}
+
+// A router sends the data of each input to the outputs of the current
+// pipeline. Replacing the pipeline holds further frames until the new
+// pipeline is open, and waits for the frames being sent to an output to
+// be delivered before closing it, so no data is lost. Frames are sent
+// without holding the lock, so an output which is not reading does not
+// prevent the pipeline from being replaced.
+type router struct {
+	mu sync.RWMutex
+	p  *pipeline
+}
+
+// route sends the frames read by the named input to the pipeline's
+// outputs until the input's data channel is closed.
+func (r *router) route(input string, data chan []byte) {
+	var v dnstap.View
+	var targets []*pipelineOutput
+	for b := range data {
+		r.mu.RLock()
+		targets = r.p.targets(targets[:0], input, b, &v)
+		for _, po := range targets {
+			po.sends.Add(1)
+		}
+		r.mu.RUnlock()
+		if len(targets) == 0 {
+			framePool.Put(b)
+		}
+		// Each output releases the frames it receives to framePool,
+		// so all but the last receive copies.
+		for i, po := range targets {
+			if i < len(targets)-1 {
+				po.output.GetOutputChannel() <- framePool.Copy(b)
+			} else {
+				po.output.GetOutputChannel() <- b
+			}
+			po.sends.Done()
+		}
+	}
+}
+
+// reload replaces the pipeline with one opened from the configuration
+// file fname. Unchanged outputs are kept, except for file outputs whose
+// files have been renamed or removed, which are reopened so that output
+// files can be rotated. Reopened text files are appended to. Changes to
+// outputs writing Frame Streams or Parquet files take effect when the file
+// is rotated. If the file is invalid, the current configuration is
+// reloaded. Changes to the inputs take effect only on restart.
+func (r *router) reload(fname string) {
+	dnstap.SystemdNotify("RELOADING=1")
+	defer dnstap.SystemdNotify("READY=1")
+	c, err := loadConfig(fname)
+	if err != nil {
+		logger.Printf("dnstap: Error: %s: %v; keeping the current configuration", fname, err)
+		c = r.p.cfg
+	}
+	if c.inputsChanged(r.p.cfg) {
+		logger.Printf("dnstap: %s: input changes take effect on restart", fname)
+		c.inputs = r.p.cfg.inputs
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keep := make(map[string]*pipelineOutput)
+	for _, po := range r.p.outputs {
+		if oc := c.output(po.cfg.name); oc != nil && po.reusable(oc) {
+			if !po.opened.sameOutput(oc) {
+				logger.Printf("dnstap: %s: output %q: changes take effect when %s is rotated",
+					fname, oc.name, oc.path)
+			}
+			keep[oc.name] = po
+			continue
+		}
+		po.close()
+	}
+	p, err := openPipeline(c, keep, true)
+	if err != nil && c != r.p.cfg {
+		logger.Printf("dnstap: Error: %s: %v; restoring the previous configuration", fname, err)
+		p, err = openPipeline(r.p.cfg, keep, true)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: %s: %v\n", fname, err)
+		os.Exit(1)
+	}
+	r.p = p
+	logger.Printf("dnstap: loaded %s", fname)
+}
+
+// shutdown closes the pipeline's outputs, holding any further frames.
+func (r *router) shutdown() {
+	r.mu.Lock()
+	r.p.close()
+}
+
+func openConfigInput(ic *inputConfig) (dnstap.Input, error) {
+	if ic.typ == "systemd" {
+		return newSystemdInput(ic.path, &ic.sock)
+	}
+	if ic.typ == "udp" {
+		return newDatagramInput(ic.path)
+	}
+	if ic.typ == "http" {
+		return newHTTPInput(ic.path, &ic.http)
+	}
+	if ic.typ != "file" {
+		return newSockInput(ic.typ, ic.path, &ic.sock)
+	}
+	rd, err := openFileReader(ic.path)
+	if err != nil {
+		return nil, err
+	}
+	i := dnstap.NewFrameStreamInputFromReader(rd)
+	i.SetLogger(logger)
+	i.SetFramePool(framePool)
+	return i, nil
+}
+
+// runConfig runs the inputs, stages, and outputs described by the
+// configuration file fname, reloading it on SIGHUP. It returns when all
+// inputs have finished and the outputs have been flushed.
+func runConfig(fname string) {
+	c, err := loadConfig(fname)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: %s: %v\n", fname, err)
+		os.Exit(1)
+	}
+	p, err := openPipeline(c, nil, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: %s: %v\n", fname, err)
+		os.Exit(1)
+	}
+	r := &router{p: p}
+
+	var wg sync.WaitGroup
+	for _, ic := range c.inputs {
+		i, err := openConfigInput(ic)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dnstap: Error: %s: input %q: %v\n", fname, ic.name, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "dnstap: opened input %s\n", ic.name)
+		data := make(chan []byte, outputChannelSize)
+		wg.Add(1)
+		go func() {
+			in, finish := watchdogChannel(data)
+			go i.ReadInto(in)
+			i.Wait()
+			finish()
+			close(data)
+		}()
+		go func(name string) {
+			r.route(name, data)
+			wg.Done()
+		}(ic.name)
+	}
+	dnstap.SystemdNotify("READY=1")
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, syscall.SIGHUP, os.Interrupt, syscall.SIGTERM)
+	for {
+		select {
+		case <-done:
+			r.shutdown()
+			return
+		case sig := <-sigch:
+			if sig == syscall.SIGHUP {
+				r.reload(fname)
+				continue
+			}
+			r.shutdown()
+			os.Exit(0)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"google.golang.org/protobuf/proto"
+)
+
+func testFrame(t *testing.T, identity string) []byte {
+	t.Helper()
+	b, err := proto.Marshal(&dnstap.Dnstap{
+		Type:     dnstap.Dnstap_MESSAGE.Enum(),
+		Identity: []byte(identity),
+		Message:  &dnstap.Message{Type: dnstap.Message_CLIENT_QUERY.Enum()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// countFrames returns the number of data frames in the Frame Streams file
+// fname.
+func countFrames(t *testing.T, fname string) int {
+	t.Helper()
+	f, err := os.Open(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := dnstap.NewReader(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	buf := make([]byte, 1024)
+	for {
+		if _, err := r.ReadFrame(buf); err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "dnstap.conf")
+	text := filepath.Join(dir, "out.json")
+	fstrm := filepath.Join(dir, "out.fstrm")
+	writeConfig := func(textOpts, fstrmOpts, extra string) {
+		t.Helper()
+		conf := fmt.Sprintf(`
+[[input]]
+name = "in"
+type = "file"
+path = "/dev/null"
+
+# Barrier frames are sent to wait for the preceding frames to be routed.
+[[stage]]
+name = "barrier"
+type = "filter"
+identities = ["barrier"]
+invert = true
+
+[[output]]
+name = "text"
+type = "file"
+path = %q
+format = "json"
+stages = ["barrier"]
+%s
+
+[[output]]
+name = "fstrm"
+type = "file"
+path = %q
+stages = ["barrier"]
+%s
+%s
+`, text, textOpts, fstrm, fstrmOpts, extra)
+		if err := ioutil.WriteFile(fname, []byte(conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig("", "", "")
+	c, err := loadConfig(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := openPipeline(c, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &router{p: p}
+	data := make(chan []byte)
+	done := make(chan struct{})
+	go func() {
+		r.route("in", data)
+		close(done)
+	}()
+	n := 0
+	send := func(count int) {
+		for i := 0; i < count; i++ {
+			n++
+			data <- testFrame(t, fmt.Sprint(n))
+		}
+		data <- testFrame(t, "barrier")
+	}
+	send(3)
+	// The changed text output is reopened, appending to its file. The
+	// change to the Frame Streams output waits for rotation.
+	writeConfig("workers = 2", "index = 1", "")
+	textOutput := r.p.outputs[0].output
+	r.reload(fname)
+	if r.p.outputs[0].output == textOutput {
+		t.Error("changed text output not reopened")
+	}
+	if po := r.p.outputs[1]; po.opened.file.indexInterval != 0 || po.cfg.file.indexInterval != 1 {
+		t.Errorf("Frame Streams output reopened before rotation")
+	}
+	send(3)
+
+	// A failed reload restores the previous configuration.
+	writeConfig("", "index = 1", fmt.Sprintf(`
+[[output]]
+name = "bad"
+type = "file"
+path = %q
+`, filepath.Join(dir, "missing", "out.fstrm")))
+	r.reload(fname)
+	if r.p.cfg.output("bad") != nil || r.p.cfg.output("text").file.workers != 2 {
+		t.Error("previous configuration not restored")
+	}
+	send(3)
+
+	// Rotating the Frame Streams file applies the deferred change.
+	writeConfig("workers = 2", "index = 1", "")
+	if err := os.Rename(fstrm, fstrm+".1"); err != nil {
+		t.Fatal(err)
+	}
+	r.reload(fname)
+	send(3)
+
+	close(data)
+	<-done
+	r.shutdown()
+
+	b, err := ioutil.ReadFile(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(b), "\n"); lines != 12 {
+		t.Errorf("%d lines in reopened text file, expected 12", lines)
+	}
+	if n := countFrames(t, fstrm+".1"); n != 9 {
+		t.Errorf("%d frames in rotated file, expected 9", n)
+	}
+	if n := countFrames(t, fstrm); n != 3 {
+		t.Errorf("%d frames in reopened file, expected 3", n)
+	}
+	if _, err := os.Stat(dnstap.IndexFilename(fstrm)); err != nil {
+		t.Errorf("index of reopened file: %v", err)
+	}
+}
+
+// A stalledOutput accepts frames only when told to.
+type stalledOutput struct {
+	data chan []byte
+}
+
+func (o *stalledOutput) GetOutputChannel() chan []byte { return o.data }
+func (o *stalledOutput) RunOutputLoop()                {}
+func (o *stalledOutput) Close()                        {}
+
+func TestReloadStalledOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "dnstap.conf")
+	conf := `
+[[input]]
+name = "in"
+type = "file"
+path = "/dev/null"
+
+[[output]]
+name = "stalled"
+type = "tcp"
+address = "127.0.0.1:1"
+`
+	if err := ioutil.WriteFile(fname, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadConfig(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &stalledOutput{data: make(chan []byte)}
+	oc := c.output("stalled")
+	r := &router{p: &pipeline{cfg: c, outputs: []*pipelineOutput{
+		{cfg: oc, opened: oc, output: o, sends: new(sync.WaitGroup)},
+	}}}
+
+	data := make(chan []byte, 2)
+	data <- testFrame(t, "1")
+	data <- testFrame(t, "2")
+	close(data)
+	done := make(chan struct{})
+	go func() {
+		r.route("in", data)
+		close(done)
+	}()
+
+	// The unchanged output is kept while a frame is being sent to it.
+	<-o.data
+	reloaded := make(chan struct{})
+	go func() {
+		r.reload(fname)
+		close(reloaded)
+	}()
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload blocked by a stalled output")
+	}
+	if r.p.outputs[0].output != o {
+		t.Error("unchanged output not kept")
+	}
+	<-o.data
+	<-done
+}
+
+func TestConfigMaxFrameRate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "dnstap.conf")
+	for _, tc := range []struct {
+		value string
+		rate  float64
+		err   bool
+	}{
+		{"0.5", 0.5, false},
+		{"20", 20, false},
+		{"-1.5", 0, true},
+		{`"fast"`, 0, true},
+	} {
+		conf := fmt.Sprintf(`
+[[input]]
+name = "in"
+type = "tcp"
+address = "127.0.0.1:0"
+max-frame-rate = %s
+
+[[output]]
+name = "out"
+type = "file"
+path = "/dev/null"
+`, tc.value)
+		if err := ioutil.WriteFile(fname, []byte(conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+		c, err := loadConfig(fname)
+		if tc.err {
+			if err == nil {
+				t.Errorf("max-frame-rate = %s: no error", tc.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("max-frame-rate = %s: %v", tc.value, err)
+			continue
+		}
+		if rate := c.inputs[0].sock.maxRate; rate != tc.rate {
+			t.Errorf("max-frame-rate = %s: rate %v, expected %v", tc.value, rate, tc.rate)
+		}
+	}
+}
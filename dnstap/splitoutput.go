@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"google.golang.org/protobuf/proto"
+)
+
+// A splitOutput implements a dnstap.Output which writes the frames it
+// receives to a series of Frame Streams files through a
+// dnstap.SplitEncoder.
+type splitOutput struct {
+	enc  *dnstap.SplitEncoder
+	data chan []byte
+	done chan struct{}
+}
+
+// splitFilename returns the name of the nth file of a split output named
+// fname. Files are numbered before the extension of fname, preceded by
+// the identity, if not empty, if the output is split by identity. Bytes
+// of the identity other than letters, digits, '-', and '_' are escaped as
+// '%' and two hexadecimal digits, so that each identity has distinct
+// file names.
+func splitFilename(fname string, split, byIdentity bool, identity string, n int) string {
+	if !split {
+		return fname
+	}
+	ext := filepath.Ext(fname)
+	name := strings.TrimSuffix(fname, ext)
+	if byIdentity && identity != "" {
+		var b strings.Builder
+		for i := 0; i < len(identity); i++ {
+			switch c := identity[i]; {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z',
+				c >= '0' && c <= '9', c == '-', c == '_':
+				b.WriteByte(c)
+			default:
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		name += "." + b.String()
+	}
+	return fmt.Sprintf("%s.%04d%s", name, n, ext)
+}
+
+func newSplitOutput(fname string, opt dnstap.SplitOptions) *splitOutput {
+	split := opt.MaxMessages > 0 || opt.MaxBytes > 0 || opt.ByIdentity
+	// Names differing only in case name the same file on some file
+	// systems, so such a file is checked before it is overwritten.
+	created := make(map[string]os.FileInfo)
+	opt.Create = func(identity string, n int) (io.Writer, error) {
+		name := splitFilename(fname, split, opt.ByIdentity, identity, n)
+		key := strings.ToLower(name)
+		if other, ok := created[key]; ok {
+			if fi, err := os.Stat(name); err == nil && os.SameFile(fi, other) {
+				return nil, fmt.Errorf("%s: file already written for another identity", name)
+			}
+		}
+		f, err := os.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if fi, err := f.Stat(); err == nil {
+			created[key] = fi
+		}
+		fmt.Fprintf(os.Stderr, "dnstap: writing %s\n", name)
+		return f, nil
+	}
+	return &splitOutput{
+		enc:  dnstap.NewSplitEncoder(&opt),
+		data: make(chan []byte, outputChannelSize),
+		done: make(chan struct{}),
+	}
+}
+
+func (so *splitOutput) GetOutputChannel() chan []byte {
+	return so.data
+}
+
+func (so *splitOutput) RunOutputLoop() {
+	defer close(so.done)
+	for frame := range so.data {
+		dt := &dnstap.Dnstap{}
+		if err := proto.Unmarshal(frame, dt); err != nil {
+			logger.Printf("dnstap: discarding undecodable frame: %v", err)
+			continue
+		}
+		if err := so.enc.Encode(dt); err != nil {
+			fmt.Fprintf(os.Stderr, "dnstap: Error: split output failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func (so *splitOutput) Close() {
+	close(so.data)
+	<-so.done
+	if err := so.enc.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "dnstap: Error: split output failed: %v\n", err)
+		os.Exit(1)
+	}
+}
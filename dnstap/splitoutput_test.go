@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestSplitFilename(t *testing.T) {
+	for _, tc := range []struct {
+		identity, name string
+	}{
+		{"", "out.0003.fstrm"},
+		{"ns1", "out.ns1.0003.fstrm"},
+		{"a_b-c", "out.a_b-c.0003.fstrm"},
+		{"a.b", "out.a%2Eb.0003.fstrm"},
+		{"a%2Eb", "out.a%252Eb.0003.fstrm"},
+		{"../x/é", "out.%2E%2E%2Fx%2F%C3%A9.0003.fstrm"},
+	} {
+		if name := splitFilename("out.fstrm", true, true, tc.identity, 3); name != tc.name {
+			t.Errorf("identity %q: file %s, expected %s", tc.identity, name, tc.name)
+		}
+	}
+	if name := splitFilename("out.fstrm", true, false, "ns1", 3); name != "out.0003.fstrm" {
+		t.Errorf("file %s without identities", name)
+	}
+	if name := splitFilename("out.fstrm", false, false, "", 3); name != "out.fstrm" {
+		t.Errorf("file %s without splitting", name)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+)
+
+// syslogFacilities maps the names of syslog facilities to their codes.
+var syslogFacilities = map[string]dnstap.SyslogFacility{
+	"user":     dnstap.SyslogUser,
+	"mail":     dnstap.SyslogMail,
+	"daemon":   dnstap.SyslogDaemon,
+	"auth":     dnstap.SyslogAuth,
+	"syslog":   dnstap.SyslogSyslog,
+	"lpr":      dnstap.SyslogLPR,
+	"news":     dnstap.SyslogNews,
+	"uucp":     dnstap.SyslogUUCP,
+	"cron":     dnstap.SyslogCron,
+	"authpriv": dnstap.SyslogAuthPriv,
+	"ftp":      dnstap.SyslogFTP,
+	"ntp":      dnstap.SyslogNTP,
+	"audit":    dnstap.SyslogAudit,
+	"alert":    dnstap.SyslogAlert,
+	"clock":    dnstap.SyslogClock,
+	"local0":   dnstap.SyslogLocal0,
+	"local1":   dnstap.SyslogLocal1,
+	"local2":   dnstap.SyslogLocal2,
+	"local3":   dnstap.SyslogLocal3,
+	"local4":   dnstap.SyslogLocal4,
+	"local5":   dnstap.SyslogLocal5,
+	"local6":   dnstap.SyslogLocal6,
+	"local7":   dnstap.SyslogLocal7,
+}
+
+// syslogSeverities maps the names of syslog severities to their levels.
+var syslogSeverities = map[string]dnstap.SyslogSeverity{
+	"alert":   dnstap.SyslogAlertSeverity,
+	"crit":    dnstap.SyslogCritical,
+	"err":     dnstap.SyslogError,
+	"warning": dnstap.SyslogWarning,
+	"notice":  dnstap.SyslogNotice,
+	"info":    dnstap.SyslogInfo,
+	"debug":   dnstap.SyslogDebug,
+}
+
+// syslogOptions configures the syslog outputs.
+type syslogOptions struct {
+	format   string // "text" or "json"
+	facility string // one of syslogFacilities
+	severity string // one of syslogSeverities
+	rcodes   string // comma-separated RCODE=severity settings
+	hostname string
+	timeout  time.Duration
+	retry    time.Duration
+}
+
+// newSyslogOutput creates an output sending syslog messages to dest, given
+// as network:address, configured by opt.
+func newSyslogOutput(dest string, opt *syslogOptions) (*dnstap.SyslogOutput, error) {
+	i := strings.IndexByte(dest, ':')
+	if i < 0 {
+		return nil, fmt.Errorf("expected udp:, tcp:, or unix: before address")
+	}
+	so := &dnstap.SyslogOptions{
+		Hostname:      opt.hostname,
+		Timeout:       opt.timeout,
+		RetryInterval: opt.retry,
+		Logger:        logger,
+	}
+	switch opt.format {
+	case "text":
+	case "json":
+		so.Format = dnstap.SyslogJSON
+	default:
+		return nil, fmt.Errorf("invalid format %q", opt.format)
+	}
+	var ok bool
+	if so.Facility, ok = syslogFacilities[opt.facility]; !ok {
+		return nil, fmt.Errorf("invalid facility %q", opt.facility)
+	}
+	if so.Severity, ok = syslogSeverities[opt.severity]; !ok {
+		return nil, fmt.Errorf("invalid severity %q", opt.severity)
+	}
+	if opt.rcodes != "" {
+		so.RcodeSeverity = make(map[int]dnstap.SyslogSeverity)
+		for _, s := range strings.Split(opt.rcodes, ",") {
+			kv := strings.SplitN(strings.TrimSpace(s), "=", 2)
+			rcode, ok := dns.StringToRcode[strings.ToUpper(kv[0])]
+			if len(kv) != 2 || !ok {
+				return nil, fmt.Errorf("invalid rcode severity %q, expected RCODE=severity", s)
+			}
+			if so.RcodeSeverity[rcode], ok = syslogSeverities[kv[1]]; !ok {
+				return nil, fmt.Errorf("invalid severity %q", kv[1])
+			}
+		}
+	}
+	o, err := dnstap.NewSyslogOutput(dest[:i], dest[i+1:], so)
+	if err != nil {
+		return nil, err
+	}
+	o.SetFramePool(framePool)
+	return o, nil
+}
+
+// addSyslogOutputs adds the -syslog outputs to mo.
+func addSyslogOutputs(mo *mirrorOutput, dests stringList) error {
+	for _, dest := range dests {
+		o, err := newSyslogOutput(dest, &syslogOptions{
+			format:   *flagSyslogFmt,
+			facility: *flagSyslogFac,
+			severity: *flagSyslogSev,
+			rcodes:   *flagSyslogRcode,
+			hostname: *flagSyslogHost,
+			timeout:  *flagTimeout,
+		})
+		if err != nil {
+			return fmt.Errorf("syslog output error on '%s': %v", dest, err)
+		}
+		go o.RunOutputLoop()
+		mo.Add(o)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+)
+
+// The sockets passed by systemd socket activation, which are taken from
+// the environment once and used by at most one input each.
+var systemd struct {
+	once      sync.Once
+	listeners map[string][]net.Listener
+	err       error
+}
+
+// systemdListeners returns the listeners passed by systemd with the given
+// name, or all of them if name is empty. Each listener is returned only
+// once.
+func systemdListeners(name string) ([]net.Listener, error) {
+	systemd.once.Do(func() {
+		systemd.listeners, systemd.err = dnstap.SystemdListeners()
+	})
+	if systemd.err != nil {
+		return nil, systemd.err
+	}
+	var names []string
+	for n := range systemd.listeners {
+		if name == "" || n == name {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	var ls []net.Listener
+	for _, n := range names {
+		ls = append(ls, systemd.listeners[n]...)
+		delete(systemd.listeners, n)
+	}
+	if len(ls) == 0 {
+		if name == "" {
+			return nil, errors.New("no sockets passed by systemd")
+		}
+		return nil, fmt.Errorf("no socket named %q passed by systemd", name)
+	}
+	return ls, nil
+}
+
+// newSystemdInput creates an input collecting dnstap data from clients of
+// the sockets passed by systemd with the given name, or of all of them if
+// name is empty, configured by opt.
+func newSystemdInput(name string, opt *sockOptions) (dnstap.Input, error) {
+	ls, err := systemdListeners(name)
+	if err != nil {
+		return nil, err
+	}
+	var mi multiInput
+	for _, l := range ls {
+		fmt.Fprintf(os.Stderr, "dnstap: opened systemd socket %s\n", l.Addr())
+		mi = append(mi, newListenerInput(l, opt))
+	}
+	return mi, nil
+}
+
+// A multiInput reads the data of several inputs into one channel.
+type multiInput []dnstap.Input
+
+func (mi multiInput) ReadInto(output chan []byte) {
+	for _, i := range mi {
+		go i.ReadInto(output)
+	}
+}
+
+func (mi multiInput) Wait() {
+	for _, i := range mi {
+		i.Wait()
+	}
+}
+
+// The systemd watchdog, which is sent keep-alive pings only while the
+// loops passing frames from the inputs towards the outputs answer its
+// probes. The loops wait for either, so an idle collector answers, while
+// one whose outputs have stopped taking data does not, and is restarted.
+var watchdog struct {
+	interval time.Duration
+	mu       sync.Mutex
+	probes   map[chan struct{}]chan struct{} // probe to done
+}
+
+// startWatchdog sends keep-alive pings to systemd at half the watchdog
+// interval, if the watchdog is enabled for the process and the frame
+// loops answer within that time.
+func startWatchdog() {
+	interval := dnstap.SystemdWatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	watchdog.interval = interval
+	watchdog.probes = make(map[chan struct{}]chan struct{})
+	go func() {
+		for range time.Tick(interval / 2) {
+			if !watchdogAlive(interval / 2) {
+				logger.Printf("dnstap: systemd watchdog: outputs not taking data; skipping keep-alive ping")
+				continue
+			}
+			if err := dnstap.SystemdNotify("WATCHDOG=1"); err != nil {
+				logger.Printf("dnstap: systemd watchdog: %v", err)
+			}
+		}
+	}()
+}
+
+// watchdogAlive returns whether every frame loop answers a probe within
+// timeout.
+func watchdogAlive(timeout time.Duration) bool {
+	watchdog.mu.Lock()
+	probes := make(map[chan struct{}]chan struct{}, len(watchdog.probes))
+	for probe, done := range watchdog.probes {
+		probes[probe] = done
+	}
+	watchdog.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for probe, done := range probes {
+		select {
+		case probe <- struct{}{}:
+		case <-done:
+		case <-timer.C:
+			return false
+		}
+	}
+	return true
+}
+
+// watchdogChannel returns the channel into which an input should read the
+// frames for out, and a function to call once the input has finished.
+// With the watchdog enabled, the frames are passed to out by a loop which
+// answers its probes, and the function closes the channel and waits for
+// the loop to pass the remaining frames.
+func watchdogChannel(out chan []byte) (chan []byte, func()) {
+	if watchdog.interval == 0 {
+		return out, func() {}
+	}
+	in := make(chan []byte)
+	probe := make(chan struct{})
+	done := make(chan struct{})
+	watchdog.mu.Lock()
+	watchdog.probes[probe] = done
+	watchdog.mu.Unlock()
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case b, ok := <-in:
+				if !ok {
+					watchdog.mu.Lock()
+					delete(watchdog.probes, probe)
+					watchdog.mu.Unlock()
+					return
+				}
+				out <- b
+			case <-probe:
+			}
+		}
+	}()
+	return in, func() {
+		close(in)
+		<-done
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchdogAlive(t *testing.T) {
+	defer func(interval time.Duration) { watchdog.interval = interval }(watchdog.interval)
+	watchdog.interval = time.Second
+	watchdog.probes = make(map[chan struct{}]chan struct{})
+
+	out := make(chan []byte)
+	data, finish := watchdogChannel(out)
+	if !watchdogAlive(time.Second) {
+		t.Fatal("idle loop not alive")
+	}
+
+	// The loop is blocked while out is not taking data.
+	data <- []byte{1}
+	if watchdogAlive(50 * time.Millisecond) {
+		t.Error("loop blocked on its output alive")
+	}
+	<-out
+	if !watchdogAlive(time.Second) {
+		t.Error("loop not alive after its output took data")
+	}
+
+	go func() {
+		data <- []byte{2}
+		finish()
+	}()
+	if b := <-out; len(b) != 1 || b[0] != 2 {
+		t.Errorf("received %v, want [2]", b)
+	}
+	// A finished loop no longer needs to answer.
+	for i := 0; i < 100; i++ {
+		watchdog.mu.Lock()
+		n := len(watchdog.probes)
+		watchdog.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !watchdogAlive(50 * time.Millisecond) {
+		t.Error("not alive after the loop finished")
+	}
+}
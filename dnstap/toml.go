@@ -0,0 +1,391 @@
+/*
+ * Copyright (c) 2026 by Farsight Security, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The configuration file is written in a format of its own, a subset of
+// TOML needed to describe lists of named objects: arrays of tables
+// ([[name]]) containing key/value pairs whose values are strings,
+// integers, floats, booleans, or arrays of these. Dotted and quoted keys,
+// plain and inline tables, multi-line strings, dates, and the inf and nan
+// floats are not supported, so not every TOML file can be read, but every
+// file read is valid TOML with the same meaning.
+
+// A tomlTable is one [[name]] table of a configuration file.
+type tomlTable struct {
+	name   string
+	line   int
+	values map[string]*tomlValue
+	keys   []string
+}
+
+// A tomlValue is a value of a tomlTable. The value v is a string, an
+// int64, a float64, a bool, or a []*tomlValue.
+type tomlValue struct {
+	line int
+	v    interface{}
+}
+
+type tomlParser struct {
+	s    string
+	line int
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// parseTOML parses the configuration file data into its tables, in order.
+func parseTOML(data string) ([]*tomlTable, error) {
+	p := &tomlParser{s: data, line: 1}
+	var tables []*tomlTable
+	for {
+		p.skipSpace(true)
+		if p.s == "" {
+			return tables, nil
+		}
+		if strings.HasPrefix(p.s, "[[") {
+			t, err := p.parseHeader()
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, t)
+			continue
+		}
+		if p.s[0] == '[' {
+			return nil, p.errorf("only arrays of tables ([[name]]) are supported")
+		}
+		if len(tables) == 0 {
+			return nil, p.errorf("key outside of a [[table]]")
+		}
+		if err := p.parseKeyValue(tables[len(tables)-1]); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// skipSpace skips whitespace and comments, and newlines if newlines is
+// true.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for p.s != "" {
+		switch p.s[0] {
+		case ' ', '\t', '\r':
+			p.s = p.s[1:]
+		case '\n':
+			if !newlines {
+				return
+			}
+			p.line++
+			p.s = p.s[1:]
+		case '#':
+			i := strings.IndexByte(p.s, '\n')
+			if i < 0 {
+				i = len(p.s)
+			}
+			p.s = p.s[i:]
+		default:
+			return
+		}
+	}
+}
+
+// endLine consumes the remainder of a line, which must be empty.
+func (p *tomlParser) endLine() error {
+	p.skipSpace(false)
+	if p.s == "" {
+		return nil
+	}
+	if p.s[0] != '\n' {
+		return p.errorf("unexpected %q at end of line", p.s[0])
+	}
+	p.line++
+	p.s = p.s[1:]
+	return nil
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+func (p *tomlParser) parseKey() (string, error) {
+	i := 0
+	for i < len(p.s) && isBareKeyChar(p.s[i]) {
+		i++
+	}
+	if i == 0 {
+		return "", p.errorf("expected a key")
+	}
+	key := p.s[:i]
+	p.s = p.s[i:]
+	return key, nil
+}
+
+func (p *tomlParser) parseHeader() (*tomlTable, error) {
+	t := &tomlTable{line: p.line, values: make(map[string]*tomlValue)}
+	p.s = p.s[2:]
+	p.skipSpace(false)
+	name, err := p.parseKey()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace(false)
+	if !strings.HasPrefix(p.s, "]]") {
+		return nil, p.errorf("expected ]] after table name %q", name)
+	}
+	p.s = p.s[2:]
+	t.name = name
+	return t, p.endLine()
+}
+
+func (p *tomlParser) parseKeyValue(t *tomlTable) error {
+	key, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipSpace(false)
+	if p.s == "" || p.s[0] != '=' {
+		return p.errorf("expected = after key %q", key)
+	}
+	p.s = p.s[1:]
+	p.skipSpace(false)
+	if _, ok := t.values[key]; ok {
+		return p.errorf("duplicate key %q", key)
+	}
+	v, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	t.values[key] = v
+	t.keys = append(t.keys, key)
+	return p.endLine()
+}
+
+func (p *tomlParser) parseValue() (*tomlValue, error) {
+	v := &tomlValue{line: p.line}
+	if p.s == "" {
+		return nil, p.errorf("missing value")
+	}
+	switch c := p.s[0]; {
+	case c == '"':
+		s, err := p.parseBasicString()
+		if err != nil {
+			return nil, err
+		}
+		v.v = s
+	case c == '\'':
+		i := strings.IndexAny(p.s[1:], "'\n")
+		if i < 0 || p.s[1+i] != '\'' {
+			return nil, p.errorf("unterminated string")
+		}
+		v.v = p.s[1 : 1+i]
+		p.s = p.s[2+i:]
+	case c == '[':
+		a, err := p.parseArray()
+		if err != nil {
+			return nil, err
+		}
+		v.v = a
+	case strings.HasPrefix(p.s, "true") && !p.bareContinues(4):
+		v.v = true
+		p.s = p.s[4:]
+	case strings.HasPrefix(p.s, "false") && !p.bareContinues(5):
+		v.v = false
+		p.s = p.s[5:]
+	case c == '+' || c == '-' || c >= '0' && c <= '9':
+		i := 1
+		for i < len(p.s) && (isBareKeyChar(p.s[i]) || p.s[i] == '.' ||
+			p.s[i] == '+' && (p.s[i-1] == 'e' || p.s[i-1] == 'E')) {
+			i++
+		}
+		if strings.ContainsAny(p.s[:i], ".eE") {
+			f, err := parseFloat(p.s[:i])
+			if err != nil {
+				return nil, p.errorf("invalid float %q", p.s[:i])
+			}
+			v.v = f
+		} else {
+			n, err := parseInt(p.s[:i])
+			if err != nil {
+				return nil, p.errorf("invalid integer %q", p.s[:i])
+			}
+			v.v = n
+		}
+		p.s = p.s[i:]
+	default:
+		return nil, p.errorf("invalid value")
+	}
+	return v, nil
+}
+
+// parseInt parses a decimal integer, in which single underscores may
+// separate digits. Leading zeros are not allowed.
+func parseInt(s string) (int64, error) {
+	digits := s
+	if s[0] == '+' || s[0] == '-' {
+		digits = s[1:]
+	}
+	isDigit := func(i int) bool {
+		return i >= 0 && i < len(digits) && digits[i] >= '0' && digits[i] <= '9'
+	}
+	for i := range digits {
+		if digits[i] == '_' && (!isDigit(i-1) || !isDigit(i+1)) {
+			return 0, strconv.ErrSyntax
+		}
+	}
+	if len(digits) > 1 && digits[0] == '0' {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.ParseInt(strings.Replace(s, "_", "", -1), 10, 64)
+}
+
+// parseFloat parses a decimal float: an integer part as for parseInt,
+// followed by a fraction, an exponent, or both. Digits in the fraction and
+// exponent may be separated by single underscores.
+func parseFloat(s string) (float64, error) {
+	mantissa, exp := s, ""
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mantissa, exp = s[:i], s[i+1:]
+		if exp == "" {
+			return 0, strconv.ErrSyntax
+		}
+		if exp[0] == '+' || exp[0] == '-' {
+			exp = exp[1:]
+		}
+		if !isDigits(exp) {
+			return 0, strconv.ErrSyntax
+		}
+	}
+	whole := mantissa
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		whole = mantissa[:i]
+		if !isDigits(mantissa[i+1:]) {
+			return 0, strconv.ErrSyntax
+		}
+	}
+	if whole == "" || whole == "+" || whole == "-" {
+		return 0, strconv.ErrSyntax
+	}
+	if _, err := parseInt(whole); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.Replace(s, "_", "", -1), 64)
+}
+
+// isDigits reports whether s is a non-empty string of decimal digits,
+// which single underscores may separate.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+		case s[i] == '_' && i > 0 && i < len(s)-1 && s[i-1] != '_':
+		default:
+			return false
+		}
+	}
+	return s[len(s)-1] != '_'
+}
+
+// bareContinues reports whether the text at offset n continues a bare
+// word, as in "trueish".
+func (p *tomlParser) bareContinues(n int) bool {
+	return len(p.s) > n && isBareKeyChar(p.s[n])
+}
+
+func (p *tomlParser) parseBasicString() (string, error) {
+	var b strings.Builder
+	s := p.s[1:]
+	for {
+		if s == "" || s[0] == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := s[0]
+		if c == '"' {
+			p.s = s[1:]
+			return b.String(), nil
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			s = s[1:]
+			continue
+		}
+		if len(s) < 2 {
+			return "", p.errorf("unterminated string")
+		}
+		switch s[1] {
+		case '"', '\\':
+			b.WriteByte(s[1])
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'u':
+			if len(s) < 6 {
+				return "", p.errorf("invalid escape in string")
+			}
+			r, err := strconv.ParseUint(s[2:6], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return "", p.errorf("invalid escape in string")
+			}
+			b.WriteRune(rune(r))
+			s = s[4:]
+		default:
+			return "", p.errorf("invalid escape \\%c in string", s[1])
+		}
+		s = s[2:]
+	}
+}
+
+func (p *tomlParser) parseArray() ([]*tomlValue, error) {
+	var a []*tomlValue
+	p.s = p.s[1:]
+	for {
+		p.skipSpace(true)
+		if p.s == "" {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.s[0] == ']' {
+			p.s = p.s[1:]
+			return a, nil
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+		p.skipSpace(true)
+		if p.s == "" {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.s[0] == ',' {
+			p.s = p.s[1:]
+		} else if p.s[0] != ']' {
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// tomlString renders parsed tables for comparison, with each value
+// followed by the line it was read from.
+func tomlString(tables []*tomlTable) string {
+	var b strings.Builder
+	for _, t := range tables {
+		fmt.Fprintf(&b, "[[%s]]@%d", t.name, t.line)
+		for _, k := range t.keys {
+			fmt.Fprintf(&b, " %s=%s", k, tomlValueString(t.values[k]))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func tomlValueString(v *tomlValue) string {
+	a, ok := v.v.([]*tomlValue)
+	if !ok {
+		return fmt.Sprintf("%#v@%d", v.v, v.line)
+	}
+	s := make([]string, len(a))
+	for i, e := range a {
+		s[i] = tomlValueString(e)
+	}
+	return fmt.Sprintf("[%s]@%d", strings.Join(s, ","), v.line)
+}
+
+func TestParseTOML(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{"", ""},
+		{"# comment only\n\n", ""},
+		{"[[input]]", "[[input]]@1\n"},
+		{"\n  [[ input ]]  # comment\nname = \"a\"\n[[output]]\n",
+			"[[input]]@2 name=\"a\"@3\n[[output]]@4\n"},
+		{"[[t]]\r\nk = 'x'\r\n", "[[t]]@1 k=\"x\"@2\n"},
+		{"[[t]]\na=\"q\\\"b\\\\s\\n\\t\\r\"\nb='c:\\path'\nc=\"\\u00e9\\u2603\"\nd=\"é#\"",
+			"[[t]]@1 a=\"q\\\"b\\\\s\\n\\t\\r\"@2 b=\"c:\\\\path\"@3 c=\"é☃\"@4 d=\"é#\"@5\n"},
+		{"[[t]]\na=1\nb=-2\nc=+3\nd=1_000_000\ne=0\nf=9223372036854775807\ng=-0",
+			"[[t]]@1 a=1@2 b=-2@3 c=3@4 d=1000000@5 e=0@6 f=9223372036854775807@7 g=0@8\n"},
+		{"[[t]]\na=true\nb=false # comment", "[[t]]@1 a=true@2 b=false@3\n"},
+		{"[[t]]\na=0.5\nb=-1.25e2\nc=1e+3\nd=1_0.0_1\ne=2E-1\nf=[1.5]",
+			"[[t]]@1 a=0.5@2 b=-125@3 c=1000@4 d=10.01@5 e=0.2@6 f=[1.5@7]@7\n"},
+		{"[[t]]\na=[]\nb=[ 1, \"x\" , true ]\nc=[\n  \"x\", # comment\n  [2],\n]\n",
+			"[[t]]@1 a=[]@2 b=[1@3,\"x\"@3,true@3]@3 c=[\"x\"@5,[2@6]@6]@4\n"},
+		{"[[t]]\nbare-key_1 = 1\n[[t]]\nbare-key_1 = 2\n",
+			"[[t]]@1 bare-key_1=1@2\n[[t]]@3 bare-key_1=2@4\n"},
+	} {
+		tables, err := parseTOML(tc.in)
+		if err != nil {
+			t.Errorf("parseTOML(%q): %v", tc.in, err)
+			continue
+		}
+		if s := tomlString(tables); s != tc.out {
+			t.Errorf("parseTOML(%q):\n%s\nexpected:\n%s", tc.in, s, tc.out)
+		}
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	for _, tc := range []struct {
+		in, err string
+	}{
+		{"[table]", "line 1: only arrays of tables ([[name]]) are supported"},
+		{"k = 1", "line 1: key outside of a [[table]]"},
+		{"[[]]", "line 1: expected a key"},
+		{"[[a.b]]", "line 1: expected ]] after table name \"a\""},
+		{"[[a]", "line 1: expected ]] after table name \"a\""},
+		{"[[a]] x", "line 1: unexpected 'x' at end of line"},
+		{"[[a]]\n\"k\" = 1", "line 2: expected a key"},
+		{"[[a]]\na.b = 1", "line 2: expected = after key \"a\""},
+		{"[[a]]\nk", "line 2: expected = after key \"k\""},
+		{"[[a]]\nk =", "line 2: missing value"},
+		{"[[a]]\nk = 1 2", "line 2: unexpected '2' at end of line"},
+		{"[[a]]\nk = 1\nk = 2", "line 3: duplicate key \"k\""},
+		{"[[a]]\nk = x", "line 2: invalid value"},
+		{"[[a]]\nk = {a = 1}", "line 2: invalid value"},
+		{"[[a]]\nk = trueish", "line 2: invalid value"},
+		{"[[a]]\nk = 1.", "line 2: invalid float \"1.\""},
+		{"[[a]]\nk = .5", "line 2: invalid value"},
+		{"[[a]]\nk = 1.e5", "line 2: invalid float \"1.e5\""},
+		{"[[a]]\nk = 1e", "line 2: invalid float \"1e\""},
+		{"[[a]]\nk = 01.5", "line 2: invalid float \"01.5\""},
+		{"[[a]]\nk = 1._5", "line 2: invalid float \"1._5\""},
+		{"[[a]]\nk = 1.5_", "line 2: invalid float \"1.5_\""},
+		{"[[a]]\nk = -.5", "line 2: invalid float \"-.5\""},
+		{"[[a]]\nk = 1.2.3", "line 2: invalid float \"1.2.3\""},
+		{"[[a]]\nk = inf", "line 2: invalid value"},
+		{"[[a]]\nk = 12abc", "line 2: invalid integer \"12abc\""},
+		{"[[a]]\nk = 9223372036854775808", "line 2: invalid integer \"9223372036854775808\""},
+		{"[[a]]\nk = 1__0", "line 2: invalid integer \"1__0\""},
+		{"[[a]]\nk = 10_", "line 2: invalid integer \"10_\""},
+		{"[[a]]\nk = +_1", "line 2: invalid integer \"+_1\""},
+		{"[[a]]\nk = -", "line 2: invalid integer \"-\""},
+		{"[[a]]\nk = 012", "line 2: invalid integer \"012\""},
+		{"[[a]]\nk = \"abc", "line 2: unterminated string"},
+		{"[[a]]\nk = \"abc\nd\"", "line 2: unterminated string"},
+		{"[[a]]\nk = \"abc\\", "line 2: unterminated string"},
+		{"[[a]]\nk = 'abc", "line 2: unterminated string"},
+		{"[[a]]\nk = 'abc\n'", "line 2: unterminated string"},
+		{"[[a]]\nk = \"\\x41\"", "line 2: invalid escape \\x in string"},
+		{"[[a]]\nk = \"\\u12\"", "line 2: invalid escape in string"},
+		{"[[a]]\nk = \"\\u12g4\"", "line 2: invalid escape in string"},
+		{"[[a]]\nk = \"\\ud800\"", "line 2: invalid escape in string"},
+		{"[[a]]\nk = [1, 2", "line 2: unterminated array"},
+		{"[[a]]\nk = [1 2]", "line 2: expected , or ] in array"},
+		{"[[a]]\nk = [\n1,\n,]", "line 4: invalid value"},
+		{"[[a]]\nk = [\"x\n\"]", "line 2: unterminated string"},
+	} {
+		_, err := parseTOML(tc.in)
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("parseTOML(%q): error %v, expected %q", tc.in, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package dnstap
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// followStream returns a Frame Streams stream of the given frames, without
+// its stop frame unless stop is true.
+func followStream(t *testing.T, stop bool, frames ...string) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range frames {
+		if _, err := w.WriteFrame([]byte(f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	if stop {
+		return buf.Bytes()
+	}
+	// The stop frame is an escape, length, and control type.
+	return buf.Bytes()[:buf.Len()-12]
+}
+
+func expectFrames(t *testing.T, ch chan []byte, frames ...string) {
+	t.Helper()
+	for _, f := range frames {
+		select {
+		case b := <-ch:
+			if string(b) != f {
+				t.Fatalf("read frame %q, expected %q", b, f)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for frame %q", f)
+		}
+	}
+	select {
+	case b := <-ch:
+		t.Fatalf("read unexpected frame %q", b)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFollowInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "dnstap.fstrm")
+
+	appendFile := func(data []byte) {
+		f, err := os.OpenFile(fname, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	in := NewFollowInput(fname)
+	in.SetInterval(5 * time.Millisecond)
+	ch := make(chan []byte, 16)
+	go in.ReadInto(ch)
+
+	// The file is created after following starts, and written in
+	// pieces, splitting a frame.
+	stream := followStream(t, false, "a", "b", "c")
+	appendFile(stream[:len(stream)-3])
+	expectFrames(t, ch, "a", "b")
+	appendFile(stream[len(stream)-3:])
+	expectFrames(t, ch, "c")
+
+	// A stop frame followed by a new stream.
+	appendFile(followStream(t, true)[len(followStream(t, false)):])
+	appendFile(followStream(t, true, "d"))
+	expectFrames(t, ch, "d")
+
+	// Rotation, with a final frame written to the old file.
+	if err := os.Rename(fname, fname+".1"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(fname+".1", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(followStream(t, true, "e"))
+	f.Close()
+	appendFile(followStream(t, false, "f", "g"))
+	expectFrames(t, ch, "e", "f", "g")
+
+	// Truncation and a new stream.
+	if err := os.Truncate(fname, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	appendFile(followStream(t, false, "h"))
+	expectFrames(t, ch, "h")
+
+	// The file rewritten in place, never shorter than the data read.
+	f, err = os.OpenFile(fname, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(followStream(t, false, "i", "j", "k"))
+	f.Close()
+	expectFrames(t, ch, "i", "j", "k")
+
+	in.Stop()
+	done := make(chan struct{})
+	go func() {
+		in.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("FollowInput did not stop")
+	}
+}
+
+func TestFollowInputUndecodable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "dnstap.fstrm")
+
+	if err := ioutil.WriteFile(fname, []byte("not a frame stream"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	in := NewFollowInput(fname)
+	in.SetInterval(5 * time.Millisecond)
+	ch := make(chan []byte, 16)
+	go in.ReadInto(ch)
+	time.Sleep(50 * time.Millisecond)
+
+	var frames []string
+	for i := 0; i < 3; i++ {
+		frames = append(frames, fmt.Sprint(i))
+	}
+	if err := ioutil.WriteFile(fname+".new", followStream(t, false, frames...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(fname+".new", fname); err != nil {
+		t.Fatal(err)
+	}
+	expectFrames(t, ch, frames...)
+	in.Stop()
+	in.Wait()
+}
@@ -0,0 +1,545 @@
+package dnstap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// testMessages returns n generated messages of all types, with some
+// fields unset or unusual.
+func testMessages(t testing.TB, n int) []*Dnstap {
+	mix := make(map[Message_Type]float64)
+	for mt := range Message_Type_name {
+		mix[Message_Type(mt)] = 1
+	}
+	g, err := NewGeneratorInput(&GeneratorOptions{
+		Count:           uint64(n),
+		Mix:             mix,
+		MaxResponseSize: 512,
+		Identity:        []byte("test<&>\xff "),
+		Seed:            1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan []byte, n)
+	g.ReadInto(ch)
+	close(ch)
+
+	var msgs []*Dnstap
+	for b := range ch {
+		dt := &Dnstap{}
+		if err := proto.Unmarshal(b, dt); err != nil {
+			t.Fatal(err)
+		}
+		switch len(msgs) % 5 {
+		case 1:
+			dt.Message.SocketFamily = nil
+			dt.Message.QueryPort = nil
+		case 2:
+			dt.Message.QueryZone = []byte("\x07example\x00")
+		case 3:
+			dt.Message.ResponseMessage = []byte("malformed")
+		case 4:
+			dt.Message = nil
+		}
+		msgs = append(msgs, dt)
+	}
+	return msgs
+}
+
+// referenceJSON renders dt in JSON with encoding/json, as described in
+// JsonFormat.go.
+func referenceJSON(dt *Dnstap) ([]byte, bool) {
+	type jsonMessage struct {
+		Type            string     `json:"type"`
+		QueryTime       *time.Time `json:"query_time,omitempty"`
+		ResponseTime    *time.Time `json:"response_time,omitempty"`
+		SocketFamily    string     `json:"socket_family,omitempty"`
+		SocketProtocol  string     `json:"socket_protocol,omitempty"`
+		QueryAddress    *net.IP    `json:"query_address,omitempty"`
+		ResponseAddress *net.IP    `json:"response_address,omitempty"`
+		QueryPort       uint32     `json:"query_port,omitempty"`
+		ResponsePort    uint32     `json:"response_port,omitempty"`
+		QueryZone       string     `json:"query_zone,omitempty"`
+		QueryMessage    string     `json:"query_message,omitempty"`
+		ResponseMessage string     `json:"response_message,omitempty"`
+	}
+	type jsonDnstap struct {
+		Type     string      `json:"type"`
+		Identity string      `json:"identity,omitempty"`
+		Version  string      `json:"version,omitempty"`
+		Message  jsonMessage `json:"message"`
+	}
+
+	j := jsonDnstap{
+		Type:     fmt.Sprint(dt.Type),
+		Identity: string(dt.Identity),
+		Version:  string(dt.Version),
+	}
+	if m := dt.Message; m != nil {
+		j.Message = jsonMessage{
+			Type:           fmt.Sprint(m.Type),
+			SocketFamily:   fmt.Sprint(m.SocketFamily),
+			SocketProtocol: fmt.Sprint(m.SocketProtocol),
+			QueryPort:      m.GetQueryPort(),
+			ResponsePort:   m.GetResponsePort(),
+		}
+		if m.QueryTimeSec != nil {
+			t := time.Unix(int64(*m.QueryTimeSec), int64(*m.QueryTimeNsec)).UTC()
+			j.Message.QueryTime = &t
+		}
+		if m.ResponseTimeSec != nil {
+			t := time.Unix(int64(*m.ResponseTimeSec), int64(*m.ResponseTimeNsec)).UTC()
+			j.Message.ResponseTime = &t
+		}
+		if m.QueryAddress != nil {
+			ip := net.IP(m.QueryAddress)
+			j.Message.QueryAddress = &ip
+		}
+		if m.ResponseAddress != nil {
+			ip := net.IP(m.ResponseAddress)
+			j.Message.ResponseAddress = &ip
+		}
+		if m.QueryZone != nil {
+			name, _, err := dns.UnpackDomainName(m.QueryZone, 0)
+			if err != nil {
+				name = fmt.Sprintf("parse failed: %v", err)
+			}
+			j.Message.QueryZone = name
+		}
+		j.Message.QueryMessage = referenceDNS(m.QueryMessage)
+		j.Message.ResponseMessage = referenceDNS(m.ResponseMessage)
+	}
+	b, err := json.Marshal(j)
+	return append(b, '\n'), err == nil
+}
+
+func referenceDNS(wire []byte) string {
+	if wire == nil {
+		return ""
+	}
+	msg := new(dns.Msg)
+	if err := msg.Unpack(wire); err != nil {
+		return fmt.Sprintf("parse failed: %v", err)
+	}
+	return msg.String()
+}
+
+func TestAppendFormats(t *testing.T) {
+	prefix := []byte("prefix ")
+	for _, dt := range testMessages(t, 200) {
+		for _, f := range []struct {
+			name   string
+			format TextFormatFunc
+			append AppendFormatFunc
+		}{
+			{"text", TextFormat, AppendTextFormat},
+			{"yaml", YamlFormat, AppendYamlFormat},
+			{"json", JSONFormat, AppendJSONFormat},
+		} {
+			out, ok := f.format(dt)
+			aout, aok := f.append(append([]byte(nil), prefix...), dt)
+			if ok != aok || ok && !bytes.Equal(aout, append(append([]byte(nil), prefix...), out...)) {
+				t.Errorf("%s: append format %q differs from %q", f.name, aout, out)
+			}
+		}
+
+		want, _ := referenceJSON(dt)
+		if got, _ := JSONFormat(dt); !bytes.Equal(got, want) {
+			t.Errorf("JSONFormat:\n got %s\nwant %s", got, want)
+		}
+	}
+}
+
+// TestFormatGolden checks the text formats of the messages in
+// testdata/format.fstrm against the output of the formatters as they were
+// before being rewritten to append to a buffer, in testdata/format.text,
+// format.yaml, and format.json. The golden files are not regenerated from
+// the current formatters. The last message, a response whose answer is
+// truncated, is shown in the quiet text format as "X", as the message
+// cannot be parsed.
+func TestFormatGolden(t *testing.T) {
+	// The quiet text format shows times in the local time zone.
+	defer func(loc *time.Location) { time.Local = loc }(time.Local)
+	time.Local = time.UTC
+
+	f, err := os.Open("testdata/format.fstrm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := NewReader(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []*Dnstap
+	buf := make([]byte, MaxPayloadSize)
+	for {
+		n, err := r.ReadFrame(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		dt := &Dnstap{}
+		if err := proto.Unmarshal(buf[:n], dt); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, dt)
+	}
+
+	for _, f := range []struct {
+		name   string
+		format TextFormatFunc
+	}{
+		{"text", TextFormat},
+		{"yaml", YamlFormat},
+		{"json", JSONFormat},
+	} {
+		want, err := ioutil.ReadFile("testdata/format." + f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []byte
+		for _, dt := range msgs {
+			out, _ := f.format(dt)
+			got = append(got, out...)
+		}
+		if bytes.Equal(got, want) {
+			continue
+		}
+		gotLines := strings.SplitAfter(string(got), "\n")
+		wantLines := strings.SplitAfter(string(want), "\n")
+		for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+			var g, w string
+			if i < len(gotLines) {
+				g = gotLines[i]
+			}
+			if i < len(wantLines) {
+				w = wantLines[i]
+			}
+			if g != w {
+				t.Errorf("%s: line %d:\n got %q\nwant %q", f.name, i+1, g, w)
+				break
+			}
+		}
+	}
+}
+
+func TestJSONFormatEscaping(t *testing.T) {
+	dt := &Dnstap{
+		Type:     Dnstap_MESSAGE.Enum(),
+		Identity: []byte("a\"b\\c<d>&e\x01\b\f\n\r\t\xff  é"),
+		Message: &Message{
+			Type:         Message_CLIENT_QUERY.Enum(),
+			QueryAddress: net.ParseIP("2001:db8::1"),
+		},
+	}
+	want, _ := referenceJSON(dt)
+	if got, _ := JSONFormat(dt); !bytes.Equal(got, want) {
+		t.Errorf("JSONFormat:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestParseJSONFormat(t *testing.T) {
+	// The generated messages have no EDNS or unusual header fields.
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeAAAA)
+	m.Response, m.Zero, m.CheckingDisabled = true, true, true
+	m.Rcode = dns.RcodeBadVers
+	m.SetEdns0(1232, true)
+	wire, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	edns := &Dnstap{
+		Type: Dnstap_MESSAGE.Enum(),
+		Message: &Message{
+			Type:            Message_AUTH_RESPONSE.Enum(),
+			ResponseAddress: []byte{},
+			ResponseMessage: wire,
+		},
+	}
+
+	n := 0
+	for _, dt := range append(testMessages(t, 200), edns) {
+		want, ok := JSONFormat(dt)
+		if !ok || bytes.Contains(want, []byte("parse failed")) {
+			continue
+		}
+		parsed, err := ParseJSONFormat(want)
+		if err != nil {
+			t.Errorf("ParseJSONFormat(%s): %v", want, err)
+			continue
+		}
+		if got, _ := JSONFormat(parsed); !bytes.Equal(got, want) {
+			t.Errorf("JSONFormat(ParseJSONFormat()):\n got %s\nwant %s", got, want)
+		}
+		n++
+	}
+	if n < 100 {
+		t.Errorf("only %d messages parsed", n)
+	}
+
+	for _, s := range []string{
+		`{"type":"MESSAGE","message":{"type":"NO_SUCH_TYPE"}}`,
+		`{"type":"MESSAGE","message":{"type":"CLIENT_QUERY","query_address":"192.0.2"}}`,
+		`{"type":"MESSAGE","message":{"type":"CLIENT_QUERY","query_message":";; opcode: QUERY"}}`,
+		`not json`,
+	} {
+		if _, err := ParseJSONFormat([]byte(s)); err == nil {
+			t.Errorf("ParseJSONFormat(%s) succeeded", s)
+		}
+	}
+}
+
+func TestFramePool(t *testing.T) {
+	p := NewFramePool(2)
+	b := p.Get(100)
+	if len(b) != 100 || cap(b) != frameBufferUnit {
+		t.Fatalf("Get(100): len %d cap %d", len(b), cap(b))
+	}
+	p.Put(b)
+	if c := p.Get(200); &c[0] != &b[0] {
+		t.Error("Get did not reuse released buffer")
+	}
+	if c := p.Get(200); &c[0] == &b[0] {
+		t.Error("Get reused buffer twice")
+	}
+
+	var nilPool *FramePool
+	nilPool.Put(nilPool.Get(10))
+}
+
+func BenchmarkTextFormat(b *testing.B) {
+	benchmarkFormat(b, TextFormat)
+}
+
+func BenchmarkAppendTextFormat(b *testing.B) {
+	benchmarkAppendFormat(b, AppendTextFormat)
+}
+
+func BenchmarkYamlFormat(b *testing.B) {
+	benchmarkFormat(b, YamlFormat)
+}
+
+func BenchmarkAppendYamlFormat(b *testing.B) {
+	benchmarkAppendFormat(b, AppendYamlFormat)
+}
+
+func BenchmarkJSONFormat(b *testing.B) {
+	benchmarkFormat(b, JSONFormat)
+}
+
+func BenchmarkAppendJSONFormat(b *testing.B) {
+	benchmarkAppendFormat(b, AppendJSONFormat)
+}
+
+// BenchmarkReferenceJSON measures the encoding/json rendering replaced
+// by AppendJSONFormat.
+func BenchmarkReferenceJSON(b *testing.B) {
+	benchmarkFormat(b, referenceJSON)
+}
+
+func benchmarkFormat(b *testing.B, format TextFormatFunc) {
+	msgs := testMessages(b, 100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		format(msgs[i%len(msgs)])
+	}
+}
+
+func benchmarkAppendFormat(b *testing.B, format AppendFormatFunc) {
+	msgs := testMessages(b, 100)
+	var buf []byte
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, _ = format(buf[:0], msgs[i%len(msgs)])
+	}
+}
+
+func BenchmarkFrameStreamInput(b *testing.B) {
+	benchmarkFrameStreamInput(b, nil)
+}
+
+func BenchmarkFrameStreamInputPooled(b *testing.B) {
+	benchmarkFrameStreamInput(b, NewFramePool(0))
+}
+
+// benchmarkFrameStreamInput measures reading and formatting a file of 800
+// frames.
+func benchmarkFrameStreamInput(b *testing.B, pool *FramePool) {
+	var data bytes.Buffer
+	w, err := NewWriter(&data, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	enc := NewEncoder(w)
+	for _, dt := range testMessages(b, 1000) {
+		if dt.Message == nil {
+			continue
+		}
+		if err := enc.Encode(dt); err != nil {
+			b.Fatal(err)
+		}
+	}
+	w.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, err := NewReader(bytes.NewReader(data.Bytes()), nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		input := NewFrameStreamInputFromReader(r)
+		input.SetFramePool(pool)
+		out := NewAppendTextOutput(ioutil.Discard, AppendTextFormat)
+		out.SetFramePool(pool)
+		go out.RunOutputLoop()
+		input.ReadInto(out.GetOutputChannel())
+		out.Close()
+	}
+}
+
+// runTextOutput writes frames through o and returns when all have been
+// written.
+func runTextOutput(o *TextOutput, frames [][]byte) {
+	go o.RunOutputLoop()
+	for _, f := range frames {
+		o.GetOutputChannel() <- f
+	}
+	o.Close()
+}
+
+func testFrames(t testing.TB, n int) [][]byte {
+	var frames [][]byte
+	for _, dt := range testMessages(t, n) {
+		b, err := proto.Marshal(dt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, b)
+	}
+	return frames
+}
+
+func TestTextOutputWorkers(t *testing.T) {
+	frames := testFrames(t, 2000)
+
+	var serial, parallel bytes.Buffer
+	runTextOutput(NewAppendTextOutput(&serial, AppendJSONFormat), frames)
+	o := NewAppendTextOutput(&parallel, AppendJSONFormat)
+	o.SetWorkers(4)
+	o.SetBufferSize(65536)
+	runTextOutput(o, frames)
+
+	if serial.Len() == 0 || !bytes.Equal(serial.Bytes(), parallel.Bytes()) {
+		t.Error("parallel output differs from serial output")
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestTextOutputWriteError(t *testing.T) {
+	frame, err := proto.Marshal(testClientQuery(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{1, 4} {
+		o := NewAppendTextOutput(failingWriter{}, AppendJSONFormat)
+		o.SetWorkers(workers)
+		// The first message is larger than the buffer, so it is written
+		// at once, and fails.
+		o.SetBufferSize(16)
+		for i := 0; i < cap(o.GetOutputChannel()); i++ {
+			o.GetOutputChannel() <- frame
+		}
+		done := make(chan struct{})
+		go func() {
+			o.RunOutputLoop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("workers=%d: output loop still running after write error", workers)
+		}
+		if len(o.GetOutputChannel()) == 0 {
+			t.Errorf("workers=%d: all frames received after write error", workers)
+		}
+		o.Close()
+	}
+}
+
+type syncBuffer struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *syncBuffer) Len() int {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Len()
+}
+
+func TestTextOutputFlushTimeout(t *testing.T) {
+	var buf syncBuffer
+	o := NewAppendTextOutput(&buf, AppendTextFormat)
+	o.SetFlushTimeout(10 * time.Millisecond)
+	go o.RunOutputLoop()
+	defer o.Close()
+
+	o.GetOutputChannel() <- testFrames(t, 1)[0]
+	for deadline := time.Now().Add(time.Second); buf.Len() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("output not flushed after flush timeout")
+		}
+	}
+}
+
+func BenchmarkTextOutput(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			frames := testFrames(b, 1000)
+			b.ReportAllocs()
+			b.ResetTimer()
+			o := NewAppendTextOutput(ioutil.Discard, AppendJSONFormat)
+			o.SetWorkers(workers)
+			o.SetBufferSize(65536)
+			go o.RunOutputLoop()
+			for i := 0; i < b.N; i++ {
+				o.GetOutputChannel() <- frames[i%len(frames)]
+			}
+			o.Close()
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package dnstap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGeneratorInput(t *testing.T) {
+	g, err := NewGeneratorInput(&GeneratorOptions{
+		Count: 500,
+		Mix: map[Message_Type]float64{
+			Message_CLIENT_QUERY:    1,
+			Message_CLIENT_RESPONSE: 3,
+		},
+		Names:           100,
+		MinResponseSize: 200,
+		MaxResponseSize: 400,
+		Identity:        []byte("generator"),
+		Seed:            1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan []byte, 500)
+	g.ReadInto(ch)
+	g.Wait()
+	close(ch)
+
+	counts := make(map[Message_Type]int)
+	for b := range ch {
+		dt := &Dnstap{}
+		if err := proto.Unmarshal(b, dt); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range Validate(dt) {
+			if p.Severity == ValidationError {
+				t.Errorf("generated message invalid: %v", p)
+			}
+		}
+		mt := dt.Message.GetType()
+		counts[mt]++
+		if mt == Message_CLIENT_RESPONSE {
+			if n := len(dt.Message.ResponseMessage); n < 200 {
+				t.Errorf("response size %d below minimum", n)
+			}
+			msg := new(dns.Msg)
+			if err := msg.Unpack(dt.Message.ResponseMessage); err != nil || len(msg.Answer) == 0 {
+				t.Errorf("response has no answers (%v)", err)
+			}
+		}
+	}
+
+	if s := g.Stats(); s.Messages != 500 {
+		t.Errorf("Stats: %d messages, want 500", s.Messages)
+	}
+	if counts[Message_CLIENT_QUERY]+counts[Message_CLIENT_RESPONSE] != 500 ||
+		counts[Message_CLIENT_RESPONSE] < 2*counts[Message_CLIENT_QUERY] {
+		t.Errorf("unexpected message type mix %v", counts)
+	}
+}
+
+func TestGeneratorInputRate(t *testing.T) {
+	g, err := NewGeneratorInput(&GeneratorOptions{Rate: 1000, Count: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var clock fakeClock
+	g.now = clock.now
+	g.newTimer = func(d time.Duration) *time.Timer {
+		clock.sleep(d)
+		return time.NewTimer(0)
+	}
+	ch := make(chan []byte, 50)
+	g.ReadInto(ch)
+	d := clock.waits()
+	if len(d) != 49 {
+		t.Fatalf("50 messages at 1000/s waited %d times, expected 49", len(d))
+	}
+	for _, w := range d {
+		if w != time.Millisecond {
+			t.Fatalf("50 messages at 1000/s waited %v, expected 1ms each", d)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package dnstap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHTTPInput(t *testing.T) {
+	in := NewHTTPInput(nil)
+	in.SetBearerToken("secret")
+	ch := make(chan []byte, 16)
+	go in.ReadInto(ch)
+	ts := httptest.NewServer(in)
+	defer ts.Close()
+
+	post := func(contentType, encoding, token string, body []byte) int {
+		t.Helper()
+		req, err := http.NewRequest("POST", ts.URL, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Content-Encoding", encoding)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	var batch []byte
+	for _, f := range []string{"b1", "b2"} {
+		batch = binary.BigEndian.AppendUint32(batch, uint32(len(f)))
+		batch = append(batch, f...)
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(batch)
+	zw.Close()
+
+	dt := &Dnstap{
+		Type:     Dnstap_MESSAGE.Enum(),
+		Identity: []byte("ns1"),
+		Message: &Message{
+			Type:         Message_CLIENT_QUERY.Enum(),
+			QueryAddress: net.ParseIP("192.0.2.1").To4(),
+		},
+	}
+	line, _ := JSONFormat(dt)
+	frame, err := proto.Marshal(dt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		contentType, encoding, token string
+		body                         []byte
+		status                       int
+		frames                       []string
+	}{
+		{HTTPContentTypeFrameStream, "", "secret", followStream(t, true, "f1", "f2"), http.StatusNoContent, []string{"f1", "f2"}},
+		{HTTPContentTypeBatch, "", "secret", batch, http.StatusNoContent, []string{"b1", "b2"}},
+		{HTTPContentTypeBatch, "gzip", "secret", gz.Bytes(), http.StatusNoContent, []string{"b1", "b2"}},
+		{HTTPContentTypeJSON, "", "secret", append(append(line, '\n'), line...), http.StatusNoContent,
+			[]string{string(frame), string(frame)}},
+		// Data before an error in the body is kept.
+		{HTTPContentTypeBatch, "", "secret", batch[:len(batch)-1], http.StatusBadRequest, []string{"b1"}},
+		{HTTPContentTypeBatch, "", "secret", []byte{0xff, 0xff, 0xff, 0xff}, http.StatusRequestEntityTooLarge, nil},
+		{HTTPContentTypeJSON, "", "secret", []byte("{}\n"), http.StatusBadRequest, nil},
+		{"text/plain", "", "secret", batch, http.StatusUnsupportedMediaType, nil},
+		{HTTPContentTypeBatch, "br", "secret", batch, http.StatusUnsupportedMediaType, nil},
+		{HTTPContentTypeBatch, "", "", batch, http.StatusUnauthorized, nil},
+		{HTTPContentTypeBatch, "", "wrong", batch, http.StatusUnauthorized, nil},
+	} {
+		if status := post(tc.contentType, tc.encoding, tc.token, tc.body); status != tc.status {
+			t.Errorf("%s %s: status %d, expected %d", tc.contentType, tc.encoding, status, tc.status)
+		}
+		expectFrames(t, ch, tc.frames...)
+	}
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, expected %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+
+	in.Stop()
+	in.Wait()
+}
+
+func TestHTTPInputListener(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := NewHTTPInput(l)
+	ch := make(chan []byte, 16)
+	go in.ReadInto(ch)
+
+	resp, err := http.Post("http://"+l.Addr().String(), HTTPContentTypeFrameStream,
+		bytes.NewReader(followStream(t, true, "f1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status %d, expected %d", resp.StatusCode, http.StatusNoContent)
+	}
+	expectFrames(t, ch, "f1")
+
+	in.Stop()
+	in.Wait()
+	if _, err := http.Post("http://"+l.Addr().String(), HTTPContentTypeJSON, strings.NewReader("")); err == nil {
+		t.Error("request succeeded after Stop")
+	}
+}
+
+func TestHTTPOutput(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   string
+	}
+	requests := make(chan request, 16)
+	statuses := make(chan int, 16)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body = zr
+		}
+		b, _ := ioutil.ReadAll(body)
+		requests <- request{r.Header, string(b)}
+		select {
+		case status := <-statuses:
+			w.WriteHeader(status)
+		default:
+			w.Write([]byte(`{"errors":false}`))
+		}
+	}))
+	defer ts.Close()
+
+	msgs := testMessages(t, 5)
+	var frames [][]byte
+	var lines []string
+	for _, dt := range msgs {
+		b, err := proto.Marshal(dt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, b)
+		line, _ := JSONFormat(dt)
+		lines = append(lines, string(line))
+	}
+	run := func(opt *HTTPOutputOptions, frames ...[]byte) {
+		t.Helper()
+		o, err := NewHTTPOutput(ts.URL, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go o.RunOutputLoop()
+		for _, f := range frames {
+			o.GetOutputChannel() <- f
+		}
+		o.Close()
+	}
+	expect := func(body string) http.Header {
+		t.Helper()
+		select {
+		case r := <-requests:
+			if r.body != body {
+				t.Errorf("posted\n%s\nexpected\n%s", r.body, body)
+			}
+			return r.header
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for request")
+		}
+		return nil
+	}
+
+	// Batches are posted when full, and on Close.
+	run(&HTTPOutputOptions{
+		BatchSize:   3,
+		Gzip:        true,
+		Header:      http.Header{"X-Test": {"1"}},
+		BearerToken: "secret",
+	}, frames...)
+	h := expect(strings.Join(lines[:3], ""))
+	if h.Get("Content-Type") != HTTPContentTypeJSON || h.Get("X-Test") != "1" ||
+		h.Get("Authorization") != "Bearer secret" {
+		t.Errorf("request headers %v", h)
+	}
+	expect(strings.Join(lines[3:], ""))
+
+	run(&HTTPOutputOptions{Format: HTTPOutputBulk, Index: "dnstap"}, frames[0])
+	expect(`{"index":{"_index":"dnstap"}}` + "\n" + lines[0])
+
+	// Server errors are retried; other errors are not.
+	statuses <- http.StatusServiceUnavailable
+	run(&HTTPOutputOptions{MaxRetries: 1, RetryInterval: time.Millisecond}, frames[0])
+	expect(lines[0])
+	expect(lines[0])
+	statuses <- http.StatusBadRequest
+	run(&HTTPOutputOptions{MaxRetries: 1, RetryInterval: time.Millisecond}, frames[0])
+	expect(lines[0])
+	select {
+	case <-requests:
+		t.Error("request failing with status 400 retried")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if _, err := NewHTTPOutput("ftp://localhost/", nil); err == nil {
+		t.Error("NewHTTPOutput accepted an ftp URL")
+	}
+}
+
+func TestHTTPOutputToInput(t *testing.T) {
+	in := NewHTTPInput(nil)
+	ch := make(chan []byte, 16)
+	go in.ReadInto(ch)
+	ts := httptest.NewServer(in)
+	defer ts.Close()
+
+	o, err := NewHTTPOutput(ts.URL, &HTTPOutputOptions{Format: HTTPOutputBatch, Gzip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go o.RunOutputLoop()
+	for _, f := range []string{"f1", "f2", "f3"} {
+		o.GetOutputChannel() <- []byte(f)
+	}
+	o.Close()
+	expectFrames(t, ch, "f1", "f2", "f3")
+	in.Stop()
+	in.Wait()
+}
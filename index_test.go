@@ -0,0 +1,179 @@
+package dnstap
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestIndex(t *testing.T) {
+	var data, idx bytes.Buffer
+	o, err := NewFrameStreamOutput(&data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.SetIndex(&idx, 10)
+	go o.RunOutputLoop()
+	for sec := uint64(100); sec < 200; sec++ {
+		dt := testClientQuery(t)
+		dt.Message.QueryTimeSec = proto.Uint64(sec)
+		b, err := proto.Marshal(dt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.GetOutputChannel() <- b
+	}
+	o.Close()
+
+	written, err := ReadIndex(&idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	built, err := BuildIndex(bytes.NewReader(data.Bytes()), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written.Entries) != 10 || len(built.Entries) != 10 {
+		t.Fatalf("index lengths %d, %d, want 10", len(written.Entries), len(built.Entries))
+	}
+	if written.Size != int64(data.Len()) || built.Size != int64(data.Len()) {
+		t.Errorf("index sizes %d, %d, want %d", written.Size, built.Size, data.Len())
+	}
+	for i := range built.Entries {
+		we, be := written.Entries[i], built.Entries[i]
+		if we.Frame != be.Frame || we.Offset != be.Offset || !we.Time.Equal(be.Time) {
+			t.Errorf("entry %d: written %v, built %v", i, we, be)
+		}
+	}
+
+	r, err := NewIndexedReader(bytes.NewReader(data.Bytes()), written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder(r, int(MaxPayloadSize))
+	check := func(what string, want uint64) {
+		dt := &Dnstap{}
+		if err := dec.Decode(dt); err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+		if got := dt.Message.GetQueryTimeSec(); got != want {
+			t.Errorf("%s: read time %d, want %d", what, got, want)
+		}
+	}
+
+	if err := r.SeekFrame(57); err != nil {
+		t.Fatal(err)
+	}
+	check("SeekFrame(57)", 157)
+	check("frame after SeekFrame(57)", 158)
+	if err := r.SeekTime(time.Unix(133, 0)); err != nil {
+		t.Fatal(err)
+	}
+	check("SeekTime(133)", 133)
+	if err := r.SeekTime(time.Unix(50, 0)); err != nil {
+		t.Fatal(err)
+	}
+	check("SeekTime(50)", 100)
+}
+
+func TestIndexSeekTimeUntimed(t *testing.T) {
+	var data bytes.Buffer
+	o, err := NewFrameStreamOutput(&data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go o.RunOutputLoop()
+	for sec := uint64(100); sec < 200; sec++ {
+		dt := testClientQuery(t)
+		dt.Message.QueryTimeSec = proto.Uint64(sec)
+		// Frames 30 to 59 have no time, nor have their index entries.
+		if sec >= 130 && sec < 160 {
+			dt.Message.QueryTimeSec = nil
+			dt.Message.QueryTimeNsec = nil
+		}
+		b, err := proto.Marshal(dt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.GetOutputChannel() <- b
+	}
+	o.Close()
+	ix, err := BuildIndex(bytes.NewReader(data.Bytes()), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ix.Entries[4].Time.IsZero() {
+		t.Fatalf("entry 4 has time %v", ix.Entries[4].Time)
+	}
+
+	r, err := NewIndexedReader(bytes.NewReader(data.Bytes()), ix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder(r, int(MaxPayloadSize))
+	for _, sec := range []uint64{105, 115, 125, 165, 185} {
+		if err := r.SeekTime(time.Unix(int64(sec), 0)); err != nil {
+			t.Fatal(err)
+		}
+		dt := &Dnstap{}
+		if err := dec.Decode(dt); err != nil {
+			t.Fatal(err)
+		}
+		if got := dt.Message.GetQueryTimeSec(); got != sec {
+			t.Errorf("SeekTime(%d): read time %d", sec, got)
+		}
+	}
+}
+
+func TestIndexMismatch(t *testing.T) {
+	var data bytes.Buffer
+	o, err := NewFrameStreamOutput(&data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go o.RunOutputLoop()
+	for i := 0; i < 10; i++ {
+		b, err := proto.Marshal(testClientQuery(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.GetOutputChannel() <- b
+	}
+	o.Close()
+	ix, err := BuildIndex(bytes.NewReader(data.Bytes()), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An index of a file which has since been rewritten is rejected.
+	short := data.Bytes()[:data.Len()-20]
+	if _, err := NewIndexedReader(bytes.NewReader(short), ix); err != ErrBadIndex {
+		t.Errorf("index of a longer file: error %v, want ErrBadIndex", err)
+	}
+
+	// An index without a size, as written by earlier versions, is
+	// accepted.
+	var idx bytes.Buffer
+	ix.WriteTo(&idx)
+	v1 := strings.Replace(idx.String(), "dnstap-index 2 3 "+strconv.FormatInt(ix.Size, 10), "dnstap-index 1 3", 1)
+	old, err := ReadIndex(strings.NewReader(v1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Size != 0 || len(old.Entries) != len(ix.Entries) {
+		t.Errorf("version 1 index read as %+v", old)
+	}
+	if _, err := NewIndexedReader(bytes.NewReader(data.Bytes()), old); err != nil {
+		t.Error(err)
+	}
+
+	for _, hdr := range []string{"", "dnstap-index 1 3 100", "dnstap-index 2 3", "dnstap-index 3 3 100", "dnstap-index 2 x 100"} {
+		if _, err := ReadIndex(strings.NewReader(hdr + "\n")); err != ErrBadIndex {
+			t.Errorf("ReadIndex(%q): error %v, want ErrBadIndex", hdr, err)
+		}
+	}
+}
@@ -0,0 +1,608 @@
+package dnstap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// A fakeKafka is an in-process Kafka cluster answering the Metadata and
+// Produce requests sent by KafkaOutput. Topics are created on demand, with
+// their partitions led alternately by each broker.
+type fakeKafka struct {
+	t          *testing.T
+	listeners  []net.Listener
+	partitions int
+
+	mu         sync.Mutex
+	records    map[kafkaPartition][]kafkaRecord
+	errs       []int16 // returned for the next produced partitions
+	topicErrs  map[string]int16
+	compressed int
+}
+
+func newFakeKafka(t *testing.T, brokers, partitions int) *fakeKafka {
+	k := &fakeKafka{
+		t:          t,
+		partitions: partitions,
+		records:    make(map[kafkaPartition][]kafkaRecord),
+		topicErrs:  make(map[string]int16),
+	}
+	for i := 0; i < brokers; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		k.listeners = append(k.listeners, l)
+		go k.serve(int32(i), l)
+	}
+	return k
+}
+
+func (k *fakeKafka) addr(id int) string {
+	return k.listeners[id].Addr().String()
+}
+
+func (k *fakeKafka) Close() {
+	for _, l := range k.listeners {
+		l.Close()
+	}
+}
+
+func (k *fakeKafka) serve(id int32, l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				var size [4]byte
+				if _, err := io.ReadFull(conn, size[:]); err != nil {
+					return
+				}
+				req := make([]byte, binary.BigEndian.Uint32(size[:]))
+				if _, err := io.ReadFull(conn, req); err != nil {
+					return
+				}
+				resp, err := k.handle(id, req)
+				if err != nil {
+					k.t.Error(err)
+					return
+				}
+				if resp == nil {
+					continue
+				}
+				if _, err := conn.Write(resp); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// handle returns the response to the request req received by the broker
+// id, or nil for a request with no response.
+func (k *fakeKafka) handle(id int32, req []byte) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	d := &kafkaDecoder{b: req}
+	key := d.int16()
+	version := d.int16()
+	correlation := d.int32()
+	d.string() // client ID
+	e := &kafkaEncoder{b: make([]byte, 4)}
+	e.int32(correlation)
+
+	switch {
+	case key == kafkaMetadataKey && version == 1:
+		e.int32(int32(len(k.listeners)))
+		for i, l := range k.listeners {
+			host, port, _ := net.SplitHostPort(l.Addr().String())
+			p, _ := strconv.Atoi(port)
+			e.int32(int32(i))
+			e.string(host)
+			e.int32(int32(p))
+			e.int16(-1) // rack
+		}
+		e.int32(0) // controller
+		n := d.arrayLen()
+		e.int32(int32(n))
+		for i := 0; i < n; i++ {
+			topic := d.string()
+			e.int16(k.topicErrs[topic])
+			e.string(topic)
+			e.int8(0)
+			e.int32(int32(k.partitions))
+			for p := 0; p < k.partitions; p++ {
+				leader := int32(p % len(k.listeners))
+				e.int16(0)
+				e.int32(int32(p))
+				e.int32(leader)
+				e.int32(1) // replicas
+				e.int32(leader)
+				e.int32(1) // in-sync replicas
+				e.int32(leader)
+			}
+		}
+
+	case key == kafkaProduceKey && version == 3:
+		d.string() // transactional ID
+		acks := d.int16()
+		d.int32() // timeout
+		nt := d.arrayLen()
+		e.int32(int32(nt))
+		for i := 0; i < nt; i++ {
+			topic := d.string()
+			e.string(topic)
+			np := d.arrayLen()
+			e.int32(int32(np))
+			for j := 0; j < np; j++ {
+				p := d.int32()
+				batch := d.bytes()
+				if d.err != nil {
+					return nil, d.err
+				}
+				code := int16(0)
+				if int(p)%len(k.listeners) != int(id) {
+					code = 6 // NOT_LEADER_OR_FOLLOWER
+				} else if len(k.errs) > 0 {
+					code, k.errs = k.errs[0], k.errs[1:]
+				}
+				if code == 0 {
+					records, err := readRecordBatches(batch)
+					if err != nil {
+						return nil, err
+					}
+					if len(batch) > 61 && binary.BigEndian.Uint16(batch[21:])&7 != 0 {
+						k.compressed++
+					}
+					tp := kafkaPartition{topic, p}
+					k.records[tp] = append(k.records[tp], records...)
+				}
+				e.int32(p)
+				e.int16(code)
+				e.int64(0)  // base offset
+				e.int64(-1) // log append time
+			}
+		}
+		e.int32(0) // throttle time
+		if acks == 0 {
+			return nil, d.err
+		}
+
+	default:
+		return nil, fmt.Errorf("unexpected request key %d version %d", key, version)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+	return e.b, nil
+}
+
+// produced returns the records produced to the partitions of topic, and
+// clears them.
+func (k *fakeKafka) produced(topic string) map[int32][]kafkaRecord {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	m := make(map[int32][]kafkaRecord)
+	for tp, records := range k.records {
+		if tp.topic == topic {
+			m[tp.partition] = records
+			delete(k.records, tp)
+		}
+	}
+	return m
+}
+
+// readRecordBatches returns the records of the version 2 record batches
+// in b.
+func readRecordBatches(b []byte) ([]kafkaRecord, error) {
+	var records []kafkaRecord
+	d := &kafkaDecoder{b: b}
+	for len(d.b) > 0 && d.err == nil {
+		d.int64() // base offset
+		batch := &kafkaDecoder{b: d.next(int(d.int32()))}
+		if d.err != nil {
+			return nil, d.err
+		}
+		batch.int32() // partition leader epoch
+		if magic := batch.int8(); magic != kafkaRecordBatchMagic {
+			return nil, fmt.Errorf("unsupported record batch version %d", magic)
+		}
+		crc := uint32(batch.int32())
+		if crc32.Checksum(batch.b, crc32c) != crc {
+			return nil, errors.New("record batch CRC mismatch")
+		}
+		attributes := batch.int16()
+		batch.int32() // last offset delta
+		base := batch.int64()
+		batch.int64()  // max timestamp
+		batch.next(14) // producer ID, epoch, and base sequence
+		n := batch.arrayLen()
+		data := batch.b
+		switch attributes & 7 {
+		case 0:
+		case kafkaCompressionGzip:
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			if data, err = ioutil.ReadAll(zr); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported compression %d", attributes&7)
+		}
+		rd := &kafkaDecoder{b: data}
+		for i := 0; i < n && rd.err == nil; i++ {
+			r := &kafkaDecoder{b: rd.next(int(rd.varint()))}
+			r.int8() // attributes
+			ts := base + r.varint()
+			r.varint() // offset delta
+			key := r.varbytes()
+			value := r.varbytes()
+			if r.err != nil {
+				return nil, r.err
+			}
+			records = append(records, kafkaRecord{
+				key:   key,
+				value: value,
+				time:  time.Unix(0, ts*int64(time.Millisecond)),
+			})
+		}
+		if rd.err != nil {
+			return nil, rd.err
+		}
+	}
+	return records, d.err
+}
+
+func TestKafkaMurmur2(t *testing.T) {
+	// Values computed by the Kafka Java client's Utils.murmur2.
+	for s, h := range map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"abc":                        479470107,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+	} {
+		if got := kafkaMurmur2([]byte(s)); got != h {
+			t.Errorf("kafkaMurmur2(%q) = %d, expected %d", s, got, h)
+		}
+	}
+}
+
+func TestKafkaOutput(t *testing.T) {
+	k := newFakeKafka(t, 2, 4)
+	defer k.Close()
+
+	msgs := testMessages(t, 20)
+	var frames [][]byte
+	for _, dt := range msgs {
+		b, err := proto.Marshal(dt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, b)
+	}
+	run := func(opt *KafkaOptions) KafkaStats {
+		t.Helper()
+		opt.Brokers = []string{"127.0.0.1:1", k.addr(1)}
+		opt.RetryInterval = time.Millisecond
+		o, err := NewKafkaOutput(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go o.RunOutputLoop()
+		for _, f := range frames {
+			o.GetOutputChannel() <- append([]byte(nil), f...)
+		}
+		o.Close()
+		return o.Stats()
+	}
+
+	// Records keyed by client address are produced to the partition
+	// chosen by hashing the key, and routed to its leader.
+	stats := run(&KafkaOptions{Topic: "dnstap", KeyByClient: true})
+	if stats != (KafkaStats{Delivered: 20}) {
+		t.Errorf("stats %+v", stats)
+	}
+	sent := make(map[string]bool)
+	for _, f := range frames {
+		sent[string(f)] = true
+	}
+	n := 0
+	for p, records := range k.produced("dnstap") {
+		for _, r := range records {
+			if want := (kafkaMurmur2(r.key) & 0x7fffffff) % 4; r.key != nil && p != want {
+				t.Errorf("key %s produced to partition %d, expected %d", r.key, p, want)
+			}
+			if !sent[string(r.value)] {
+				t.Errorf("unexpected record value %x", r.value)
+			}
+			n++
+		}
+	}
+	if n != 20 {
+		t.Errorf("%d records produced, expected 20", n)
+	}
+
+	// Topics are chosen by message type; unkeyed records go to a single
+	// partition per batch. Records are compressed, and retried after
+	// retriable errors.
+	k.mu.Lock()
+	k.errs = []int16{6, 5}
+	k.mu.Unlock()
+	stats = run(&KafkaOptions{
+		Topic:       "dnstap.{type}",
+		Format:      KafkaJSON,
+		Compression: KafkaCompressionGzip,
+		MaxRetries:  2,
+	})
+	if stats.Delivered != 20 || stats.Failed != 0 || stats.Retried == 0 {
+		t.Errorf("stats %+v", stats)
+	}
+	for _, dt := range msgs[:3] {
+		topic := "dnstap." + map[Message_Type]string{
+			Message_AUTH_QUERY:      "auth_query",
+			Message_AUTH_RESPONSE:   "auth_response",
+			Message_RESOLVER_QUERY:  "resolver_query",
+			Message_CLIENT_QUERY:    "client_query",
+			Message_CLIENT_RESPONSE: "client_response",
+		}[dt.Message.GetType()]
+		if topic == "dnstap." {
+			continue
+		}
+		produced := k.produced(topic)
+		if len(produced) != 1 {
+			t.Errorf("topic %s produced to %d partitions, expected 1", topic, len(produced))
+		}
+		line, _ := JSONFormat(dt)
+		for _, records := range produced {
+			if string(records[0].value)+"\n" != string(line) || records[0].key != nil {
+				t.Errorf("record %q %s, expected %s", records[0].key, records[0].value, line)
+			}
+		}
+	}
+	k.mu.Lock()
+	if k.compressed == 0 {
+		t.Error("no compressed batches produced")
+	}
+	k.mu.Unlock()
+
+	// Records failing with non-retriable errors, or too many retriable
+	// errors, are counted as failed.
+	k.mu.Lock()
+	k.topicErrs["denied"] = 29 // TOPIC_AUTHORIZATION_FAILED
+	k.errs = []int16{6, 6, 6}
+	k.mu.Unlock()
+	if stats := run(&KafkaOptions{Topic: "denied", MaxRetries: 1}); stats != (KafkaStats{Failed: 20}) {
+		t.Errorf("stats %+v", stats)
+	}
+	if stats := run(&KafkaOptions{Topic: "retried", MaxRetries: 2}); stats != (KafkaStats{Failed: 20, Retried: 40}) {
+		t.Errorf("stats %+v", stats)
+	}
+	k.mu.Lock()
+	k.errs = nil
+	k.mu.Unlock()
+
+	// Without acknowledgement, records are delivered once sent.
+	if stats := run(&KafkaOptions{Topic: "{identity}", Acks: KafkaAcksNone}); stats != (KafkaStats{Delivered: 20}) {
+		t.Errorf("stats %+v", stats)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := len(k.produced(kafkaTopicName(string(msgs[0].Identity)))); n != 1 {
+		t.Errorf("identity topic produced to %d partitions, expected 1", n)
+	}
+}
+
+// TestKafkaOutputPartitionErrors checks that an error for one partition
+// of a Produce request fails or retries only that partition's records.
+func TestKafkaOutputPartitionErrors(t *testing.T) {
+	k := newFakeKafka(t, 1, 4)
+	defer k.Close()
+
+	var frames [][]byte
+	sent := make(map[string]int)
+	for _, dt := range testMessages(t, 20) {
+		b, err := proto.Marshal(dt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, b)
+		sent[string(b)]++
+	}
+	for _, tc := range []struct {
+		topic      string
+		code       int16
+		maxRetries int
+	}{
+		{"too-large", 10, 0}, // MESSAGE_TOO_LARGE
+		{"timed-out", 7, 1},  // REQUEST_TIMED_OUT
+	} {
+		k.mu.Lock()
+		k.errs = []int16{tc.code}
+		k.mu.Unlock()
+		o, err := NewKafkaOutput(&KafkaOptions{
+			Brokers:       []string{k.addr(0)},
+			Topic:         tc.topic,
+			KeyByClient:   true,
+			MaxRetries:    tc.maxRetries,
+			RetryInterval: time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go o.RunOutputLoop()
+		for _, f := range frames {
+			o.GetOutputChannel() <- append([]byte(nil), f...)
+		}
+		o.Close()
+		stats := o.Stats()
+
+		produced := k.produced(tc.topic)
+		if len(produced) < 2 {
+			t.Fatalf("%s: records produced to %d partitions, expected several", tc.topic, len(produced))
+		}
+		stored := make(map[string]int)
+		n := 0
+		for _, records := range produced {
+			for _, r := range records {
+				stored[string(r.value)]++
+				n++
+			}
+		}
+		if uint64(n) != stats.Delivered || stats.Delivered+stats.Failed != 20 {
+			t.Errorf("%s: stats %+v with %d records stored", tc.topic, stats, n)
+		}
+		if tc.maxRetries == 0 && stats.Failed == 0 {
+			t.Errorf("%s: no records failed", tc.topic)
+		}
+		if tc.maxRetries > 0 && stats.Failed != 0 {
+			t.Errorf("%s: records failed after retry", tc.topic)
+		}
+		for v, c := range stored {
+			if c > sent[v] {
+				t.Errorf("%s: record %x stored %d times, sent %d", tc.topic, v, c, sent[v])
+			}
+		}
+	}
+}
+
+// TestKafkaRecordedExchange replays the exchange recorded with an
+// independent implementation of the Kafka protocol in
+// testdata/kafka-exchange.txt, checking that KafkaOutput sends the same
+// requests and accepts the responses.
+func TestKafkaRecordedExchange(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/kafka-exchange.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type message struct {
+		request bool
+		b       []byte
+	}
+	var conns [][]message
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		n, err := strconv.Atoi(f[0])
+		if err != nil || len(f) != 3 || n != len(conns) && n != len(conns)+1 {
+			t.Fatalf("invalid line %q", line)
+		}
+		b, err := hex.DecodeString(f[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > len(conns) {
+			conns = append(conns, nil)
+		}
+		conns[n-1] = append(conns[n-1], message{f[1] == ">", b})
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// The broker address given in the metadata is the recording's, at the
+	// same host, whose port is replaced by that of the listener.
+	host := []byte("\x00\x09127.0.0.1")
+	port := l.Addr().(*net.TCPAddr).Port
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- func() error {
+			for i, msgs := range conns {
+				c, err := l.Accept()
+				if err != nil {
+					return err
+				}
+				defer c.Close()
+				for _, m := range msgs {
+					if !m.request {
+						b := append([]byte(nil), m.b...)
+						if i := bytes.Index(b, host); i >= 0 {
+							binary.BigEndian.PutUint32(b[i+len(host):], uint32(port))
+						}
+						if _, err := c.Write(b); err != nil {
+							return err
+						}
+						continue
+					}
+					b := make([]byte, len(m.b))
+					if _, err := io.ReadFull(c, b[:4]); err != nil {
+						return err
+					}
+					if size := binary.BigEndian.Uint32(b); int(size) != len(b)-4 {
+						return fmt.Errorf("connection %d: request of %d bytes, expected %d", i+1, size, len(b)-4)
+					}
+					if _, err := io.ReadFull(c, b[4:]); err != nil {
+						return err
+					}
+					if !bytes.Equal(b, m.b) {
+						return fmt.Errorf("connection %d: request\n%x\nexpected\n%x", i+1, b, m.b)
+					}
+				}
+			}
+			return nil
+		}()
+	}()
+
+	o, err := NewKafkaOutput(&KafkaOptions{
+		Brokers: []string{l.Addr().String()},
+		Topic:   "dnstap",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go o.RunOutputLoop()
+	for _, sec := range []uint64{1600000000, 1600000001} {
+		dt := testClientQuery(t)
+		dt.Message.QueryTimeSec = proto.Uint64(sec)
+		b, err := proto.Marshal(dt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.GetOutputChannel() <- b
+	}
+	o.Close()
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if stats := o.Stats(); stats != (KafkaStats{Delivered: 2}) {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestKafkaOutputOptions(t *testing.T) {
+	for _, opt := range []*KafkaOptions{
+		nil,
+		{Topic: "dnstap"},
+		{Brokers: []string{"localhost:9092"}},
+	} {
+		if _, err := NewKafkaOutput(opt); err == nil {
+			t.Errorf("NewKafkaOutput(%+v) succeeded", opt)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package dnstap
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// testStream returns a Reader over a Frame Streams encoding of client
+// queries with the given query times, in seconds.
+func testStream(t *testing.T, secs ...uint64) Reader {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := NewEncoder(w)
+	for _, sec := range secs {
+		dt := testClientQuery(t)
+		dt.Message.QueryTimeSec = proto.Uint64(sec)
+		if err := enc.Encode(dt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	r, err := NewReader(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func mergedTimes(t *testing.T, mi *MergeInput) []uint64 {
+	out := make(chan []byte, 32)
+	go func() {
+		mi.ReadInto(out)
+		close(out)
+	}()
+	var secs []uint64
+	for frame := range out {
+		dt := &Dnstap{}
+		if err := proto.Unmarshal(frame, dt); err != nil {
+			t.Fatal(err)
+		}
+		secs = append(secs, dt.Message.GetQueryTimeSec())
+	}
+	return secs
+}
+
+func TestMergeInput(t *testing.T) {
+	mi := NewMergeInput(
+		testStream(t, 1, 4, 5, 9),
+		testStream(t, 2, 3, 6),
+		testStream(t),
+		testStream(t, 1, 7, 8),
+	)
+	secs := mergedTimes(t, mi)
+	want := []uint64{1, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if len(secs) != len(want) {
+		t.Fatalf("merged %v, want %v", secs, want)
+	}
+	for i := range want {
+		if secs[i] != want[i] {
+			t.Fatalf("merged %v, want %v", secs, want)
+		}
+	}
+}
+
+func TestMergeInputDedup(t *testing.T) {
+	mi := NewMergeInput(testStream(t, 1, 2, 3), testStream(t, 2, 3, 4))
+	mi.SetDeduplicate(true)
+	secs := mergedTimes(t, mi)
+	if len(secs) != 4 {
+		t.Errorf("merged %v, want 4 unique frames", secs)
+	}
+}
@@ -0,0 +1,796 @@
+package dnstap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// thriftDecoder decodes Thrift compact protocol structs into maps from
+// field IDs to int64, []byte, []interface{}, or nested map values.
+type thriftDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *thriftDecoder) byte() byte {
+	if len(d.b) == 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c
+}
+
+func (d *thriftDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *thriftDecoder) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		return int64(2 - typ)
+	case 3:
+		return int64(int8(d.byte()))
+	case 4, 5, 6:
+		v := d.uvarint()
+		return int64(v>>1) ^ -int64(v&1)
+	case 7:
+		if len(d.b) < 8 {
+			d.err = io.ErrUnexpectedEOF
+			return nil
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(d.b))
+		d.b = d.b[8:]
+		return v
+	case 8:
+		n := int(d.uvarint())
+		if n > len(d.b) {
+			d.err = io.ErrUnexpectedEOF
+			return nil
+		}
+		v := d.b[:n]
+		d.b = d.b[n:]
+		return v
+	case 9:
+		h := d.byte()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(d.uvarint())
+		}
+		var list []interface{}
+		for i := 0; i < n && d.err == nil; i++ {
+			elem := h & 15
+			if elem == 1 || elem == 2 {
+				list = append(list, int64(d.byte()))
+				continue
+			}
+			list = append(list, d.value(elem))
+		}
+		return list
+	case 12:
+		return d.structure()
+	}
+	d.err = fmt.Errorf("unsupported thrift type %d", typ)
+	return nil
+}
+
+func (d *thriftDecoder) structure() map[int16]interface{} {
+	s := make(map[int16]interface{})
+	var last int16
+	for d.err == nil {
+		h := d.byte()
+		if h == 0 {
+			break
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			v := d.uvarint()
+			id = int16(v>>1) ^ -int16(v&1)
+		}
+		s[id] = d.value(h & 15)
+		last = id
+	}
+	return s
+}
+
+// A thriftField is a field of a struct of parquetThrift: its name, its
+// type, which is a base type, an enum or struct of parquetThrift, or a
+// list<type>, and whether it is required.
+type thriftField struct {
+	name     string
+	typ      string
+	required bool
+}
+
+// parquetThrift transcribes the structs of parquet.thrift, in
+// https://github.com/apache/parquet-format, that describe the file metadata
+// and pages, omitting the fields and structs used only by features
+// ParquetWriter does not write. Fields not listed are rejected, so that a
+// misnumbered field is not mistaken for an unknown one.
+var parquetThrift = map[string]map[int16]thriftField{
+	"FileMetaData": {
+		1: {"version", "i32", true},
+		2: {"schema", "list<SchemaElement>", true},
+		3: {"num_rows", "i64", true},
+		4: {"row_groups", "list<RowGroup>", true},
+		5: {"key_value_metadata", "list<KeyValue>", false},
+		6: {"created_by", "string", false},
+		7: {"column_orders", "list<ColumnOrder>", false},
+	},
+	"SchemaElement": {
+		1: {"type", "Type", false},
+		2: {"type_length", "i32", false},
+		3: {"repetition_type", "FieldRepetitionType", false},
+		4: {"name", "string", true},
+		5: {"num_children", "i32", false},
+		6: {"converted_type", "ConvertedType", false},
+		7: {"scale", "i32", false},
+		8: {"precision", "i32", false},
+		9: {"field_id", "i32", false},
+	},
+	"RowGroup": {
+		1: {"columns", "list<ColumnChunk>", true},
+		2: {"total_byte_size", "i64", true},
+		3: {"num_rows", "i64", true},
+		5: {"file_offset", "i64", false},
+		6: {"total_compressed_size", "i64", false},
+		7: {"ordinal", "i16", false},
+	},
+	"ColumnChunk": {
+		1: {"file_path", "string", false},
+		2: {"file_offset", "i64", true},
+		3: {"meta_data", "ColumnMetaData", false},
+	},
+	"ColumnMetaData": {
+		1:  {"type", "Type", true},
+		2:  {"encodings", "list<Encoding>", true},
+		3:  {"path_in_schema", "list<string>", true},
+		4:  {"codec", "CompressionCodec", true},
+		5:  {"num_values", "i64", true},
+		6:  {"total_uncompressed_size", "i64", true},
+		7:  {"total_compressed_size", "i64", true},
+		8:  {"key_value_metadata", "list<KeyValue>", false},
+		9:  {"data_page_offset", "i64", true},
+		10: {"index_page_offset", "i64", false},
+		11: {"dictionary_page_offset", "i64", false},
+		12: {"statistics", "Statistics", false},
+	},
+	"Statistics": {
+		1: {"max", "binary", false},
+		2: {"min", "binary", false},
+		3: {"null_count", "i64", false},
+		4: {"distinct_count", "i64", false},
+		5: {"max_value", "binary", false},
+		6: {"min_value", "binary", false},
+	},
+	"KeyValue": {
+		1: {"key", "string", true},
+		2: {"value", "string", false},
+	},
+	"ColumnOrder": {
+		1: {"TYPE_ORDER", "TypeDefinedOrder", false},
+	},
+	"TypeDefinedOrder": {},
+	"PageHeader": {
+		1: {"type", "PageType", true},
+		2: {"uncompressed_page_size", "i32", true},
+		3: {"compressed_page_size", "i32", true},
+		4: {"crc", "i32", false},
+		5: {"data_page_header", "DataPageHeader", false},
+	},
+	"DataPageHeader": {
+		1: {"num_values", "i32", true},
+		2: {"encoding", "Encoding", true},
+		3: {"definition_level_encoding", "Encoding", true},
+		4: {"repetition_level_encoding", "Encoding", true},
+		5: {"statistics", "Statistics", false},
+	},
+}
+
+// parquetEnums gives the values of the enums of parquet.thrift used by
+// parquetThrift.
+var parquetEnums = map[string]map[int64]string{
+	"Type": {0: "BOOLEAN", 1: "INT32", 2: "INT64", 3: "INT96", 4: "FLOAT",
+		5: "DOUBLE", 6: "BYTE_ARRAY", 7: "FIXED_LEN_BYTE_ARRAY"},
+	"FieldRepetitionType": {0: "REQUIRED", 1: "OPTIONAL", 2: "REPEATED"},
+	"ConvertedType": {0: "UTF8", 1: "MAP", 2: "MAP_KEY_VALUE", 3: "LIST",
+		4: "ENUM", 5: "DECIMAL", 6: "DATE", 7: "TIME_MILLIS", 8: "TIME_MICROS",
+		9: "TIMESTAMP_MILLIS", 10: "TIMESTAMP_MICROS", 11: "UINT_8",
+		12: "UINT_16", 13: "UINT_32", 14: "UINT_64", 15: "INT_8", 16: "INT_16",
+		17: "INT_32", 18: "INT_64", 19: "JSON", 20: "BSON", 21: "INTERVAL"},
+	"Encoding": {0: "PLAIN", 2: "PLAIN_DICTIONARY", 3: "RLE", 4: "BIT_PACKED",
+		5: "DELTA_BINARY_PACKED", 6: "DELTA_LENGTH_BYTE_ARRAY",
+		7: "DELTA_BYTE_ARRAY", 8: "RLE_DICTIONARY", 9: "BYTE_STREAM_SPLIT"},
+	"CompressionCodec": {0: "UNCOMPRESSED", 1: "SNAPPY", 2: "GZIP", 3: "LZO",
+		4: "BROTLI", 5: "LZ4", 6: "ZSTD", 7: "LZ4_RAW"},
+	"PageType": {0: "DATA_PAGE", 1: "INDEX_PAGE", 2: "DICTIONARY_PAGE",
+		3: "DATA_PAGE_V2"},
+}
+
+// checkThrift checks that d holds a struct of type def of parquetThrift in
+// the Thrift compact protocol, with each field of the type and wire type
+// given there, and with all of its required fields.
+func checkThrift(d *thriftDecoder, def string) error {
+	return checkThriftStruct(d, def, def)
+}
+
+// checkThriftStruct checks a struct of type def, named name in errors.
+func checkThriftStruct(d *thriftDecoder, def, name string) error {
+	fields, ok := parquetThrift[def]
+	if !ok {
+		return fmt.Errorf("unknown struct %s", def)
+	}
+	seen := make(map[int16]bool)
+	var last int16
+	for {
+		h := d.byte()
+		if d.err != nil {
+			return fmt.Errorf("%s: %v", name, d.err)
+		}
+		if h == 0 {
+			break
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			v := d.uvarint()
+			id = int16(v>>1) ^ -int16(v&1)
+		}
+		last = id
+		f, ok := fields[id]
+		if !ok {
+			return fmt.Errorf("%s: unknown field %d", name, id)
+		}
+		if seen[id] {
+			return fmt.Errorf("%s: duplicate field %s", name, f.name)
+		}
+		seen[id] = true
+		if err := checkThriftValue(d, h&15, f.typ, name+"."+f.name); err != nil {
+			return err
+		}
+	}
+	for id, f := range fields {
+		if f.required && !seen[id] {
+			return fmt.Errorf("%s: missing required field %s", name, f.name)
+		}
+	}
+	return nil
+}
+
+// checkThriftValue checks a value of type typ with the compact protocol
+// type wire.
+func checkThriftValue(d *thriftDecoder, wire byte, typ, name string) error {
+	var want byte
+	switch {
+	case strings.HasPrefix(typ, "list<"):
+		want = 9
+	case typ == "bool":
+		if wire != 1 && wire != 2 {
+			return fmt.Errorf("%s: wire type %d, expected bool", name, wire)
+		}
+		return nil
+	case typ == "i16":
+		want = 4
+	case typ == "i32" || parquetEnums[typ] != nil:
+		want = 5
+	case typ == "i64":
+		want = 6
+	case typ == "binary" || typ == "string":
+		want = 8
+	default:
+		want = 12
+	}
+	if wire != want {
+		return fmt.Errorf("%s: wire type %d, expected %d for %s", name, wire, want, typ)
+	}
+	switch want {
+	case 9:
+		elem := typ[len("list<") : len(typ)-1]
+		h := d.byte()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(d.uvarint())
+		}
+		for i := 0; i < n && d.err == nil; i++ {
+			if err := checkThriftValue(d, h&15, elem, fmt.Sprintf("%s[%d]", name, i)); err != nil {
+				return err
+			}
+		}
+	case 12:
+		return checkThriftStruct(d, typ, name)
+	default:
+		v := d.value(wire)
+		if d.err != nil {
+			break
+		}
+		switch typ {
+		case "i16":
+			if v.(int64) != int64(int16(v.(int64))) {
+				return fmt.Errorf("%s: %d out of range", name, v)
+			}
+		case "string":
+			if !utf8.Valid(v.([]byte)) {
+				return fmt.Errorf("%s: invalid UTF-8", name)
+			}
+		case "binary", "i64":
+		default:
+			if v.(int64) != int64(int32(v.(int64))) {
+				return fmt.Errorf("%s: %d out of range", name, v)
+			}
+			if e := parquetEnums[typ]; e != nil && e[v.(int64)] == "" {
+				return fmt.Errorf("%s: invalid %s %d", name, typ, v)
+			}
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf("%s: %v", name, d.err)
+	}
+	return nil
+}
+
+// readParquetLevels decodes n levels of bit width 1 in the RLE/bit-packed
+// hybrid encoding.
+func readParquetLevels(b []byte, n int) ([]uint8, error) {
+	var levels []uint8
+	d := &thriftDecoder{b: b}
+	for len(levels) < n && d.err == nil {
+		h := d.uvarint()
+		if h&1 == 0 {
+			v := d.byte()
+			for i := 0; i < int(h>>1); i++ {
+				levels = append(levels, v)
+			}
+			continue
+		}
+		for g := 0; g < int(h>>1); g++ {
+			v := d.byte()
+			for i := 0; i < 8; i++ {
+				levels = append(levels, v>>i&1)
+			}
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(levels) < n {
+		return nil, errors.New("too few levels")
+	}
+	return levels[:n], nil
+}
+
+// readParquet returns the number of row groups in the Parquet file data
+// and the values of its columns, by name, with nil for nulls. It checks
+// the file metadata and page headers against parquetThrift, and the file
+// against the rules of the Parquet format for the features ParquetWriter
+// uses.
+func readParquet(t *testing.T, data []byte) (int, map[string][]interface{}) {
+	t.Helper()
+	if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatal("missing Parquet magic")
+	}
+	n := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := len(data) - 8 - n
+	if footer < 4 {
+		t.Fatal("invalid file metadata length")
+	}
+	cd := &thriftDecoder{b: data[footer : len(data)-8]}
+	if err := checkThrift(cd, "FileMetaData"); err != nil || len(cd.b) != 0 {
+		t.Fatalf("invalid file metadata: %v", err)
+	}
+	d := &thriftDecoder{b: data[footer : len(data)-8]}
+	meta := d.structure()
+	if d.err != nil || len(d.b) != 0 {
+		t.Fatalf("invalid file metadata: %v", d.err)
+	}
+	if v := meta[1].(int64); v != 1 && v != 2 {
+		t.Fatalf("file metadata version %d", v)
+	}
+
+	// The first schema element is the root group, and the others its
+	// optional leaf columns, whose converted types must suit their
+	// physical types.
+	schema := meta[2].([]interface{})
+	root := schema[0].(map[int16]interface{})
+	if _, ok := root[1]; ok {
+		t.Fatal("schema root has a type")
+	}
+	var names []string
+	var types []int64
+	for _, sev := range schema[1:] {
+		se := sev.(map[int16]interface{})
+		name := string(se[4].([]byte))
+		typ, ok := se[1].(int64)
+		if !ok {
+			t.Fatalf("schema column %s has no type", name)
+		}
+		if _, ok := se[5]; ok {
+			t.Fatalf("schema column %s has children", name)
+		}
+		if se[3] != int64(1) {
+			t.Fatalf("schema column %s is not optional", name)
+		}
+		if ct, ok := se[6]; ok &&
+			!(ct == int64(0) && typ == 6) && !(ct == int64(10) && typ == 2) {
+			t.Fatalf("schema column %s: converted type %d for type %d", name, ct, typ)
+		}
+		names = append(names, name)
+		types = append(types, typ)
+	}
+	if len(names) != int(root[5].(int64)) {
+		t.Fatal("schema children count mismatch")
+	}
+	if orders, ok := meta[7].([]interface{}); ok && len(orders) != len(names) {
+		t.Fatalf("%d column orders for %d columns", len(orders), len(names))
+	}
+	columns := make(map[string][]interface{})
+	rowGroups := meta[4].([]interface{})
+	var rows int64
+	next := int64(4) // the expected offset of the next column chunk
+	for _, rgv := range rowGroups {
+		rg := rgv.(map[int16]interface{})
+		nrows := rg[3].(int64)
+		rows += nrows
+		chunks := rg[1].([]interface{})
+		if len(chunks) != len(names) {
+			t.Fatalf("%d column chunks, expected %d", len(chunks), len(names))
+		}
+		var rgBytes int64
+		for i, ccv := range chunks {
+			cm := ccv.(map[int16]interface{})[3].(map[int16]interface{})
+			typ := cm[1].(int64)
+			path := cm[3].([]interface{})
+			name := string(path[0].([]byte))
+			if len(path) != 1 || name != names[i] || typ != types[i] || cm[5].(int64) != nrows {
+				t.Fatalf("column %d: %s of type %d with %d values", i, name, typ, cm[5])
+			}
+			off := cm[9].(int64)
+			if off != next {
+				t.Fatalf("column %s: data page at %d, expected %d", name, off, next)
+			}
+			next += cm[7].(int64)
+			if next > int64(footer) {
+				t.Fatalf("column %s: overlaps file metadata", name)
+			}
+			rgBytes += cm[6].(int64)
+			if err := checkThrift(&thriftDecoder{b: data[off:]}, "PageHeader"); err != nil {
+				t.Fatalf("column %s: invalid page header: %v", name, err)
+			}
+			d := &thriftDecoder{b: data[off:]}
+			ph := d.structure()
+			if d.err != nil {
+				t.Fatal(d.err)
+			}
+			dph, ok := ph[5].(map[int16]interface{})
+			if ph[1] != int64(0) || !ok || dph[1] != nrows {
+				t.Fatalf("column %s: page is not a data page of %d values", name, nrows)
+			}
+			hdrLen := len(data[off:]) - len(d.b)
+			page := d.b[:ph[3].(int64)]
+			if int64(hdrLen)+ph[3].(int64) != cm[7].(int64) ||
+				int64(hdrLen)+ph[2].(int64) != cm[6].(int64) {
+				t.Fatalf("column %s: sizes do not match page header", name)
+			}
+			if cm[4].(int64) == 2 {
+				zr, err := gzip.NewReader(bytes.NewReader(page))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if page, err = ioutil.ReadAll(zr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if int64(len(page)) != ph[2].(int64) {
+				t.Fatalf("column %s: uncompressed size mismatch", name)
+			}
+			ll := binary.LittleEndian.Uint32(page)
+			levels, err := readParquetLevels(page[4:4+ll], int(nrows))
+			if err != nil {
+				t.Fatalf("column %s: %v", name, err)
+			}
+			values := page[4+ll:]
+			nulls, bit := int64(0), 0
+			for _, l := range levels {
+				if l == 0 {
+					columns[name] = append(columns[name], nil)
+					nulls++
+					continue
+				}
+				var v interface{}
+				switch typ {
+				case 0:
+					v = values[bit/8]>>(bit%8)&1 == 1
+					bit++
+				case 1:
+					v = int64(int32(binary.LittleEndian.Uint32(values)))
+					values = values[4:]
+				case 2:
+					v = int64(binary.LittleEndian.Uint64(values))
+					values = values[8:]
+				case 6:
+					n := binary.LittleEndian.Uint32(values)
+					v = string(values[4 : 4+n])
+					values = values[4+n:]
+				}
+				columns[name] = append(columns[name], v)
+			}
+			if bit > 0 {
+				values = values[(bit+7)/8:]
+			}
+			if len(values) != 0 {
+				t.Fatalf("column %s: %d bytes after values", name, len(values))
+			}
+			stats := cm[12].(map[int16]interface{})
+			if stats[3].(int64) != nulls {
+				t.Errorf("column %s: null count %d, expected %d", name, stats[3], nulls)
+			}
+			checkParquetStats(t, name, typ, stats, columns[name][len(columns[name])-int(nrows):])
+		}
+		if rg[2].(int64) != rgBytes {
+			t.Errorf("row group of %d bytes, expected %d", rg[2], rgBytes)
+		}
+	}
+	if next != int64(footer) {
+		t.Errorf("file metadata at %d, expected %d", footer, next)
+	}
+	if rows != meta[3].(int64) {
+		t.Errorf("row groups hold %d rows, expected %d", rows, meta[3])
+	}
+	return len(rowGroups), columns
+}
+
+// checkParquetStats checks the minimum and maximum of the statistics of a
+// column chunk of the given type, which are in the PLAIN encoding, against
+// its values.
+func checkParquetStats(t *testing.T, name string, typ int64, stats map[int16]interface{}, values []interface{}) {
+	t.Helper()
+	var min, max int64
+	n := 0
+	for _, v := range values {
+		i, ok := v.(int64)
+		if !ok {
+			continue
+		}
+		if n == 0 || i < min {
+			min = i
+		}
+		if n == 0 || i > max {
+			max = i
+		}
+		n++
+	}
+	smin, minOK := stats[6].([]byte)
+	smax, maxOK := stats[5].([]byte)
+	if n == 0 {
+		if minOK || maxOK {
+			t.Errorf("column %s: statistics of a column without values", name)
+		}
+		return
+	}
+	decode := func(b []byte) int64 {
+		if typ == 1 && len(b) == 4 {
+			return int64(int32(binary.LittleEndian.Uint32(b)))
+		}
+		if typ == 2 && len(b) == 8 {
+			return int64(binary.LittleEndian.Uint64(b))
+		}
+		t.Fatalf("column %s: statistics value %x for type %d", name, b, typ)
+		return 0
+	}
+	if !minOK || !maxOK || decode(smin) != min || decode(smax) != max {
+		t.Errorf("column %s: statistics %x-%x, expected %d-%d", name, smin, smax, min, max)
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	msgs := testMessages(t, 250)
+	for _, compression := range []ParquetCompression{ParquetUncompressed, ParquetGzip} {
+		var buf bytes.Buffer
+		pw := NewParquetWriter(&buf, &ParquetOptions{RowGroupSize: 100, Compression: compression})
+		for _, dt := range msgs {
+			if err := pw.Write(dt); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := pw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		groups, columns := readParquet(t, buf.Bytes())
+		if groups != 3 {
+			t.Errorf("%d row groups, expected 3", groups)
+		}
+		for name, values := range columns {
+			if len(values) != len(msgs) {
+				t.Fatalf("column %s has %d values, expected %d", name, len(values), len(msgs))
+			}
+		}
+		for i, dt := range msgs {
+			want := map[string]interface{}{
+				"identity": strings.ToValidUTF8(string(dt.Identity), "\uFFFD"),
+				"time":     nil, "type": nil, "query_address": nil,
+				"query_size": nil, "query_port": nil,
+				"qname": nil, "qtype": nil, "rcode": nil, "rd": nil, "answer_count": nil,
+			}
+			if m := dt.Message; m != nil {
+				mt, _ := messageTime(dt)
+				want["time"] = mt.UnixNano() / 1000
+				want["type"] = m.GetType().String()
+				want["query_address"] = net.IP(m.QueryAddress).String()
+				want["query_size"] = int64(len(m.QueryMessage))
+				if m.QueryPort != nil {
+					want["query_port"] = int64(*m.QueryPort)
+				}
+				wire := m.ResponseMessage
+				if isQueryType(m.GetType()) {
+					wire = m.QueryMessage
+				}
+				if h, err := ParseDNSHeader(wire); err == nil {
+					want["rd"] = h.Flags&0x0100 != 0
+					want["answer_count"] = int64(h.ANCount)
+					if h.Response() {
+						want["rcode"] = dns.RcodeToString[h.Rcode()]
+					}
+				}
+				if q, err := ParseDNSQuestion(wire); err == nil {
+					want["qname"] = q.Name
+					want["qtype"] = dns.TypeToString[q.Qtype]
+				}
+			}
+			for name, v := range want {
+				if got := columns[name][i]; got != v {
+					t.Errorf("row %d %s: %#v, expected %#v", i, name, got, v)
+				}
+			}
+		}
+	}
+
+	// A file without rows is still valid.
+	var buf bytes.Buffer
+	if err := NewParquetWriter(&buf, nil).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if groups, _ := readParquet(t, buf.Bytes()); groups != 0 {
+		t.Errorf("%d row groups in empty file", groups)
+	}
+}
+
+func TestParquetThriftCheck(t *testing.T) {
+	schema := func(e *thriftEncoder, typ int32) {
+		e.list(2, thriftStruct, 2)
+		e.beginElem()
+		e.binary(4, "root")
+		e.i32(5, 1)
+		e.endStruct()
+		e.beginElem()
+		e.i32(1, typ)
+		e.binary(4, "c")
+		e.endStruct()
+	}
+	for _, tc := range []struct {
+		meta func(e *thriftEncoder)
+		err  string
+	}{
+		{func(e *thriftEncoder) {
+			e.i32(1, 1)
+			schema(e, parquetInt32)
+			e.i64(3, 0)
+			e.list(4, thriftStruct, 0)
+		}, ""},
+		{func(e *thriftEncoder) {
+			e.i32(1, 1)
+			schema(e, parquetInt32)
+			e.i32(3, 0)
+			e.list(4, thriftStruct, 0)
+		}, "FileMetaData.num_rows: wire type 5, expected 6 for i64"},
+		{func(e *thriftEncoder) {
+			e.i32(1, 1)
+			schema(e, parquetInt32)
+			e.i64(3, 0)
+		}, "FileMetaData: missing required field row_groups"},
+		{func(e *thriftEncoder) {
+			e.i32(1, 1)
+			schema(e, 8)
+			e.i64(3, 0)
+			e.list(4, thriftStruct, 0)
+		}, "FileMetaData.schema[1].type: invalid Type 8"},
+		{func(e *thriftEncoder) {
+			e.i32(1, 1)
+			schema(e, parquetInt32)
+			e.i64(3, 0)
+			e.list(4, thriftStruct, 0)
+			e.binary(10, "x")
+		}, "FileMetaData: unknown field 10"},
+	} {
+		e := &thriftEncoder{}
+		tc.meta(e)
+		e.end()
+		err := checkThrift(&thriftDecoder{b: e.b}, "FileMetaData")
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("checkThrift: %v, expected %q", err, tc.err)
+		}
+	}
+}
+
+func TestParquetLevels(t *testing.T) {
+	for _, levels := range [][]uint8{
+		{1},
+		{0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0},
+		append(make([]uint8, 20), 1, 0, 1),
+	} {
+		b := appendParquetLevels(nil, levels)
+		got, err := readParquetLevels(b, len(levels))
+		if err != nil || !bytes.Equal(got, levels) {
+			t.Errorf("levels %v decoded as %v, %v", levels, got, err)
+		}
+	}
+	long := make([]uint8, 1000)
+	for i := range long {
+		long[i] = uint8(i % 2)
+	}
+	got, err := readParquetLevels(appendParquetLevels(nil, long), len(long))
+	if err != nil || !bytes.Equal(got, long) {
+		t.Errorf("alternating levels decoded incorrectly: %v", err)
+	}
+}
+
+func TestParquetOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	o, err := NewParquetOutput(&ParquetOutputOptions{
+		MaxRows: 40,
+		MaxAge:  time.Hour,
+		Create: func(n int) (io.Writer, error) {
+			return os.Create(filepath.Join(dir, fmt.Sprintf("%d.parquet", n)))
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go o.RunOutputLoop()
+	for _, dt := range testMessages(t, 100) {
+		b, err := proto.Marshal(dt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.GetOutputChannel() <- b
+	}
+	o.GetOutputChannel() <- []byte("invalid")
+	o.Close()
+
+	for n, rows := range []int{40, 40, 20} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("%d.parquet", n)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, columns := readParquet(t, data); len(columns["time"]) != rows {
+			t.Errorf("file %d has %d rows, expected %d", n, len(columns["time"]), rows)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "3.parquet")); !os.IsNotExist(err) {
+		t.Errorf("empty file created: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package dnstap
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// startTestServer starts a DNS server on a local port of the given network
+// answering every query with a single A record.
+func startTestServer(t *testing.T, network string) (addr string, shutdown func()) {
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   net.ParseIP("192.0.2.53"),
+		})
+		w.WriteMsg(m)
+	})
+	started := make(chan struct{})
+	srv := &dns.Server{Net: network, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	switch network {
+	case "udp":
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.PacketConn = pc
+		addr = pc.LocalAddr().String()
+	default:
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.Listener = l
+		addr = l.Addr().String()
+	}
+	go srv.ActivateAndServe()
+	<-started
+	return addr, func() { srv.Shutdown() }
+}
+
+// A fakeClock stands in for the time package in tests of pacing. Its time
+// advances only by sleeping, and it records the durations slept.
+type fakeClock struct {
+	mu    sync.Mutex
+	t     time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+	c.slept = append(c.slept, d)
+}
+
+// waits returns the durations slept.
+func (c *fakeClock) waits() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.slept
+}
+
+func TestReplayOutput(t *testing.T) {
+	for _, network := range []string{"udp", "tcp"} {
+		addr, shutdown := startTestServer(t, network)
+		defer shutdown()
+
+		results := make(chan []byte, 32)
+		o := NewReplayOutput(addr, results, &ReplayOptions{
+			Speed:   100,
+			Workers: 2,
+			Timeout: time.Second,
+			Network: network,
+			Logger:  &testLogger{t},
+		})
+		var clock fakeClock
+		o.now, o.sleep = clock.now, clock.sleep
+		go o.RunOutputLoop()
+		for sec := uint64(0); sec < 3; sec++ {
+			dt := testClientQuery(t)
+			dt.Message.QueryTimeSec = proto.Uint64(sec)
+			b, err := proto.Marshal(dt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			o.GetOutputChannel() <- b
+		}
+		o.Close()
+		close(results)
+		if d := clock.waits(); !reflect.DeepEqual(d, []time.Duration{10 * time.Millisecond, 10 * time.Millisecond}) {
+			t.Errorf("%s: replay of 2s at speed 100 waited %v, expected 10ms twice", network, d)
+		}
+
+		counts := make(map[Message_Type]int)
+		for b := range results {
+			dt := &Dnstap{}
+			if err := proto.Unmarshal(b, dt); err != nil {
+				t.Fatal(err)
+			}
+			if problems := Validate(dt); len(problems) > 0 {
+				t.Errorf("%s: invalid result: %v", network, problems)
+			}
+			counts[dt.Message.GetType()]++
+		}
+		if counts[Message_TOOL_QUERY] != 3 || counts[Message_TOOL_RESPONSE] != 3 {
+			t.Errorf("%s: results %v, want 3 TOOL_QUERY and 3 TOOL_RESPONSE", network, counts)
+		}
+	}
+}
@@ -2,10 +2,15 @@ package dnstap
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
+
+	"google.golang.org/protobuf/proto"
 )
 
 type testLogger struct{ *testing.T }
@@ -212,3 +217,281 @@ func BenchmarkConnectBidirectional(b *testing.B) {
 	// wait for the reader
 	<-readDone
 }
+
+func TestSourcedInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dnstap.sock")
+
+	in, err := NewFrameStreamSockInputFromPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.SetLogger(&testLogger{t})
+	out := make(chan SourcedFrame)
+	go in.ReadSourcedInto(out)
+	defer dialAndSend(t, "unix", path).Close()
+
+	select {
+	case sf := <-out:
+		if string(sf.Frame) != "frame" || sf.Conn.ID != 1 || sf.Conn.Accepted.IsZero() {
+			t.Errorf("read %q from %+v", sf.Frame, sf.Conn)
+		}
+		if runtime.GOOS == "linux" && (sf.Conn.Cred == nil || sf.Conn.Cred.PID != os.Getpid()) {
+			t.Errorf("peer credentials %+v, expected pid %d", sf.Conn.Cred, os.Getpid())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for frame")
+	}
+}
+
+func TestStamp(t *testing.T) {
+	conn := &ConnInfo{
+		ID:         3,
+		RemoteAddr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 41952},
+		Cred:       &PeerCred{PID: 1234, UID: 53, GID: 53},
+	}
+	const want = "conn=3 remote=192.0.2.1:41952 pid=1234 uid=53 gid=53"
+	if s := conn.String(); s != want {
+		t.Fatalf("ConnInfo.String() = %q, expected %q", s, want)
+	}
+
+	for _, tc := range []struct {
+		stamp                   StampFunc
+		identity, extra         string
+		wantIdentity, wantExtra string
+	}{
+		{StampIdentity, "", "", want, ""},
+		{StampIdentity, "ns1", "x", "ns1", "x"},
+		{StampExtra, "ns1", "", "ns1", want},
+		{StampExtra, "", "x", "", want},
+	} {
+		dt := &Dnstap{Type: Dnstap_MESSAGE.Enum(), Message: &Message{Type: Message_CLIENT_QUERY.Enum()}}
+		if tc.identity != "" {
+			dt.Identity = []byte(tc.identity)
+		}
+		if tc.extra != "" {
+			dt.Extra = []byte(tc.extra)
+		}
+		b, err := proto.Marshal(dt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Dnstap
+		if err := proto.Unmarshal(tc.stamp(b, conn), &got); err != nil {
+			t.Fatal(err)
+		}
+		if string(got.Identity) != tc.wantIdentity || string(got.Extra) != tc.wantExtra ||
+			got.GetMessage().GetType() != Message_CLIENT_QUERY {
+			t.Errorf("stamped %+v: %v", dt, &got)
+		}
+	}
+
+	if b := StampIdentity([]byte("\xff"), conn); string(b) != "\xff" {
+		t.Errorf("StampIdentity modified an invalid frame: %q", b)
+	}
+}
+
+func TestConnLimits(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Connections are closed after the test finishes, so no logger is
+	// set.
+	in := NewFrameStreamSockInput(l)
+	in.SetMaxConnectionsPerSource(1)
+	in.SetIdleTimeout(200 * time.Millisecond)
+	out := make(chan []byte, 16)
+	go in.ReadInto(out)
+
+	type flushWriter interface {
+		Writer
+		Flush() error
+	}
+	send := func(w Writer) {
+		if _, err := w.WriteFrame([]byte("frame")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.(flushWriter).Flush(); err != nil {
+			t.Fatal(err)
+		}
+		readOne(t, out)
+	}
+	connect := func() (Writer, error) {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewWriter(c, &WriterOptions{Bidirectional: true, Timeout: time.Second})
+	}
+
+	w, err := connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := connect(); err == nil {
+		t.Error("connection beyond the per-source limit accepted")
+	}
+	send(w)
+
+	// The first connection is closed when idle, allowing another.
+	time.Sleep(500 * time.Millisecond)
+	w2, err := connect()
+	if err != nil {
+		t.Fatalf("connection after idle timeout refused: %v", err)
+	}
+	send(w2)
+}
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(1000)
+	start := time.Now()
+	// The first second's events are allowed at once.
+	for i := 0; i < 1500; i++ {
+		rl.wait()
+	}
+	if d := time.Since(start); d < 400*time.Millisecond || d > 2*time.Second {
+		t.Errorf("1500 events at 1000/s with a burst of 1000 took %v", d)
+	}
+	newRateLimiter(0).wait()
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dnstap.sock")
+
+	// A file which is not a socket is removed only with Force.
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ListenUnixSocket(path, nil); err == nil {
+		t.Fatal("replaced a regular file")
+	}
+
+	opt := &UnixSocketOptions{
+		Mode:  0660,
+		Owner: fmt.Sprint(os.Getuid()),
+		Group: fmt.Sprint(os.Getgid()),
+		Force: true,
+	}
+	l, err := ListenUnixSocket(path, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0660 {
+		t.Errorf("socket mode %v, expected 0660", fi.Mode())
+	}
+
+	// A socket with a listener is not replaced, but a stale one is.
+	if _, err := ListenUnixSocket(path, nil); err == nil {
+		t.Fatal("replaced a socket in use")
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	l, err = ListenUnixSocket(path, nil)
+	if err != nil {
+		t.Fatalf("stale socket not replaced: %v", err)
+	}
+	l.Close()
+
+	if _, err := ListenUnixSocket("@dnstap-test", &UnixSocketOptions{Mode: 0600}); err == nil {
+		t.Error("set the mode of an abstract socket")
+	}
+	if runtime.GOOS == "linux" {
+		name := fmt.Sprintf("@dnstap-test-%d", os.Getpid())
+		l, err := ListenUnixSocket(name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		in := NewFrameStreamSockInput(l)
+		out := make(chan []byte)
+		go in.ReadInto(out)
+		defer dialAndSend(t, "unix", name).Close()
+		readOne(t, out)
+	}
+}
+
+func TestUnidirectionalSockInput(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := NewFrameStreamSockInput(l)
+	in.SetBidirectional(false)
+	out := make(chan []byte, 16)
+	go in.ReadInto(out)
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriter(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := w.WriteFrame([]byte("frame")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	readOne(t, out)
+	readOne(t, out)
+}
+
+func TestDatagramInput(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := NewDatagramInput(conn)
+	in.SetLogger(&testLogger{t})
+	out := make(chan []byte, 16)
+	go in.ReadInto(out)
+
+	c, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, frame := range []string{"a", "", "b"} {
+		if _, err := c.Write([]byte(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"a", "b"} {
+		select {
+		case b := <-out:
+			if string(b) != want {
+				t.Errorf("read %q, expected %q", b, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for frame")
+		}
+	}
+
+	conn.Close()
+	done := make(chan struct{})
+	go func() {
+		in.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("DatagramInput did not finish when closed")
+	}
+}
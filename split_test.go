@@ -0,0 +1,121 @@
+package dnstap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSplitEncoder(t *testing.T) {
+	files := make(map[string]*bytes.Buffer)
+	se := NewSplitEncoder(&SplitOptions{
+		Start:       time.Unix(2, 0),
+		End:         time.Unix(9, 0),
+		MaxMessages: 2,
+		ByIdentity:  true,
+		Create: func(identity string, n int) (io.Writer, error) {
+			buf := new(bytes.Buffer)
+			files[fmt.Sprintf("%s.%d", identity, n)] = buf
+			return buf, nil
+		},
+	})
+
+	for sec := uint64(0); sec < 10; sec++ {
+		dt := testClientQuery(t)
+		dt.Message.QueryTimeSec = proto.Uint64(sec)
+		if sec%2 == 1 {
+			dt.Identity = []byte("odd")
+		}
+		if err := se.Encode(dt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := se.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2,4,6,8 as "test"; 3,5,7 as "odd"
+	want := map[string]int{"test.0": 2, "test.1": 2, "odd.0": 2, "odd.1": 1}
+	if len(files) != len(want) {
+		t.Errorf("wrote %d files, want %d", len(files), len(want))
+	}
+	for name, count := range want {
+		buf, ok := files[name]
+		if !ok {
+			t.Errorf("missing file %s", name)
+			continue
+		}
+		r, err := NewReader(buf, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		dec := NewDecoder(r, int(MaxPayloadSize))
+		n := 0
+		for {
+			err := dec.Decode(&Dnstap{})
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			n++
+		}
+		if n != count {
+			t.Errorf("%s: read %d messages, want %d", name, n, count)
+		}
+	}
+}
+
+func TestSplitEncoderMaxOpenFiles(t *testing.T) {
+	var created []string
+	open := make(map[string]bool)
+	se := NewSplitEncoder(&SplitOptions{
+		ByIdentity:   true,
+		MaxOpenFiles: 2,
+		Create: func(identity string, n int) (io.Writer, error) {
+			name := fmt.Sprintf("%s.%d", identity, n)
+			created = append(created, name)
+			open[name] = true
+			if len(open) > 2 {
+				t.Errorf("%d files open", len(open))
+			}
+			return &splitTestFile{name: name, open: open}, nil
+		},
+	})
+	for _, id := range []string{"a", "b", "a", "c", "a", "b"} {
+		dt := testClientQuery(t)
+		dt.Identity = []byte(id)
+		if err := se.Encode(dt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := se.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Opening c closes b, the least recently written, and b then
+	// starts a new file, closing c.
+	want := "a.0 b.0 c.0 b.1"
+	if got := strings.Join(created, " "); got != want {
+		t.Errorf("created %s, want %s", got, want)
+	}
+	if len(open) != 0 {
+		t.Errorf("files left open: %v", open)
+	}
+}
+
+type splitTestFile struct {
+	bytes.Buffer
+	name string
+	open map[string]bool
+}
+
+func (f *splitTestFile) Close() error {
+	delete(f.open, f.name)
+	return nil
+}
@@ -0,0 +1,184 @@
+package dnstap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+func syslogTestFrames(t *testing.T) [][]byte {
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeAAAA)
+	response := new(dns.Msg)
+	response.SetRcode(query, dns.RcodeServerFailure)
+	qwire, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rwire, err := response.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec := uint64(1700000000)
+	var frames [][]byte
+	for _, dt := range []*Dnstap{
+		{
+			Type:     Dnstap_MESSAGE.Enum(),
+			Identity: []byte(`ns"1]`),
+			Message: &Message{
+				Type:         Message_CLIENT_QUERY.Enum(),
+				QueryAddress: net.ParseIP("192.0.2.1").To4(),
+				QueryTimeSec: &sec,
+				QueryMessage: qwire,
+			},
+		},
+		{
+			Type: Dnstap_MESSAGE.Enum(),
+			Message: &Message{
+				Type:            Message_CLIENT_RESPONSE.Enum(),
+				QueryAddress:    net.ParseIP("2001:db8::1"),
+				ResponseTimeSec: &sec,
+				ResponseMessage: rwire,
+			},
+		},
+	} {
+		b, err := proto.Marshal(dt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, b)
+	}
+	return frames
+}
+
+func TestSyslogOutput(t *testing.T) {
+	frames := syslogTestFrames(t)
+	pid := strconv.Itoa(os.Getpid())
+	expected := []*regexp.Regexp{
+		regexp.MustCompile(`^<83>1 2023-11-14T22:13:20\.000000Z host dnstap ` + pid + ` CLIENT_QUERY ` +
+			`\[dnstap@32473 identity="ns\\"1\\]" type="CLIENT_QUERY" client="192\.0\.2\.1" qname="example\.com\." qtype="AAAA"\] ` +
+			`\S+ CQ 192\.0\.2\.1 .* "example\.com\." IN AAAA$`),
+		regexp.MustCompile(`^<84>1 2023-11-14T22:13:20\.000000Z host dnstap ` + pid + ` CLIENT_RESPONSE ` +
+			`\[dnstap@32473 type="CLIENT_RESPONSE" client="2001:db8::1" qname="example\.com\." qtype="AAAA" rcode="SERVFAIL"\] ` +
+			`\{"type":"MESSAGE".*\}$`),
+	}
+	opt := &SyslogOptions{
+		Facility:      SyslogAuthPriv,
+		Severity:      SyslogError,
+		RcodeSeverity: map[int]SyslogSeverity{dns.RcodeServerFailure: SyslogWarning},
+		Hostname:      "host",
+	}
+	run := func(network, address string, format SyslogFormat) {
+		t.Helper()
+		opt.Format = format
+		o, err := NewSyslogOutput(network, address, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go o.RunOutputLoop()
+		for _, f := range frames {
+			o.GetOutputChannel() <- f
+		}
+		o.Close()
+	}
+	check := func(i int, msg string) {
+		t.Helper()
+		if !expected[i].MatchString(msg) {
+			t.Errorf("message %d:\n%s\ndoes not match\n%s", i, msg, expected[i])
+		}
+	}
+
+	// Over UDP, and a unix datagram socket, each message is a datagram.
+	dir, err := ioutil.TempDir("", "syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	unixgram, err := net.ListenPacket("unixgram", filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unixgram.Close()
+	for _, pc := range []net.PacketConn{udp, unixgram} {
+		network := "udp"
+		if pc == unixgram {
+			network = "unix"
+		}
+		// The text format is used for the query, and JSON for the
+		// response.
+		for i, format := range []SyslogFormat{SyslogText, SyslogJSON} {
+			run(network, pc.LocalAddr().String(), format)
+			buf := make([]byte, 4096)
+			for j := range frames {
+				pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+				n, _, err := pc.ReadFrom(buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i == j {
+					check(i, string(buf[:n]))
+				}
+			}
+		}
+	}
+
+	// Over TCP, messages are framed by octet counting, and truncated only
+	// if a maximum length is given.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, max := range []int{0, 100} {
+		opt.MaxLength = max
+		run("tcp", l.Addr().String(), SyslogText)
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := bufio.NewReader(conn)
+		for i := range frames {
+			var n int
+			if _, err := fmt.Fscanf(r, "%d ", &n); err != nil {
+				t.Fatal(err)
+			}
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				t.Fatal(err)
+			}
+			if max > 0 && n != max && i == 0 {
+				t.Errorf("message length %d, expected %d", n, max)
+			}
+			if max == 0 && i == 0 {
+				check(0, string(msg))
+			}
+			if !strings.HasPrefix(string(msg), "<8") {
+				t.Errorf("message %d: %q", i, msg)
+			}
+		}
+		conn.Close()
+	}
+}
+
+func TestSyslogOutputNetwork(t *testing.T) {
+	if _, err := NewSyslogOutput("ip", "127.0.0.1", nil); err == nil {
+		t.Error("NewSyslogOutput succeeded with network ip")
+	}
+}
@@ -0,0 +1,98 @@
+package dnstap
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSystemdListeners(t *testing.T) {
+	if l, err := SystemdListeners(); err != nil || l != nil {
+		t.Fatalf("SystemdListeners() without socket activation = %v, %v", l, err)
+	}
+
+	for _, names := range []string{"", "dnstap"} {
+		l, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := l.(*net.TCPListener).File()
+		l.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// systemdListeners takes ownership of the descriptor.
+		fd, err := syscall.Dup(int(f.Fd()))
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		os.Setenv("LISTEN_FDS", "1")
+		os.Setenv("LISTEN_FDNAMES", names)
+		listeners, err := systemdListeners(fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := names
+		if name == "" {
+			name = "unknown"
+		}
+		if len(listeners) != 1 || len(listeners[name]) != 1 {
+			t.Fatalf("listeners %v, expected one named %s", listeners, name)
+		}
+		listeners[name][0].Close()
+		if os.Getenv("LISTEN_FDS") != "" {
+			t.Error("LISTEN_FDS not unset")
+		}
+	}
+}
+
+func TestSystemdNotify(t *testing.T) {
+	if err := SystemdNotify("READY=1"); err != nil {
+		t.Fatalf("SystemdNotify without NOTIFY_SOCKET: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", path)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	if err := SystemdNotify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "READY=1" {
+		t.Errorf("received %q, %v", buf[:n], err)
+	}
+}
+
+func TestSystemdWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	if d := SystemdWatchdogInterval(); d != 30*time.Second {
+		t.Errorf("interval %v, expected 30s", d)
+	}
+	os.Setenv("WATCHDOG_PID", "1")
+	if d := SystemdWatchdogInterval(); d != 0 {
+		t.Errorf("interval %v for another process, expected 0", d)
+	}
+}
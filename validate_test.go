@@ -0,0 +1,121 @@
+package dnstap
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+func testQuery(t *testing.T, response bool) []byte {
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	msg.Id = 1234
+	msg.Response = response
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func testClientQuery(t *testing.T) *Dnstap {
+	return &Dnstap{
+		Type:     Dnstap_MESSAGE.Enum(),
+		Identity: []byte("test"),
+		Message: &Message{
+			Type:           Message_CLIENT_QUERY.Enum(),
+			SocketFamily:   SocketFamily_INET.Enum(),
+			SocketProtocol: SocketProtocol_UDP.Enum(),
+			QueryAddress:   net.ParseIP("192.0.2.1").To4(),
+			QueryPort:      proto.Uint32(53000),
+			QueryTimeSec:   proto.Uint64(1600000000),
+			QueryTimeNsec:  proto.Uint32(0),
+			QueryMessage:   testQuery(t, false),
+		},
+	}
+}
+
+func hasProblem(problems []ValidationProblem, sev ValidationSeverity, field string) bool {
+	for _, p := range problems {
+		if p.Severity == sev && p.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidate(t *testing.T) {
+	if problems := Validate(testClientQuery(t)); len(problems) > 0 {
+		t.Fatalf("valid message reported problems: %v", problems)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		modify func(dt *Dnstap)
+		sev    ValidationSeverity
+		field  string
+	}{
+		{"missing type", func(dt *Dnstap) { dt.Type = nil }, ValidationError, "type"},
+		{"missing message", func(dt *Dnstap) { dt.Message = nil }, ValidationError, "message"},
+		{"missing message type", func(dt *Dnstap) { dt.Message.Type = nil }, ValidationError, "message.type"},
+		{"address length", func(dt *Dnstap) {
+			dt.Message.QueryAddress = net.ParseIP("2001:db8::1")
+		}, ValidationError, "message.query_address"},
+		{"port range", func(dt *Dnstap) { dt.Message.QueryPort = proto.Uint32(70000) }, ValidationError, "message.query_port"},
+		{"nsec range", func(dt *Dnstap) { dt.Message.QueryTimeNsec = proto.Uint32(1e9) }, ValidationError, "message.query_time_nsec"},
+		{"undecodable", func(dt *Dnstap) { dt.Message.QueryMessage = []byte{1, 2, 3} }, ValidationError, "message.query_message"},
+		{"response in query", func(dt *Dnstap) {
+			dt.Message.QueryMessage = testQuery(t, true)
+		}, ValidationError, "message.query_message"},
+		{"query in response type", func(dt *Dnstap) {
+			dt.Message.Type = Message_CLIENT_RESPONSE.Enum()
+			dt.Message.ResponseMessage = testQuery(t, false)
+		}, ValidationError, "message.response_message"},
+		{"missing query time", func(dt *Dnstap) {
+			dt.Message.QueryTimeSec = nil
+			dt.Message.QueryTimeNsec = nil
+		}, ValidationWarning, "message.query_time"},
+	} {
+		dt := testClientQuery(t)
+		tc.modify(dt)
+		problems := Validate(dt)
+		if !hasProblem(problems, tc.sev, tc.field) {
+			t.Errorf("%s: expected %s on %s, got %v", tc.name, tc.sev, tc.field, problems)
+		}
+	}
+}
+
+func TestValidateFrame(t *testing.T) {
+	dt := testClientQuery(t)
+	dt.Type = nil
+	frame, err := proto.MarshalOptions{AllowPartial: true}.Marshal(dt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dt, problems := ValidateFrame(frame)
+	if dt == nil {
+		t.Fatal("ValidateFrame rejected a partial message")
+	}
+	if !hasProblem(problems, ValidationError, "type") {
+		t.Errorf("expected missing type error, got %v", problems)
+	}
+
+	if _, problems := ValidateFrame([]byte{0xff}); !hasProblem(problems, ValidationError, "") {
+		t.Errorf("expected decode error, got %v", problems)
+	}
+}
+
+func TestFormatMissingFields(t *testing.T) {
+	dt := testClientQuery(t)
+	dt.Type = nil
+	dt.Message.Type = nil
+	for _, f := range []TextFormatFunc{TextFormat, YamlFormat, JSONFormat} {
+		f(dt)
+	}
+	dt.Message = nil
+	for _, f := range []TextFormatFunc{TextFormat, YamlFormat, JSONFormat} {
+		f(dt)
+	}
+}
@@ -0,0 +1,136 @@
+package dnstap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestView(t *testing.T) {
+	for i, frame := range testFrames(t, 200) {
+		dt := &Dnstap{}
+		if err := proto.Unmarshal(frame, dt); err != nil {
+			t.Fatal(err)
+		}
+		v, err := ParseView(frame)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if v.Type != dt.GetType() || !bytes.Equal(v.Identity, dt.Identity) ||
+			!bytes.Equal(v.Version, dt.Version) || v.HasMessage != (dt.Message != nil) {
+			t.Fatalf("frame %d: view %+v does not match %v", i, v, dt)
+		}
+		m := dt.Message
+		if m == nil {
+			continue
+		}
+		vm := &v.Message
+		if vm.Type != m.GetType() || (m.SocketFamily == nil) != (vm.SocketFamily == 0) ||
+			(m.SocketFamily != nil && vm.SocketFamily != *m.SocketFamily) ||
+			vm.SocketProtocol != m.GetSocketProtocol() ||
+			vm.QueryPort != m.GetQueryPort() || vm.ResponsePort != m.GetResponsePort() ||
+			!bytes.Equal(vm.QueryAddress, m.QueryAddress) ||
+			!bytes.Equal(vm.ResponseAddress, m.ResponseAddress) ||
+			!bytes.Equal(vm.QueryZone, m.QueryZone) ||
+			!bytes.Equal(vm.QueryMessage, m.QueryMessage) ||
+			!bytes.Equal(vm.ResponseMessage, m.ResponseMessage) {
+			t.Fatalf("frame %d: message view %+v does not match %v", i, vm, m)
+		}
+		vt, vok := vm.Time()
+		mt, mok := messageTime(dt)
+		if vok != mok || !vt.Equal(mt) {
+			t.Errorf("frame %d: time %v, %v, expected %v, %v", i, vt, vok, mt, mok)
+		}
+
+		wire := m.ResponseMessage
+		if isQueryType(m.GetType()) {
+			wire = m.QueryMessage
+		}
+		msg := new(dns.Msg)
+		q, err := vm.Question()
+		if msg.Unpack(wire) != nil || len(msg.Question) == 0 {
+			if err == nil && string(wire) == "malformed" {
+				t.Errorf("frame %d: parsed question from malformed message", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("frame %d: Question: %v", i, err)
+		}
+		if q.Name != msg.Question[0].Name || q.Qtype != msg.Question[0].Qtype ||
+			q.Qclass != msg.Question[0].Qclass {
+			t.Errorf("frame %d: question %+v, expected %v", i, q, msg.Question[0])
+		}
+		h, err := vm.Header()
+		if err != nil || h.ID != msg.Id || h.Response() != msg.Response ||
+			h.Opcode() != msg.Opcode || h.Rcode() != msg.Rcode {
+			t.Errorf("frame %d: header %+v, %v does not match %v", i, h, err, msg.MsgHdr)
+		}
+	}
+}
+
+func TestViewErrors(t *testing.T) {
+	frame := testFrames(t, 1)[0]
+	for n := 1; n < len(frame); n++ {
+		if (proto.UnmarshalOptions{AllowPartial: true}).Unmarshal(frame[:n], &Dnstap{}) == nil {
+			continue
+		}
+		if _, err := ParseView(frame[:n]); err == nil {
+			t.Errorf("no error parsing frame truncated to %d bytes", n)
+		}
+	}
+
+	if _, err := ParseDNSQuestion([]byte{0, 1, 0, 0}); err != ErrShortDNSMessage {
+		t.Errorf("short message: %v", err)
+	}
+	msg := make([]byte, 12)
+	if _, err := ParseDNSQuestion(msg); err != ErrNoQuestion {
+		t.Errorf("empty question section: %v", err)
+	}
+	msg[5] = 1
+	msg = append(msg, 0, 0, 1)
+	if _, err := ParseDNSQuestion(msg); err != ErrShortDNSMessage {
+		t.Errorf("truncated question: %v", err)
+	}
+}
+
+func TestViewAllocs(t *testing.T) {
+	frame := testFrames(t, 1)[0]
+	var v View
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := v.Parse(frame); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := v.Message.Header(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("View.Parse: %v allocations, expected none", allocs)
+	}
+}
+
+func BenchmarkViewParse(b *testing.B) {
+	frames := testFrames(b, 100)
+	var v View
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v.Parse(frames[i%len(frames)])
+		v.Message.Question()
+	}
+}
+
+func BenchmarkUnmarshalUnpack(b *testing.B) {
+	frames := testFrames(b, 100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		dt := &Dnstap{}
+		if proto.Unmarshal(frames[i%len(frames)], dt) != nil || dt.Message == nil {
+			continue
+		}
+		msg := new(dns.Msg)
+		msg.Unpack(dt.Message.QueryMessage)
+	}
+}